@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"github.com/gin-gonic/gin"
 	"github.com/jinzhu/gorm"
 	"log"
+	"log/slog"
 	"gopkg.in/go-playground/validator.v9"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/mysql"
 	"github.com/gin-contrib/cors"
 	"github.com/RangelReale/osin"
 )
@@ -17,34 +26,103 @@ type App struct {
 	requestHandler  RequestHandler
 	validator       *validator.Validate
 	oauth2Server    *osin.Server
+	tokenJanitor    *TokenJanitor
+	keySet          *KeySet
+	denylist        *TokenDenylist
+	oauth2Config    *OAuth2Config
+	sessionTracker  *SessionTracker
+	auditLog        *AuditLog
+	config          *Config
+	metrics         *Metrics
+	stopTracing     func(ctx context.Context) error
+	server          *http.Server
+	serveErr        chan error
+	certificates    *CertificateReloader
+	rateLimiter     *RateLimiter
+	mailer          Mailer
 }
 
-func InitApp() *App {
-	db, err := gorm.Open("sqlite3", "./notes.db")
-	db.LogMode(true)
+func OpenDB(config DatabaseConfig) (*gorm.DB, error) {
+	db, err := gorm.Open(config.Driver, config.DSN)
+	if err != nil {
+		return nil, err
+	}
+
 	db.SingularTable(true)
+	LogQueries(db, slog.Default(), config.SlowQuery)
+
+	return db, nil
+}
+
+// migrateOnStart applies pending migrations, or only warns about them if migrate is
+// false and they are left to "notes-app migrate up"
+func migrateOnStart(db *gorm.DB, migrate bool) error {
+	migrator := NewMigrator(db)
 
+	if migrate {
+		_, err := migrator.Up(0)
+		return err
+	}
+
+	pending, err := migrator.Pending()
+	if err != nil {
+		return err
+	}
+
+	if len(pending) > 0 {
+		slog.Warn("Migrations are pending, run notes-app migrate up", "pending", len(pending))
+	}
+
+	return nil
+}
+
+func InitApp(config *Config) *App {
+	db, err := OpenDB(config.Database)
 	if err != nil {
 		log.Fatal("Could not connect database")
 	}
 
-	// Migrate the schema
-	db.AutoMigrate(
-		&Note{},
-		&Tag{},
-		&User{},
-		&OAuth2Client{},
-		&OAuth2RefreshToken{},
-		&OAuth2AccessToken{},
-	)
+	if err := migrateOnStart(db, config.Database.Migrate); err != nil {
+		log.Fatalf("Could not migrate database: %s", err)
+	}
+
+	stopTracing, err := InitTracing(config.Tracing)
+	if err != nil {
+		log.Fatalf("Could not start tracing: %s", err)
+	}
+
+	metrics := NewMetrics(db, config.Metrics.CountInterval)
+	db = metrics.InstrumentDB(db)
 
 	validator := NewValidator()
 	responseHandler := NewResponseHandler()
-	r := gin.Default()
-	r.Use(cors.Default())
+	r := gin.New()
+	r.Use(NewTracingMiddleware())
+	r.Use(NewLoggerMiddleware(slog.Default()))
+	r.Use(NewRecoveryMiddleware(responseHandler))
+	r.Use(NewMetricsMiddleware(metrics))
+	r.Use(NewBodyLimitMiddleware(int64(config.Server.MaxBodyBytes), responseHandler))
+	r.Use(cors.New(config.Server.CORS()))
 	r.NoRoute(responseHandler.NoRoute)
 
-	oauth2 := NewOAuth2Server(db)
+	oauth2Config := config.OAuth2
+	keySet, err := oauth2Config.NewKeySet(db, config.Tokens.KeySync)
+	if err != nil {
+		log.Fatalf("Could not load signing keys: %s", err)
+	}
+
+	rateLimiter, err := NewRateLimiter(config.RateLimit)
+	if err != nil {
+		log.Fatalf("Could not create rate limiter: %s", err)
+	}
+
+	mailer, err := NewMailer(config.Mail)
+	if err != nil {
+		log.Fatalf("Could not create mailer: %s", err)
+	}
+
+	denylist := NewTokenDenylist(db, config.Tokens.DenylistSync)
+	oauth2 := NewOAuth2Server(db, oauth2Config, keySet, denylist, metrics)
 
 	app := &App{
 		r,
@@ -53,6 +131,20 @@ func InitApp() *App {
 		NewRequestHandler(),
 		validator,
 		oauth2,
+		NewTokenJanitor(db, config.Tokens.PruneInterval, config.Tokens.PruneBatchSize),
+		keySet,
+		denylist,
+		oauth2Config,
+		NewSessionTracker(db, config.Tokens.SessionActivity),
+		NewAuditLog(db),
+		config,
+		metrics,
+		stopTracing,
+		nil,
+		nil,
+		nil,
+		rateLimiter,
+		mailer,
 	}
 
 	InitHandlers(app)
@@ -60,8 +152,117 @@ func InitApp() *App {
 	return app
 }
 
-func (app *App) Run() {
-	app.Engine().Run()
+// Run serves requests until SIGINT or SIGTERM, then shuts down gracefully
+func (app *App) Run() error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := app.Start(ctx); err != nil {
+		return err
+	}
+
+	slog.Info("Listening", "addr", app.Addr())
+
+	var err error
+	select {
+	case <-ctx.Done():
+		slog.Info("Shutting down")
+	case err = <-app.serveErr:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), app.config.Server.ShutdownTimeout)
+	defer cancel()
+
+	if shutdownErr := app.Shutdown(shutdownCtx); err == nil {
+		err = shutdownErr
+	}
+
+	return err
+}
+
+// Start listens on the configured address, serves requests in the background and
+// starts the background jobs. HTTPS is served if a certificate is configured.
+func (app *App) Start(ctx context.Context) error {
+	app.server = NewHTTPServer(app.config.Server, app.engine)
+
+	if tlsConfig := app.config.Server.TLS; tlsConfig.Enabled() {
+		certificates, err := NewCertificateReloader(tlsConfig.CertFile, tlsConfig.KeyFile, tlsConfig.ReloadInterval)
+		if err != nil {
+			return err
+		}
+
+		if app.server.TLSConfig, err = NewTLSConfig(tlsConfig, certificates); err != nil {
+			return err
+		}
+
+		app.certificates = certificates
+	}
+
+	listener, err := new(net.ListenConfig).Listen(ctx, "tcp", app.config.Server.Addr)
+	if err != nil {
+		return err
+	}
+
+	app.server.Addr = listener.Addr().String()
+	app.serveErr = make(chan error, 1)
+
+	app.tokenJanitor.Start()
+
+	if app.certificates != nil {
+		app.certificates.Start()
+	}
+
+	go func() {
+		serve := app.server.Serve
+		if app.server.TLSConfig != nil {
+			serve = func(l net.Listener) error { return app.server.ServeTLS(l, "", "") }
+		}
+
+		if err := serve(listener); err != http.ErrServerClosed {
+			app.serveErr <- err
+		}
+	}()
+
+	return nil
+}
+
+// Addr returns the address the server is listening on, e.g. to find the port chosen
+// for an address ending in :0
+func (app *App) Addr() string {
+	if app.server == nil {
+		return ""
+	}
+
+	return app.server.Addr
+}
+
+// Shutdown stops accepting requests and waits for those in flight to finish, until ctx
+// is done. It then stops the background jobs, flushes traces and closes the database.
+func (app *App) Shutdown(ctx context.Context) error {
+	var err error
+	if app.server != nil {
+		err = app.server.Shutdown(ctx)
+	}
+
+	app.tokenJanitor.Stop()
+
+	if app.certificates != nil {
+		app.certificates.Stop()
+	}
+
+	if err := app.rateLimiter.Close(); err != nil {
+		slog.Error("Could not close rate limit store", "error", err)
+	}
+
+	if err := app.stopTracing(ctx); err != nil {
+		slog.Error("Could not flush traces", "error", err)
+	}
+
+	if closeErr := app.db.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
 }
 
 func (app *App) Engine() *gin.Engine {
@@ -84,6 +285,42 @@ func (app *App) OAuth2Server() *osin.Server {
 	return app.oauth2Server
 }
 
+func (app *App) OAuth2Config() *OAuth2Config {
+	return app.oauth2Config
+}
+
+func (app *App) KeySet() *KeySet {
+	return app.keySet
+}
+
+func (app *App) SessionTracker() *SessionTracker {
+	return app.sessionTracker
+}
+
+func (app *App) AuditLog() *AuditLog {
+	return app.auditLog
+}
+
+func (app *App) TokenJanitor() *TokenJanitor {
+	return app.tokenJanitor
+}
+
+func (app *App) Metrics() *Metrics {
+	return app.metrics
+}
+
+func (app *App) RateLimiter() *RateLimiter {
+	return app.rateLimiter
+}
+
+func (app *App) Mailer() Mailer {
+	return app.mailer
+}
+
+func (app *App) Config() *Config {
+	return app.config
+}
+
 func (app *App) RequestHandler() RequestHandler {
 	return app.requestHandler
 }
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"sync"
+	"time"
+)
+
+const (
+	AuditLoginSucceeded          = "login.succeeded"
+	AuditLoginFailed             = "login.failed"
+	AuditLoginLockout            = "login.lockout"
+	AuditTokenIssued             = "token.issued"
+	AuditTokenCreated            = "token.created"
+	AuditTokenRevoked            = "token.revoked"
+	AuditSessionRevoked          = "session.revoked"
+	AuditSessionsRevoked         = "session.revoked_all"
+	AuditTwoFactorEnabled        = "mfa.enabled"
+	AuditUserRoleChanged         = "user.role_changed"
+	AuditUserDisabled            = "user.disabled"
+	AuditUserEnabled             = "user.enabled"
+	AuditUserPasswordResetForced = "user.password_reset_forced"
+	AuditUserDeleted             = "user.deleted"
+	AuditClientCreated           = "client.created"
+	AuditClientUpdated           = "client.updated"
+	AuditClientSecretRotated     = "client.secret_rotated"
+	AuditClientDeleted           = "client.deleted"
+	AuditNoteCreated             = "note.created"
+	AuditNoteUpdated             = "note.updated"
+	AuditNoteDeleted             = "note.deleted"
+	AuditTagCreated              = "tag.created"
+	AuditTagUpdated              = "tag.updated"
+	AuditTagDeleted              = "tag.deleted"
+	AuditWorkspaceCreated        = "workspace.created"
+	AuditWorkspaceUpdated        = "workspace.updated"
+	AuditWorkspaceDeleted        = "workspace.deleted"
+	AuditWorkspaceShared         = "workspace.shared"
+	AuditWorkspaceJoined         = "workspace.joined"
+	AuditWorkspaceMemberUpdated  = "workspace.member_updated"
+	AuditWorkspaceMemberRemoved  = "workspace.member_removed"
+)
+
+// Auditable is implemented by models that can describe themselves in an audit event
+type Auditable interface {
+	AuditSummary() map[string]interface{}
+}
+
+type AuditLog struct {
+	db *gorm.DB
+	mu sync.Mutex
+}
+
+func NewAuditLog(db *gorm.DB) *AuditLog {
+	return &AuditLog{db: db}
+}
+
+// NewAuditEvent starts an event for action with the client details of the request. The
+// actor is the authenticated user, if there is one.
+func NewAuditEvent(c *gin.Context, action string) *AuditEvent {
+	e := &AuditEvent{
+		Action:    action,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+
+	if user, err := NewRequestHandler().GetUser(c); err == nil {
+		e.ActorId = &user.ID
+	}
+
+	return e
+}
+
+// Log records action on target, with summaries of the target before and after the
+// change. Failures are logged rather than returned, as they should not fail the
+// request that made the change.
+func (l *AuditLog) Log(c *gin.Context, action string, target string, before Auditable, after Auditable) {
+	e := NewAuditEvent(c, action)
+	e.Target = target
+	e.Before = auditSummary(before)
+	e.After = auditSummary(after)
+
+	if err := l.Record(e); err != nil {
+		NewRequestHandler().GetLogger(c).Error("Could not record audit event", "action", action, "error", err)
+	}
+}
+
+// Record appends e to the log. Another instance appending at the same time makes the
+// insert fail on the unique previous hash, in which case it is retried on the new end
+// of the chain.
+func (l *AuditLog) Record(e *AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		if err = l.append(e); err == nil {
+			return nil
+		}
+	}
+
+	return err
+}
+
+func (l *AuditLog) append(e *AuditEvent) error {
+	last := new(AuditEvent)
+	err := l.db.Order("id desc").First(last).Error
+
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+
+	e.ID = 0
+	e.PrevHash = last.Hash
+	// Databases store times with differing precision, so the hashed time is rounded to
+	// one that every dialect keeps. MySQL keeps whole seconds by default.
+	e.CreatedAt = time.Now().UTC().Truncate(time.Second)
+	e.Hash = e.ComputeHash()
+
+	return l.db.Create(e).Error
+}
+
+type AuditVerification struct {
+	Valid   bool `json:"valid"`
+	Checked int  `json:"checked"`
+	// The first event whose hash or link to the previous event does not match
+	BrokenAt *uint `json:"broken_at,omitempty"`
+}
+
+// Verify walks the chain from the first event and reports the first one that has been
+// tampered with
+func (l *AuditLog) Verify() (*AuditVerification, error) {
+	result := &AuditVerification{Valid: true}
+	prevHash := ""
+	var lastId uint
+
+	for {
+		var events []*AuditEvent
+		if err := l.db.Where("id > ?", lastId).Order("id").Limit(500).Find(&events).Error; err != nil {
+			return nil, err
+		}
+
+		if len(events) == 0 {
+			return result, nil
+		}
+
+		for _, e := range events {
+			result.Checked++
+
+			if e.PrevHash != prevHash || e.Hash != e.ComputeHash() {
+				id := e.ID
+				result.Valid = false
+				result.BrokenAt = &id
+				return result, nil
+			}
+
+			prevHash = e.Hash
+			lastId = e.ID
+		}
+	}
+}
+
+// AuditSnapshot holds the summary of a model taken before it is changed in place
+type AuditSnapshot map[string]interface{}
+
+func NewAuditSnapshot(a Auditable) AuditSnapshot {
+	return AuditSnapshot(a.AuditSummary())
+}
+
+func (s AuditSnapshot) AuditSummary() map[string]interface{} {
+	return s
+}
+
+func auditSummary(a Auditable) string {
+	if a == nil {
+		return ""
+	}
+
+	summary, err := json.Marshal(a.AuditSummary())
+	if err != nil {
+		return ""
+	}
+
+	return string(summary)
+}
+
+func auditTarget(kind string, id uint) string {
+	return fmt.Sprintf("%s:%d", kind, id)
+}
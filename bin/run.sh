@@ -3,6 +3,5 @@
 set -x
 set -e
 
-go-wrapper download
-go-wrapper install
-go-wrapper run
\ No newline at end of file
+go build -o /go/bin/go-notes-app .
+exec /go/bin/go-notes-app
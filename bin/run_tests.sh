@@ -4,5 +4,14 @@ set -x
 set -e
 
 # download test dependencies
-go-wrapper download -t
-go test
\ No newline at end of file
+go mod download
+go test ./...
+
+# run the whole suite again against each database that is configured
+if [ -n "$NOTES_TEST_POSTGRES_DSN" ]; then
+    NOTES_TEST_DIALECT=postgres go test ./...
+fi
+
+if [ -n "$NOTES_TEST_MYSQL_DSN" ]; then
+    NOTES_TEST_DIALECT=mysql go test ./...
+fi
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	RegisterCommand("clients", "create", &Command{"-name name -redirect-uri uris [-grants grants] [-scopes scopes] [-tls-subject dn]", createClientCommand})
+	RegisterCommand("clients", "list", &Command{"", listClientsCommand})
+	RegisterCommand("clients", "rotate-secret", &Command{"id", rotateClientSecretCommand})
+	RegisterCommand("clients", "delete", &Command{"id", deleteClientCommand})
+}
+
+func createClientCommand(config *Config, args []string) error {
+	flags := flag.NewFlagSet("clients create", flag.ContinueOnError)
+	client := new(OAuth2Client)
+	flags.StringVar(&client.Name, "name", "", "name shown to users")
+	flags.StringVar(&client.RedirectURI, "redirect-uri", "", "space separated redirect URIs")
+	flags.StringVar(&client.AllowedGrants, "grants", "", "space separated grant types, all if empty")
+	flags.StringVar(&client.AllowedScopes, "scopes", "", "space separated scopes, any if empty")
+	flags.StringVar(&client.TLSClientAuthSubjectDN, "tls-subject", "", "subject of a client certificate that can authenticate in place of the secret")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if err := NewValidator().Struct(client); err != nil {
+		return err
+	}
+
+	db, err := OpenDB(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	client, secret, err := NewOAuth2ClientRepository(db).Create(context.Background(), client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Client id:     %d\nClient secret: %s\n\nThe secret cannot be shown again.\n", client.ID, secret)
+
+	return nil
+}
+
+func listClientsCommand(config *Config, args []string) error {
+	db, err := OpenDB(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	clients, err := NewOAuth2ClientRepository(db).FindAll(context.Background())
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tGRANTS\tSCOPES\tREDIRECT URIS")
+
+	for _, c := range clients {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", c.ID, c.Name, c.AllowedGrants, c.AllowedScopes, c.RedirectURI)
+	}
+
+	return w.Flush()
+}
+
+func rotateClientSecretCommand(config *Config, args []string) error {
+	db, err := OpenDB(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repository := NewOAuth2ClientRepository(db)
+
+	client, err := findClientArg(repository, args)
+	if err != nil {
+		return err
+	}
+
+	secret, err := repository.RotateSecret(context.Background(), client)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Client secret: %s\n\nThe secret cannot be shown again.\n", secret)
+
+	return nil
+}
+
+func deleteClientCommand(config *Config, args []string) error {
+	db, err := OpenDB(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repository := NewOAuth2ClientRepository(db)
+
+	client, err := findClientArg(repository, args)
+	if err != nil {
+		return err
+	}
+
+	storage := NewGORMStorage(db, NewOAuth2Config(), NewTokenDenylist(db, time.Minute), nil)
+	if err := storage.RevokeClient(context.Background(), client); err != nil {
+		return err
+	}
+
+	if err := repository.Delete(context.Background(), client); err != nil {
+		return err
+	}
+
+	fmt.Printf("Deleted client %d\n", client.ID)
+
+	return nil
+}
+
+func findClientArg(repository OAuth2ClientRepository, args []string) (*OAuth2Client, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Expected a client id")
+	}
+
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return nil, errors.New("Client id must be a number")
+	}
+
+	client, err := repository.FindById(context.Background(), id)
+	if err != nil {
+		return nil, fmt.Errorf("Client %d does not exist", id)
+	}
+
+	return client, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Command is a notes-app subcommand, e.g. "notes-app tokens prune"
+type Command struct {
+	Usage string
+	Run   func(config *Config, args []string) error
+}
+
+var commands = map[string]map[string]*Command{}
+
+func RegisterCommand(group string, name string, cmd *Command) {
+	if commands[group] == nil {
+		commands[group] = map[string]*Command{}
+	}
+
+	commands[group][name] = cmd
+}
+
+func RunCommand(config *Config, args []string) error {
+	group, ok := commands[args[0]]
+	if !ok {
+		return errors.New(usage())
+	}
+
+	if len(args) < 2 {
+		return errors.New(usage())
+	}
+
+	cmd, ok := group[args[1]]
+	if !ok {
+		return errors.New(usage())
+	}
+
+	return cmd.Run(config, args[2:])
+}
+
+func usage() string {
+	var lines []string
+
+	for group, cmds := range commands {
+		for name, cmd := range cmds {
+			lines = append(lines, fmt.Sprintf("  notes-app %s %s %s", group, name, cmd.Usage))
+		}
+	}
+
+	sort.Strings(lines)
+
+	return "Usage:\n  notes-app [-config file] [flags]\n" + strings.Join(lines, "\n")
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"text/tabwriter"
+	"time"
+)
+
+func init() {
+	RegisterCommand("migrate", "up", &Command{"[-steps n]", migrateUpCommand})
+	RegisterCommand("migrate", "down", &Command{"[-steps n]", migrateDownCommand})
+	RegisterCommand("migrate", "status", &Command{"", migrateStatusCommand})
+	RegisterCommand("migrate", "create", &Command{"[-dir dir] name", migrateCreateCommand})
+}
+
+func migrateUpCommand(config *Config, args []string) error {
+	flags := flag.NewFlagSet("migrate up", flag.ContinueOnError)
+	steps := flags.Int("steps", 0, "number of migrations to apply, all if 0")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := OpenDB(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	applied, err := NewMigrator(db).Up(*steps)
+	for _, m := range applied {
+		fmt.Printf("Applied %s_%s\n", m.Version, m.Name)
+	}
+
+	if err == nil && len(applied) == 0 {
+		fmt.Println("Nothing to migrate")
+	}
+
+	return err
+}
+
+func migrateDownCommand(config *Config, args []string) error {
+	flags := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+	steps := flags.Int("steps", 1, "number of migrations to revert")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := OpenDB(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	reverted, err := NewMigrator(db).Down(*steps)
+	for _, m := range reverted {
+		fmt.Printf("Reverted %s_%s\n", m.Version, m.Name)
+	}
+
+	return err
+}
+
+func migrateStatusCommand(config *Config, args []string) error {
+	db, err := OpenDB(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	status, err := NewMigrator(db).Status()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+
+	for _, s := range status {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+
+	return w.Flush()
+}
+
+var migrationName = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+func migrateCreateCommand(config *Config, args []string) error {
+	flags := flag.NewFlagSet("migrate create", flag.ContinueOnError)
+	dir := flags.String("dir", ".", "directory to write the migration to")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() != 1 || !migrationName.MatchString(flags.Arg(0)) {
+		return errors.New("A name in snake_case is required, e.g. notes-app migrate create add_tag_owner")
+	}
+
+	path, err := CreateMigration(*dir, flags.Arg(0), time.Now())
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Created %s\n", path)
+
+	return nil
+}
+
+const migrationTemplate = `package main
+
+import "github.com/jinzhu/gorm"
+
+func init() {
+	RegisterMigration(&Migration{
+		Version: "%s",
+		Name:    "%s",
+		Up: func(tx *gorm.DB) error {
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			return nil
+		},
+	})
+}
+`
+
+// CreateMigration writes an empty migration to dir, versioned by now
+func CreateMigration(dir string, name string, now time.Time) (string, error) {
+	version := now.UTC().Format("20060102150405")
+	path := filepath.Join(dir, fmt.Sprintf("migration.%s_%s.go", version, name))
+
+	if err := ioutil.WriteFile(path, []byte(fmt.Sprintf(migrationTemplate, version, name)), 0644); err != nil {
+		return "", err
+	}
+
+	return path, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+func init() {
+	RegisterCommand("tokens", "prune", &Command{"[-batch-size n]", pruneTokensCommand})
+}
+
+func pruneTokensCommand(config *Config, args []string) error {
+	flags := flag.NewFlagSet("tokens prune", flag.ContinueOnError)
+	batchSize := flags.Int("batch-size", config.Tokens.PruneBatchSize, "number of rows to delete per statement")
+
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := OpenDB(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := PruneTokens(db, *batchSize)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Pruned %d tokens\n", n)
+
+	return nil
+}
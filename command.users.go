@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+func init() {
+	RegisterCommand("users", "set-role", &Command{"email role", setUserRoleCommand})
+}
+
+// setUserRoleCommand changes a user's role. It is how the first admin is made, as
+// only admins can change roles through the API.
+func setUserRoleCommand(config *Config, args []string) error {
+	if len(args) != 2 {
+		return errors.New("Expected an email and a role")
+	}
+
+	email, role := args[0], args[1]
+	if _, ok := rolePermissions[role]; !ok {
+		return fmt.Errorf("Role must be one of %s, %s or %s", RoleUser, RoleReadOnly, RoleAdmin)
+	}
+
+	db, err := OpenDB(config.Database)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	repository := NewUserRepository(db)
+
+	user, err := repository.FindByEmail(context.Background(), email)
+	if err != nil {
+		return fmt.Errorf("User %s does not exist", email)
+	}
+
+	if err := repository.SetRole(context.Background(), user, role); err != nil {
+		return err
+	}
+
+	storage := NewGORMStorage(db, config.OAuth2, NewTokenDenylist(db, config.Tokens.DenylistSync), nil)
+	if err := storage.RevokeUserAccess(context.Background(), user); err != nil {
+		return err
+	}
+
+	fmt.Printf("User %s now has the %s role\n", user.Email, role)
+
+	return nil
+}
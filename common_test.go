@@ -9,6 +9,12 @@ import (
 	"github.com/jinzhu/gorm"
 	"fmt"
 	"time"
+	"io/ioutil"
+	"context"
+	"github.com/satori/go.uuid"
+	"net/url"
+	"bytes"
+	"sync"
 )
 
 var app *App
@@ -20,26 +26,115 @@ func TestMain(m *testing.M) {
 }
 
 func initTestApp() {
-	db, err := gorm.Open("sqlite3", "./notes-test.db")
-	db.SingularTable(true)
-
+	db, err := gorm.Open(testAppDatabase())
 	if err != nil {
 		panic("Cannot connect to test database")
 	}
 
-	r := gin.Default()
+	db.SingularTable(true)
+
 	populateDB(db)
 
-	app = &App{
-		r,
+	app = newTestApp(db, NewOAuth2Config())
+}
+
+// testAppDatabase returns the database the test app runs against. This is SQLite,
+// unless NOTES_TEST_DIALECT is set to postgres or mysql to run every test against
+// NOTES_TEST_POSTGRES_DSN or NOTES_TEST_MYSQL_DSN instead.
+func testAppDatabase() (string, string) {
+	switch dialect := os.Getenv("NOTES_TEST_DIALECT"); dialect {
+	case "", "sqlite3":
+		return "sqlite3", "./notes-test.db"
+	case "postgres":
+		return dialect, os.Getenv("NOTES_TEST_POSTGRES_DSN")
+	case "mysql":
+		return dialect, os.Getenv("NOTES_TEST_MYSQL_DSN")
+	default:
+		panic("Unknown test dialect " + dialect)
+	}
+}
+
+func newTestApp(db *gorm.DB, oauth2Config *OAuth2Config) *App {
+	keySet, err := oauth2Config.NewKeySet(db, time.Second)
+	if err != nil {
+		panic("Cannot create signing keys")
+	}
+
+	config := NewConfig()
+	metrics := NewMetrics(db, config.Metrics.CountInterval)
+	db = metrics.InstrumentDB(db)
+
+	denylist := NewTokenDenylist(db, time.Second)
+	config.OAuth2 = oauth2Config
+	config.Metrics.Enabled = true
+	// Tests that need rate limits turn them on with withRateLimit
+	config.RateLimit.Enabled = false
+
+	rateLimiter, _ := NewRateLimiter(config.RateLimit)
+
+	engine := gin.New()
+	engine.Use(NewTracingMiddleware())
+	engine.Use(NewLoggerMiddleware(NewLogger(config.Log, ioutil.Discard)))
+	engine.Use(NewRecoveryMiddleware(NewResponseHandler()))
+	engine.Use(NewMetricsMiddleware(metrics))
+	engine.Use(NewBodyLimitMiddleware(int64(config.Server.MaxBodyBytes), NewResponseHandler()))
+
+	a := &App{
+		engine,
 		db,
 		NewResponseHandler(),
 		NewRequestHandler(),
 		NewValidator(),
-		NewOAuth2Server(db),
+		NewOAuth2Server(db, oauth2Config, keySet, denylist, metrics),
+		NewTokenJanitor(db, time.Hour, 100),
+		keySet,
+		denylist,
+		oauth2Config,
+		NewSessionTracker(db, time.Minute),
+		NewAuditLog(db),
+		config,
+		metrics,
+		func(ctx context.Context) error { return nil },
+		nil,
+		nil,
+		nil,
+		rateLimiter,
+		&testMailer{},
+	}
+
+	InitHandlers(a)
+
+	return a
+}
+
+// testMailer keeps the mail sent by the test app
+type testMailer struct {
+	mu   sync.Mutex
+	sent []*Mail
+}
+
+func (m *testMailer) Send(ctx context.Context, mail *Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, mail)
+
+	return nil
+}
+
+// lastMailTo returns the last mail sent to the address by the test app
+func lastMailTo(to string) *Mail {
+	m := app.Mailer().(*testMailer)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To == to {
+			return m.sent[i]
+		}
 	}
 
-	InitHandlers(app)
+	return nil
 }
 
 func testHTTPResponse(t *testing.T, r *gin.Engine, req *http.Request, f func(w *httptest.ResponseRecorder) bool) {
@@ -51,6 +146,36 @@ func testHTTPResponse(t *testing.T, r *gin.Engine, req *http.Request, f func(w *
 	}
 }
 
+// requestToken posts params to the /token endpoint of a with the client credentials,
+// which are left out when empty. The request can be changed before it is sent with
+// modify, such as to set the client address.
+func requestToken(a *App, clientId string, clientSecret string, params url.Values, modify ...func(req *http.Request)) *httptest.ResponseRecorder {
+	form := url.Values{}
+	for key, values := range params {
+		form[key] = values
+	}
+
+	if clientId != "" {
+		form.Set("client_id", clientId)
+	}
+
+	if clientSecret != "" {
+		form.Set("client_secret", clientSecret)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, "/token", bytes.NewBufferString(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+
+	for _, f := range modify {
+		f(req)
+	}
+
+	w := httptest.NewRecorder()
+	a.Engine().ServeHTTP(w, req)
+
+	return w
+}
+
 func populateDB(db *gorm.DB) {
 	dropSchema(db)
 	createSchema(db)
@@ -63,32 +188,39 @@ func populateDB(db *gorm.DB) {
 }
 
 func dropSchema(db *gorm.DB) {
-	db.DropTable(
+	db.DropTableIfExists(
 		&Note{},
 		&Tag{},
 		&OAuth2Client{},
 		&OAuth2AccessToken{},
 		&OAuth2RefreshToken{},
+		&OAuth2RevokedToken{},
+		&OAuth2SigningKey{},
+		&PersonalAccessToken{},
+		&UserRecoveryCode{},
+		&MFAChallenge{},
+		&LoginAttempt{},
+		&AuditEvent{},
+		&Workspace{},
+		&WorkspaceMember{},
+		&WorkspaceInvitation{},
 		&User{},
+		&SchemaMigration{},
+		&SchemaMigrationLock{},
 		// many to many relationships
 		"note_tags",
 	)
 }
 
 func createSchema(db *gorm.DB) {
-	db.AutoMigrate(
-		&Note{},
-		&Tag{},
-		&OAuth2Client{},
-		&OAuth2AccessToken{},
-		&OAuth2RefreshToken{},
-		&User{},
-	)
+	if _, err := NewMigrator(db).Up(0); err != nil {
+		panic(err)
+	}
 }
 
 func createTags(db *gorm.DB, count int) {
 	for i := 1; i < count+1; i++ {
-		db.Create(&Tag{Name: fmt.Sprintf("Tag %d", i)})
+		db.Create(&Tag{Name: fmt.Sprintf("Tag %d", i), CreatedById: 1})
 	}
 }
 
@@ -105,13 +237,14 @@ func createNotes(db *gorm.DB, count int) {
 }
 
 func createUsers(db *gorm.DB) {
-	db.Create(&User{Email: "test@go-notes.com", Firstname: "Go", Lastname: "Notes", Password: "$2a$12$RFgkr30MuLQmPU5LNrVNZ.gev80MwIZRwTcTUfZBmf19vegxQq9CS"})
+	db.Create(&User{Email: "test@go-notes.com", Firstname: "Go", Lastname: "Notes", Role: RoleAdmin, Password: "$2a$12$RFgkr30MuLQmPU5LNrVNZ.gev80MwIZRwTcTUfZBmf19vegxQq9CS"})
 	db.Create(&User{Email: "test2@go-notes.com", Firstname: "Go2", Lastname: "Notes2", Password: "$2a$12$RFgkr30MuLQmPU5LNrVNZ.gev80MwIZRwTcTUfZBmf19vegxQq9CS"})
 	db.Create(&User{Email: "test3@go-notes.com", Firstname: "Go3", Lastname: "Notes3", Password: "$2a$12$RFgkr30MuLQmPU5LNrVNZ.gev80MwIZRwTcTUfZBmf19vegxQq9CS"})
 }
 
 func createOAuth2Clients(db *gorm.DB) {
 	notesClient := new(OAuth2Client)
+	notesClient.Name = "Go Notes"
 	notesClient.RedirectURI = "http://www.go-notes.com/callback"
 	notesClient.Secret = "$2a$12$UIvK0nN/7fvwT0PV/zaSc.vf.b7b0ItknYSjjNILapftiCbhxTDGm"
 	notesClient.Extra = "User data..."
@@ -119,6 +252,16 @@ func createOAuth2Clients(db *gorm.DB) {
 	db.Create(notesClient)
 }
 
+// createAccessToken issues an OAuth2 access token to a user, for routes that refuse
+// personal access tokens
+func createAccessToken(userId uint) string {
+	token := &OAuth2AccessToken{AccessToken: uuid.NewV4().String(), Scope: "email", Expires: time.Now().Add(time.Hour), ClientId: 1, UserId: userId}
+	app.Db().Create(token)
+	app.Db().Create(&OAuth2RefreshToken{RefreshToken: uuid.NewV4().String(), Scope: "email", Expires: time.Now().Add(time.Hour), ClientId: 1, UserId: userId, AccessTokenId: token.ID})
+
+	return token.AccessToken
+}
+
 func createOAuthAccessTokens(db *gorm.DB) {
 	// +1 hour
 	expiry := time.Now().Local().Add(time.Hour)
@@ -129,6 +272,6 @@ func createOAuthAccessTokens(db *gorm.DB) {
 func createOAuthRefreshTokens(db *gorm.DB) {
 	// +31 days
 	expiry := time.Now().Local().Add(time.Hour * 24 * 31)
-	db.Create(&OAuth2RefreshToken{RefreshToken: "refresh-token", Scope: "email", Expires: expiry, UserId: 1, ClientId: 1, AccessTokenId: 1})
-	db.Create(&OAuth2RefreshToken{RefreshToken: "N2U3MTdmYjgtMzJhNi00MTE4LThjODMtYzQzM2RlZTBjZGFm", Scope: "email", Expires: expiry, UserId: 3, ClientId: 1, AccessTokenId: 2})
+	db.Create(&OAuth2RefreshToken{RefreshToken: "refresh-token", Family: "family-1", Scope: "email", Expires: expiry, UserId: 1, ClientId: 1, AccessTokenId: 1})
+	db.Create(&OAuth2RefreshToken{RefreshToken: "N2U3MTdmYjgtMzJhNi00MTE4LThjODMtYzQzM2RlZTBjZGFm", Family: "family-2", Scope: "email", Expires: expiry, UserId: 3, ClientId: 1, AccessTokenId: 2})
 }
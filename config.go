@@ -0,0 +1,427 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/gin-contrib/cors"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is read from, in increasing order of precedence, the defaults below, a YAML
+// file, NOTES_* environment variables and command-line flags. Every setting has an
+// environment variable and a flag named after its path in the file, e.g.
+// database.dsn is NOTES_DATABASE_DSN and -database.dsn.
+type Config struct {
+	Server        ServerConfig        `yaml:"server"`
+	Database      DatabaseConfig      `yaml:"database"`
+	OAuth2        *OAuth2Config       `yaml:"oauth2"`
+	Tokens        TokensConfig        `yaml:"tokens"`
+	Health        HealthConfig        `yaml:"health"`
+	Metrics       MetricsConfig       `yaml:"metrics"`
+	Log           LogConfig           `yaml:"log"`
+	Tracing       TracingConfig       `yaml:"tracing"`
+	RateLimit     RateLimitConfig     `yaml:"rate_limit"`
+	LoginThrottle LoginThrottleConfig `yaml:"login_throttle"`
+	Pagination    PaginationConfig    `yaml:"pagination"`
+	Mail          MailConfig          `yaml:"mail"`
+}
+
+type ServerConfig struct {
+	// Address the API listens on
+	Addr string `yaml:"addr" validate:"required"`
+	// Origins allowed to make cross-origin requests, * for any
+	CORSOrigins []string `yaml:"cors_origins"`
+	// Limits on how long a request may take to read and its response to write, and
+	// on how long an idle keep-alive connection is kept open. 0 for none.
+	ReadTimeout       time.Duration `yaml:"read_timeout" validate:"min=0"`
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout" validate:"min=0"`
+	WriteTimeout      time.Duration `yaml:"write_timeout" validate:"min=0"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout" validate:"min=0"`
+	MaxHeaderBytes    int           `yaml:"max_header_bytes" validate:"min=0"`
+	// Larger request bodies are refused, 0 for no limit
+	MaxBodyBytes int `yaml:"max_body_bytes" validate:"min=0"`
+	// How long in-flight requests are given to finish on SIGINT or SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" validate:"min=0"`
+	TLS             TLSConfig     `yaml:"tls"`
+}
+
+type TLSConfig struct {
+	// Serve HTTPS with the certificate and key in these PEM files instead of HTTP
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file" validate:"required_with=CertFile"`
+	// How often the files are checked for a new certificate. It is also reloaded on
+	// SIGHUP.
+	ReloadInterval time.Duration `yaml:"reload_interval" validate:"min=1"`
+	// CA certificates, in a PEM file, that client certificates are verified against
+	ClientCAFile string `yaml:"client_ca_file"`
+	// Whether a client certificate is optional or required when client_ca_file is set
+	ClientAuth string `yaml:"client_auth" validate:"oneof=optional require"`
+}
+
+// Enabled reports whether the server is to serve HTTPS
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != ""
+}
+
+// CORS returns the cross-origin policy for the configured origins
+func (c ServerConfig) CORS() cors.Config {
+	config := cors.DefaultConfig()
+	config.ExposeHeaders = []string{RequestIdHeader, "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"}
+
+	for _, origin := range c.CORSOrigins {
+		if origin == "*" {
+			config.AllowAllOrigins = true
+			return config
+		}
+	}
+
+	config.AllowOrigins = c.CORSOrigins
+
+	return config
+}
+
+type DatabaseConfig struct {
+	// One of sqlite3, postgres or mysql. MySQL DSNs need parseTime=true.
+	Driver string `yaml:"driver" validate:"oneof=sqlite3 postgres mysql"`
+	DSN    string `yaml:"dsn" validate:"required"`
+	// Queries slower than this are logged, without their bound values, 0 for none
+	SlowQuery time.Duration `yaml:"slow_query" validate:"min=0"`
+	// Apply pending migrations on start
+	Migrate bool `yaml:"migrate"`
+}
+
+type TokensConfig struct {
+	// How often expired tokens are purged in the background
+	PruneInterval  time.Duration `yaml:"prune_interval" validate:"min=1"`
+	PruneBatchSize int           `yaml:"prune_batch_size" validate:"min=1"`
+	// How often revoked JWTs are reloaded from the database
+	DenylistSync time.Duration `yaml:"denylist_sync" validate:"min=1"`
+	// How often signing keys are reloaded from the database, to pick up keys rotated
+	// by other instances
+	KeySync time.Duration `yaml:"key_sync" validate:"min=1"`
+	// How often the last use of an access token or personal access token is written to
+	// the database
+	SessionActivity time.Duration `yaml:"session_activity" validate:"min=1"`
+}
+
+type HealthConfig struct {
+	// How long /readyz waits for its checks
+	Timeout time.Duration `yaml:"timeout" validate:"min=1"`
+	// Free space below which a SQLite database's disk is reported as not ready
+	MinFreeDiskMB int `yaml:"min_free_disk_mb" validate:"min=0"`
+}
+
+type MetricsConfig struct {
+	// Serve Prometheus metrics, without authentication, at Path
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path" validate:"required_if=Enabled true"`
+	// How long the stored notes and tags are counted for before counting them again
+	CountInterval time.Duration `yaml:"count_interval" validate:"min=1"`
+}
+
+type LogConfig struct {
+	// debug, info, warn or error. Every query is logged at debug.
+	Level string `yaml:"level" validate:"oneof=debug info warn error"`
+	// json, or text for logfmt
+	Format string `yaml:"format" validate:"oneof=json text"`
+}
+
+type TracingConfig struct {
+	// Export spans over OTLP/HTTP to Endpoint
+	Enabled  bool   `yaml:"enabled"`
+	Endpoint string `yaml:"endpoint" validate:"required_if=Enabled true,omitempty,url"`
+	// Name the spans are reported under
+	ServiceName string `yaml:"service_name" validate:"required"`
+	// Share of traces recorded, unless the caller's trace context says otherwise
+	SampleRatio float64 `yaml:"sample_ratio" validate:"min=0,max=1"`
+}
+
+type RateLimitConfig struct {
+	// Limit requests per user, OAuth2 client or IP address
+	Enabled bool `yaml:"enabled"`
+	// memory, or redis to share the limits between instances
+	Store    string `yaml:"store" validate:"oneof=memory redis"`
+	RedisURL string `yaml:"redis_url" validate:"required_if=Store redis,omitempty,url"`
+	// Budgets for reads, for writes and for /token
+	Read  RateLimit `yaml:"read"`
+	Write RateLimit `yaml:"write"`
+	Token RateLimit `yaml:"token"`
+}
+
+type LoginThrottleConfig struct {
+	// How failed logins are slowed down and locked out per username, and per address,
+	// which is more lenient as many users may share one
+	Username ThrottlePolicy `yaml:"username"`
+	IP       ThrottlePolicy `yaml:"ip"`
+}
+
+type PaginationConfig struct {
+	// Page size of lists when per_page is not given, and the largest allowed
+	DefaultPerPage int `yaml:"default_per_page" validate:"min=1,ltefield=MaxPerPage"`
+	MaxPerPage     int `yaml:"max_per_page" validate:"min=1"`
+}
+
+type MailConfig struct {
+	// log writes mail to the log instead of sending it, for development. smtp sends it
+	// through the server at Addr, as host:port.
+	Driver   string `yaml:"driver" validate:"oneof=log smtp"`
+	Addr     string `yaml:"addr" validate:"required_if=Driver smtp"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from" validate:"required,email"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:              ":8080",
+			CORSOrigins:       []string{"*"},
+			ReadTimeout:       15 * time.Second,
+			ReadHeaderTimeout: 5 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			MaxHeaderBytes:    1 << 20,
+			MaxBodyBytes:      1 << 20,
+			ShutdownTimeout:   30 * time.Second,
+			TLS: TLSConfig{
+				ReloadInterval: 10 * time.Second,
+				ClientAuth:     ClientAuthOptional,
+			},
+		},
+		Database: DatabaseConfig{
+			Driver:    "sqlite3",
+			DSN:       "./notes.db",
+			SlowQuery: 200 * time.Millisecond,
+			Migrate:   true,
+		},
+		OAuth2: NewOAuth2Config(),
+		Tokens: TokensConfig{
+			PruneInterval:   time.Hour,
+			PruneBatchSize:  1000,
+			DenylistSync:    30 * time.Second,
+			KeySync:         time.Minute,
+			SessionActivity: time.Minute,
+		},
+		Health: HealthConfig{
+			Timeout:       2 * time.Second,
+			MinFreeDiskMB: 100,
+		},
+		Metrics: MetricsConfig{
+			Path:          "/metrics",
+			CountInterval: time.Minute,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		Tracing: TracingConfig{
+			Endpoint:    "http://localhost:4318/v1/traces",
+			ServiceName: "notes-app",
+			SampleRatio: 1,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled:  true,
+			Store:    RateLimitStoreMemory,
+			RedisURL: "redis://localhost:6379/0",
+			Read:     RateLimit{Requests: 300, Period: time.Minute},
+			Write:    RateLimit{Requests: 60, Period: time.Minute},
+			Token:    RateLimit{Requests: 120, Period: time.Minute},
+		},
+		LoginThrottle: LoginThrottleConfig{
+			Username: ThrottlePolicy{
+				FreeAttempts:     5,
+				BaseDelay:        time.Second,
+				MaxDelay:         time.Minute,
+				LockoutThreshold: 10,
+				LockoutDuration:  15 * time.Minute,
+				ResetAfter:       time.Hour,
+			},
+			IP: ThrottlePolicy{
+				FreeAttempts:     20,
+				BaseDelay:        time.Second,
+				MaxDelay:         time.Minute,
+				LockoutThreshold: 100,
+				LockoutDuration:  15 * time.Minute,
+				ResetAfter:       time.Hour,
+			},
+		},
+		Pagination: PaginationConfig{
+			DefaultPerPage: 10,
+			MaxPerPage:     100,
+		},
+		Mail: MailConfig{
+			Driver: MailDriverLog,
+			From:   "notes@example.com",
+		},
+	}
+}
+
+// LoadConfig reads the configuration from the file named by -config or NOTES_CONFIG,
+// the environment and the flags at the start of args. The arguments after the flags
+// are returned.
+func LoadConfig(args []string) (*Config, []string, error) {
+	config := NewConfig()
+	options := config.options()
+
+	flags := flag.NewFlagSet("notes-app", flag.ContinueOnError)
+	path := flags.String("config", os.Getenv("NOTES_CONFIG"), "path of a YAML config file")
+
+	set := map[string]string{}
+	for _, o := range options {
+		flags.Var(&configFlag{o, set}, o.key, o.usage)
+	}
+
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	if *path != "" {
+		if err := config.readFile(*path); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, o := range options {
+		if value, ok := os.LookupEnv(o.env()); ok {
+			if err := o.set(value); err != nil {
+				return nil, nil, fmt.Errorf("Invalid %s: %s", o.env(), err)
+			}
+		}
+
+		if value, ok := set[o.key]; ok {
+			if err := o.set(value); err != nil {
+				return nil, nil, fmt.Errorf("Invalid -%s: %s", o.key, err)
+			}
+		}
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, nil, err
+	}
+
+	return config, flags.Args(), nil
+}
+
+func (c *Config) readFile(path string) error {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if err := yaml.Unmarshal(contents, c); err != nil {
+		return fmt.Errorf("Invalid config file %s: %s", path, err)
+	}
+
+	return nil
+}
+
+func (c *Config) Validate() error {
+	if err := NewValidator().Struct(c); err != nil {
+		return fmt.Errorf("Invalid configuration: %s", err)
+	}
+
+	return nil
+}
+
+// configOption is a setting that can be given in the environment or as a flag
+type configOption struct {
+	key   string
+	usage string
+	value reflect.Value
+}
+
+// options lists the settings of c, keyed by their path in the config file
+func (c *Config) options() []*configOption {
+	return collectOptions("", reflect.ValueOf(c).Elem())
+}
+
+func collectOptions(prefix string, v reflect.Value) []*configOption {
+	var options []*configOption
+
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		key := prefix + field.Tag.Get("yaml")
+		value := v.Field(i)
+
+		if value.Kind() == reflect.Ptr {
+			value = value.Elem()
+		}
+
+		if value.Kind() == reflect.Struct {
+			options = append(options, collectOptions(key+".", value)...)
+			continue
+		}
+
+		options = append(options, &configOption{key, fmt.Sprintf("%s (default %v)", key, value.Interface()), value})
+	}
+
+	return options
+}
+
+func (o *configOption) env() string {
+	return "NOTES_" + strings.ToUpper(strings.Replace(o.key, ".", "_", -1))
+}
+
+func (o *configOption) set(s string) error {
+	switch o.value.Interface().(type) {
+	case string:
+		o.value.SetString(s)
+	case bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		o.value.SetBool(b)
+	case time.Duration:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		o.value.SetInt(int64(d))
+	case float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		o.value.SetFloat(f)
+	case int, int32:
+		n, err := strconv.ParseInt(s, 10, o.value.Type().Bits())
+		if err != nil {
+			return err
+		}
+		o.value.SetInt(n)
+	case []string:
+		o.value.Set(reflect.ValueOf(strings.Split(s, ",")))
+	default:
+		return fmt.Errorf("Unsupported setting type %s", o.value.Type())
+	}
+
+	return nil
+}
+
+// configFlag holds a flag's value until the file and environment have been read, so
+// that flags take precedence over both
+type configFlag struct {
+	option *configOption
+	set    map[string]string
+}
+
+func (f *configFlag) String() string {
+	return ""
+}
+
+func (f *configFlag) IsBoolFlag() bool {
+	return f.option.value.Kind() == reflect.Bool
+}
+
+func (f *configFlag) Set(s string) error {
+	f.set[f.option.key] = s
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	f, err := ioutil.TempFile("", "notes-config")
+	if err != nil {
+		t.Fatalf("Could not create config file: '%s'", err.Error())
+	}
+	defer f.Close()
+
+	f.WriteString(contents)
+
+	return f.Name()
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	config, args, err := LoadConfig([]string{"tokens", "prune"})
+	if err != nil {
+		t.Errorf("Expected no error, got '%s'", err.Error())
+		return
+	}
+
+	if config.Server.Addr != ":8080" || config.Database.DSN != "./notes.db" || config.OAuth2.AccessExpiration != 3600 {
+		t.Errorf("Unexpected defaults '%+v'", config)
+	}
+
+	if config.LoginThrottle.Username.LockoutThreshold != 10 || config.LoginThrottle.IP.FreeAttempts != 20 {
+		t.Errorf("Unexpected login throttle defaults '%+v'", config.LoginThrottle)
+	}
+
+	if config.Metrics.Enabled {
+		t.Error("Expected metrics to be served only when enabled")
+	}
+
+	if len(args) != 2 || args[0] != "tokens" {
+		t.Errorf("Expected the command to be returned, got '%v'", args)
+	}
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  addr: ":9000"
+  cors_origins: ["https://notes.example.com"]
+database:
+  dsn: /var/lib/notes/file.db
+  slow_query: 1s
+oauth2:
+  access_expiration: 600
+  issuer: https://notes.example.com
+tokens:
+  prune_interval: 10m
+`)
+	defer os.Remove(path)
+
+	os.Setenv("NOTES_DATABASE_DSN", "/var/lib/notes/env.db")
+	os.Setenv("NOTES_OAUTH2_ACCESS_EXPIRATION", "900")
+	defer os.Unsetenv("NOTES_DATABASE_DSN")
+	defer os.Unsetenv("NOTES_OAUTH2_ACCESS_EXPIRATION")
+
+	config, _, err := LoadConfig([]string{"-config", path, "-oauth2.access_expiration", "1200"})
+	if err != nil {
+		t.Errorf("Expected no error, got '%s'", err.Error())
+		return
+	}
+
+	if config.Server.Addr != ":9000" || config.Server.CORSOrigins[0] != "https://notes.example.com" {
+		t.Errorf("Expected server settings from the file, got '%+v'", config.Server)
+	}
+
+	if config.Database.DSN != "/var/lib/notes/env.db" || config.Database.SlowQuery != time.Second {
+		t.Errorf("Expected the environment to override the file, got '%+v'", config.Database)
+	}
+
+	if config.OAuth2.AccessExpiration != 1200 || config.OAuth2.Issuer != "https://notes.example.com" {
+		t.Errorf("Expected flags to override the environment, got '%+v'", config.OAuth2)
+	}
+
+	if config.Tokens.PruneInterval != 10*time.Minute || config.Tokens.PruneBatchSize != 1000 {
+		t.Errorf("Expected unset settings to keep their defaults, got '%+v'", config.Tokens)
+	}
+}
+
+func TestLoadConfig_Validation(t *testing.T) {
+	if _, _, err := LoadConfig([]string{"-oauth2.access_token_format", "paseto"}); err == nil {
+		t.Error("Expected an unknown token format to be rejected")
+	}
+
+	if _, _, err := LoadConfig([]string{"-tokens.prune_interval", "often"}); err == nil {
+		t.Error("Expected an invalid duration to be rejected")
+	}
+
+	if _, _, err := LoadConfig([]string{"-login_throttle.username.lockout_threshold", "3"}); err == nil {
+		t.Error("Expected a lockout before the free attempts are used up to be rejected")
+	}
+
+	// Settings of features that are turned off may be left out
+	disabled := []string{"-rate_limit.store", "memory", "-rate_limit.redis_url", "", "-tracing.endpoint", "", "-mail.addr", ""}
+	if _, _, err := LoadConfig(disabled); err != nil {
+		t.Errorf("Expected settings of disabled features to be optional, got '%s'", err.Error())
+	}
+
+	if _, _, err := LoadConfig([]string{"-rate_limit.store", "redis", "-rate_limit.redis_url", ""}); err == nil {
+		t.Error("Expected a Redis store without a URL to be rejected")
+	}
+
+	if _, _, err := LoadConfig([]string{"-tracing.enabled=true", "-tracing.endpoint", ""}); err == nil {
+		t.Error("Expected tracing without an endpoint to be rejected")
+	}
+
+	if _, _, err := LoadConfig([]string{"-mail.driver", "smtp"}); err == nil {
+		t.Error("Expected SMTP mail without a server address to be rejected")
+	}
+}
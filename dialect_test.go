@@ -0,0 +1,171 @@
+package main
+
+import (
+	"testing"
+	"context"
+	"github.com/jinzhu/gorm"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// testDialects returns a DSN for each database the repository tests can run against.
+// PostgreSQL and MySQL are only available when NOTES_TEST_POSTGRES_DSN or
+// NOTES_TEST_MYSQL_DSN is set, or, for PostgreSQL, when initdb and pg_ctl are on the
+// path to start a throwaway server with.
+func testDialects(t *testing.T) map[string]string {
+	dialects := map[string]string{
+		"sqlite3": "./notes-dialect-test.db",
+	}
+
+	if dsn := os.Getenv("NOTES_TEST_POSTGRES_DSN"); dsn != "" {
+		dialects["postgres"] = dsn
+	} else if dsn := startTestPostgres(t); dsn != "" {
+		dialects["postgres"] = dsn
+	}
+
+	if dsn := os.Getenv("NOTES_TEST_MYSQL_DSN"); dsn != "" {
+		dialects["mysql"] = dsn
+	}
+
+	return dialects
+}
+
+// startTestPostgres starts a PostgreSQL server in a temporary directory, listening on
+// a Unix socket only, and stops it when the test finishes
+func startTestPostgres(t *testing.T) string {
+	if _, err := exec.LookPath("initdb"); err != nil {
+		return ""
+	}
+
+	if _, err := exec.LookPath("pg_ctl"); err != nil {
+		return ""
+	}
+
+	dir, err := ioutil.TempDir("", "notes-postgres")
+	if err != nil {
+		return ""
+	}
+
+	data := filepath.Join(dir, "data")
+	if err := exec.Command("initdb", "-D", data, "-U", "postgres", "--auth=trust").Run(); err != nil {
+		os.RemoveAll(dir)
+		return ""
+	}
+
+	options := "-c listen_addresses='' -k " + dir
+	if err := exec.Command("pg_ctl", "-D", data, "-o", options, "-w", "start").Run(); err != nil {
+		os.RemoveAll(dir)
+		return ""
+	}
+
+	t.Cleanup(func() {
+		exec.Command("pg_ctl", "-D", data, "-m", "immediate", "stop").Run()
+		os.RemoveAll(dir)
+	})
+
+	return "host=" + dir + " user=postgres dbname=postgres sslmode=disable"
+}
+
+// forEachDialect runs f against a fresh schema on every available database
+func forEachDialect(t *testing.T, f func(t *testing.T, db *gorm.DB)) {
+	for dialect, dsn := range testDialects(t) {
+		t.Run(dialect, func(t *testing.T) {
+			db, err := OpenDB(DatabaseConfig{Driver: dialect, DSN: dsn})
+			if err != nil {
+				t.Skipf("Cannot connect to %s: %s", dialect, err)
+			}
+			defer db.Close()
+
+			db.LogMode(false)
+			dropSchema(db)
+			createSchema(db)
+
+			if dialect == "sqlite3" {
+				defer os.Remove(dsn)
+			}
+
+			f(t, db)
+		})
+	}
+}
+
+func TestDialect_NotesAndTags(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *gorm.DB) {
+		tag, err := NewTagRepository(db).Create(context.Background(), &Tag{Name: "portable"})
+		if err != nil {
+			t.Fatalf("Could not create tag: '%s'", err.Error())
+		}
+
+		text := strings.Repeat("A long note. ", 100)
+		note, err := NewNoteRepository(db).Create(context.Background(), &Note{Title: "Portable", Text: text, Tags: []*Tag{tag}})
+		if err != nil {
+			t.Fatalf("Could not create note: '%s'", err.Error())
+		}
+
+		found, err := NewNoteRepository(db).FindById(context.Background(), int(note.ID))
+		if err != nil || found.Text != text || len(found.Tags) != 1 {
+			t.Errorf("Expected the note to be stored in full with its tag")
+		}
+
+		if err := NewTagRepository(db).Delete(context.Background(), tag); err != nil {
+			t.Errorf("Could not delete tag: '%s'", err.Error())
+		}
+
+		found, _ = NewNoteRepository(db).FindById(context.Background(), int(note.ID))
+		if len(found.Tags) != 0 {
+			t.Errorf("Expected deleting the tag to unlink it, got '%d' tags", len(found.Tags))
+		}
+	})
+}
+
+func TestDialect_UserDeleteAndTokenPrune(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *gorm.DB) {
+		user := &User{Email: "dialect@go-notes.com"}
+		db.Create(user)
+		db.Create(&Note{Title: "Owned", CreatedById: user.ID})
+
+		// Self-contained tokens are longer than a default string column
+		token := strings.Repeat("t", 1500)
+		db.Create(&OAuth2AccessToken{AccessToken: token, UserId: user.ID, Expires: time.Now().Add(time.Hour)})
+
+		storage := NewGORMStorage(db, NewOAuth2Config(), NewTokenDenylist(db, time.Second), nil)
+		if err := storage.RemoveAccess(context.Background(), token); err != nil {
+			t.Errorf("Could not remove access token: '%s'", err.Error())
+		}
+
+		if err := NewUserRepository(db).Delete(context.Background(), user); err != nil {
+			t.Fatalf("Could not delete user: '%s'", err.Error())
+		}
+
+		count := 0
+		db.Model(&Note{}).Where("created_by = ?", user.ID).Count(&count)
+		if count != 0 {
+			t.Errorf("Expected the user's notes to be deleted, got '%d'", count)
+		}
+
+		if _, err := PruneTokens(db, 10); err != nil {
+			t.Errorf("Could not prune tokens: '%s'", err.Error())
+		}
+	})
+}
+
+func TestDialect_AuditChain(t *testing.T) {
+	forEachDialect(t, func(t *testing.T, db *gorm.DB) {
+		auditLog := NewAuditLog(db)
+
+		for _, action := range []string{AuditNoteCreated, AuditNoteUpdated} {
+			if err := auditLog.Record(&AuditEvent{Action: action, Target: "note:1"}); err != nil {
+				t.Fatalf("Could not record event: '%s'", err.Error())
+			}
+		}
+
+		result, err := auditLog.Verify()
+		if err != nil || !result.Valid || result.Checked != 2 {
+			t.Errorf("Expected a valid chain of 2 events, got '%+v'", result)
+		}
+	})
+}
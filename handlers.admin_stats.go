@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"net/http"
+)
+
+type AdminStatsHandler struct {
+	db              *gorm.DB
+	responseHandler ResponseHandler
+}
+
+func InitAdminStatsHandler(app *App) *AdminStatsHandler {
+	h := &AdminStatsHandler{
+		app.Db(),
+		app.ResponseHandler(),
+	}
+
+	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	canRead := NewPermissionMiddleware(app, PermissionStatsRead)
+
+	app.Engine().GET("/v1/admin/stats", authMiddleware, rateLimit, canRead, h.Stats)
+
+	return h
+}
+
+func (h *AdminStatsHandler) Stats(c *gin.Context) {
+	stats, err := CollectStats(h.db)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, stats)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type AdminUsersHandler struct {
+	userRepository  UserRepository
+	storage         *GORMStorage
+	auditLog        *AuditLog
+	responseHandler ResponseHandler
+	requestHandler  RequestHandler
+	validator       *validator.Validate
+	pagination      PaginationConfig
+}
+
+func InitAdminUsersHandler(app *App) *AdminUsersHandler {
+	h := &AdminUsersHandler{
+		NewUserRepository(app.Db()),
+		oauth2Storage(app.OAuth2Server()),
+		app.AuditLog(),
+		app.ResponseHandler(),
+		app.RequestHandler(),
+		app.Validator(),
+		app.Config().Pagination,
+	}
+
+	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	canManage := NewPermissionMiddleware(app, PermissionUsersManage)
+
+	admin := app.Engine().Group("/v1/admin", authMiddleware, rateLimit, canManage)
+	{
+		admin.GET("/users", h.List)
+		admin.GET("/users/:id", h.Get)
+		admin.PATCH("/users/:id", h.Update)
+		admin.POST("/users/:id/disable", h.Disable)
+		admin.POST("/users/:id/enable", h.Enable)
+		admin.POST("/users/:id/force-password-reset", h.ForcePasswordReset)
+		admin.DELETE("/users/:id", h.Delete)
+	}
+
+	return h
+}
+
+func (h *AdminUsersHandler) List(c *gin.Context) {
+	page, ok := readPagination(c, h.pagination, h.responseHandler)
+	if !ok {
+		return
+	}
+
+	users, err := h.userRepository.FindAll(c.Request.Context(), page)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.JSONPage(c, users, page)
+}
+
+func (h *AdminUsersHandler) Get(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, user)
+}
+
+// Update changes a user's role, which is the only field admins may edit. The user's
+// access tokens are revoked, as self-contained ones carry the old role.
+func (h *AdminUsersHandler) Update(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	data := struct {
+		Role string `json:"role" validate:"required,oneof=user admin read-only"`
+	}{}
+
+	if err := c.BindJSON(&data); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(data); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	if h.isSelf(c, user) {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "You cannot change your own role")
+		return
+	}
+
+	before := *user
+	if err := h.userRepository.SetRole(c.Request.Context(), user, data.Role); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	if err := h.storage.RevokeUserAccess(c.Request.Context(), user); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	user.Role = data.Role
+	h.auditLog.Log(c, AuditUserRoleChanged, auditTarget("user", user.ID), &before, user)
+	h.responseHandler.JSON(c, http.StatusOK, user)
+}
+
+// Disable stops the user logging in and revokes their tokens. Personal access tokens
+// are kept, but are rejected while the user is disabled.
+func (h *AdminUsersHandler) Disable(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	if h.isSelf(c, user) {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "You cannot disable your own account")
+		return
+	}
+
+	before := *user
+	if err := h.userRepository.Disable(c.Request.Context(), user); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	if err := h.storage.RevokeUser(c.Request.Context(), user); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditUserDisabled, auditTarget("user", user.ID), &before, user)
+	h.responseHandler.JSON(c, http.StatusOK, user)
+}
+
+func (h *AdminUsersHandler) Enable(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	before := *user
+	if err := h.userRepository.Enable(c.Request.Context(), user); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	user.DisabledAt = nil
+
+	h.auditLog.Log(c, AuditUserEnabled, auditTarget("user", user.ID), &before, user)
+	h.responseHandler.JSON(c, http.StatusOK, user)
+}
+
+// ForcePasswordReset signs the user out everywhere. Their next password login has to
+// set a new password.
+func (h *AdminUsersHandler) ForcePasswordReset(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	before := *user
+	if err := h.userRepository.ForcePasswordReset(c.Request.Context(), user); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	if err := h.storage.RevokeUser(c.Request.Context(), user); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	user.ForcePasswordReset = true
+	h.auditLog.Log(c, AuditUserPasswordResetForced, auditTarget("user", user.ID), &before, user)
+	h.responseHandler.JSON(c, http.StatusOK, user)
+}
+
+func (h *AdminUsersHandler) Delete(c *gin.Context) {
+	user, ok := h.findUser(c)
+	if !ok {
+		return
+	}
+
+	if h.isSelf(c, user) {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "You cannot delete your own account")
+		return
+	}
+
+	// Checked before the tokens are revoked, though Delete checks again
+	last, err := h.userRepository.IsLastWorkspaceOwner(c.Request.Context(), user)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	if last {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, ErrLastWorkspaceOwner.Error())
+		return
+	}
+
+	if err := h.storage.RevokeUser(c.Request.Context(), user); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	err = h.userRepository.Delete(c.Request.Context(), user)
+	if err == ErrLastWorkspaceOwner {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditUserDeleted, auditTarget("user", user.ID), user, nil)
+	h.responseHandler.JSON(c, http.StatusNoContent, "")
+}
+
+func (h *AdminUsersHandler) findUser(c *gin.Context) (*User, bool) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	user, err := h.userRepository.FindById(c.Request.Context(), id)
+	if err != nil {
+		h.responseHandler.NotFound(c)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (h *AdminUsersHandler) isSelf(c *gin.Context, user *User) bool {
+	admin, err := h.requestHandler.GetUser(c)
+
+	return err == nil && admin.ID == user.ID
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"testing"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"encoding/json"
+	"fmt"
+	"bytes"
+)
+
+func createTestUser(t *testing.T, email string, role string) *User {
+	user := &User{
+		Email:    email,
+		Role:     role,
+		Password: "$2a$12$RFgkr30MuLQmPU5LNrVNZ.gev80MwIZRwTcTUfZBmf19vegxQq9CS",
+	}
+
+	if err := app.Db().Create(user).Error; err != nil {
+		t.Errorf("Could not create user: '%s'", err.Error())
+	}
+
+	return user
+}
+
+func passwordGrant(email string, password string) *httptest.ResponseRecorder {
+	return requestToken(app, "1", "secret", url.Values{
+		"grant_type": {"password"},
+		"username":   {email},
+		"password":   {password},
+	})
+}
+
+func bearerRequest(method string, path string, token string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w := httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+
+	return w
+}
+
+func TestPermissionMiddleware_ReadOnlyRole(t *testing.T) {
+	user := createTestUser(t, "read-only@go-notes.com", RoleReadOnly)
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "read only", UserId: user.ID})
+
+	if w := bearerRequest(http.MethodGet, "/v1/notes", pat, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	if w := bearerRequest(http.MethodPost, "/v1/notes", pat, `{"title": "Read only"}`); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code 403, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestAdminUsersHandler_RequiresAdmin(t *testing.T) {
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "not admin", UserId: 2})
+
+	if w := bearerRequest(http.MethodGet, "/v1/admin/users", pat, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code 403, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestAdminUsersHandler_List(t *testing.T) {
+	w := adminRequest(http.MethodGet, "/v1/admin/users?per_page=1&page=2", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	data := struct {
+		Data []*User                `json:"data"`
+		Meta map[string]interface{} `json:"meta"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	if len(data.Data) != 1 || data.Data[0].ID != 2 || data.Meta["page"] != float64(2) || data.Meta["per_page"] != float64(1) {
+		t.Errorf("Expected the second user on page 2, got '%s'", w.Body.String())
+		return
+	}
+
+	if w.Header().Get("Link") == "" {
+		t.Error("Expected a Link header")
+		return
+	}
+
+	if w := adminRequest(http.MethodGet, "/v1/admin/users?page=first", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code 422 for an invalid page, got '%d'", w.Code)
+	}
+}
+
+func TestAdminUsersHandler_DisableAndEnable(t *testing.T) {
+	user := createTestUser(t, "disable@go-notes.com", RoleUser)
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "disable", UserId: user.ID})
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	json.Unmarshal(passwordGrant(user.Email, "password").Body.Bytes(), &token)
+
+	if w := adminRequest(http.MethodPost, fmt.Sprintf("/v1/admin/users/%d/disable", user.ID), ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	for _, bearer := range []string{token.AccessToken, pat} {
+		if w := bearerRequest(http.MethodGet, "/v1/me/tokens", bearer, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code 401, got '%d'", w.Code)
+			return
+		}
+	}
+
+	if w := passwordGrant(user.Email, "password"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code 403, got '%d'", w.Code)
+		return
+	}
+
+	if w := adminRequest(http.MethodPost, fmt.Sprintf("/v1/admin/users/%d/enable", user.ID), ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	if w := passwordGrant(user.Email, "password"); w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestAdminUsersHandler_CannotDisableSelf(t *testing.T) {
+	if w := adminRequest(http.MethodPost, "/v1/admin/users/1/disable", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code 422, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestAdminUsersHandler_ForcePasswordReset(t *testing.T) {
+	user := createTestUser(t, "reset@go-notes.com", RoleUser)
+
+	if w := adminRequest(http.MethodPost, fmt.Sprintf("/v1/admin/users/%d/force-password-reset", user.ID), ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	w := passwordGrant(user.Email, "password")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code 403, got '%d'", w.Code)
+		return
+	}
+
+	errors := struct {
+		Errors []*ErrorObject `json:"errors"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &errors)
+
+	if len(errors.Errors) != 1 || errors.Errors[0].Title != PasswordResetRequired {
+		t.Errorf("Expected error '%s', got '%s'", PasswordResetRequired, w.Body.String())
+		return
+	}
+
+	w = requestToken(app, "1", "secret", url.Values{
+		"grant_type":   {"password"},
+		"username":     {user.Email},
+		"password":     {"password"},
+		"new_password": {"a new password"},
+	})
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return
+	}
+
+	if w := passwordGrant(user.Email, "password"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected old password to be rejected, got '%d'", w.Code)
+		return
+	}
+
+	if w := passwordGrant(user.Email, "a new password"); w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestAdminUsersHandler_Delete(t *testing.T) {
+	user := createTestUser(t, "delete@go-notes.com", RoleUser)
+	note := &Note{Title: "Doomed", CreatedById: user.ID}
+	app.Db().Create(note)
+
+	// Notes written in a shared workspace stay with it
+	workspace, _ := NewWorkspaceRepository(app.Db()).Create(context.Background(), &Workspace{Name: "Shared", CreatedById: 2})
+	app.Db().Create(&WorkspaceMember{WorkspaceId: workspace.ID, UserId: user.ID, Role: WorkspaceRoleEditor})
+	shared := &Note{Title: "Shared", CreatedById: user.ID, WorkspaceId: workspace.ID}
+	app.Db().Create(shared)
+
+	if w := adminRequest(http.MethodDelete, fmt.Sprintf("/v1/admin/users/%d", user.ID), ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code 204, got '%d'", w.Code)
+		return
+	}
+
+	if !app.Db().First(&User{}, user.ID).RecordNotFound() {
+		t.Error("Expected user to be deleted")
+		return
+	}
+
+	if !app.Db().First(&Note{}, note.ID).RecordNotFound() {
+		t.Error("Expected the user's notes to be deleted")
+		return
+	}
+
+	if app.Db().First(&Note{}, shared.ID).RecordNotFound() {
+		t.Error("Expected the user's notes in a shared workspace to be kept")
+		return
+	}
+}
+
+func TestAdminUsersHandler_DeleteLastWorkspaceOwner(t *testing.T) {
+	user := createTestUser(t, "last-owner@go-notes.com", RoleUser)
+	NewWorkspaceRepository(app.Db()).Create(context.Background(), &Workspace{Name: "Owned", CreatedById: user.ID})
+
+	if w := adminRequest(http.MethodDelete, fmt.Sprintf("/v1/admin/users/%d", user.ID), ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code 422, got '%d'", w.Code)
+		return
+	}
+
+	if app.Db().First(&User{}, user.ID).RecordNotFound() {
+		t.Error("Expected the last owner of a workspace not to be deleted")
+		return
+	}
+}
+
+func TestAdminUsersHandler_SetRole(t *testing.T) {
+	user := createTestUser(t, "promote@go-notes.com", RoleUser)
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	json.Unmarshal(passwordGrant(user.Email, "password").Body.Bytes(), &token)
+
+	if w := adminRequest(http.MethodPatch, fmt.Sprintf("/v1/admin/users/%d", user.ID), `{"role": "superuser"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code 422, got '%d'", w.Code)
+		return
+	}
+
+	if w := adminRequest(http.MethodPatch, fmt.Sprintf("/v1/admin/users/%d", user.ID), `{"role": "admin"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	updated := new(User)
+	app.Db().First(updated, user.ID)
+
+	if updated.Role != RoleAdmin {
+		t.Errorf("Expected role '%s', got '%s'", RoleAdmin, updated.Role)
+		return
+	}
+
+	if w := bearerRequest(http.MethodGet, "/v1/notes", token.AccessToken, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the access token issued before the role change to be revoked, got '%d'", w.Code)
+	}
+}
+
+func TestAdminStatsHandler_Stats(t *testing.T) {
+	w := adminRequest(http.MethodGet, "/v1/admin/stats", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	data := struct {
+		Stats *Stats `json:"data"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	if data.Stats.Users.Total < 3 || data.Stats.Users.ByRole[RoleAdmin] < 1 {
+		t.Errorf("Expected user counts, got '%s'", w.Body.String())
+		return
+	}
+}
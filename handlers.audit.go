@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type AuditHandler struct {
+	auditLog        *AuditLog
+	eventRepository AuditEventRepository
+	responseHandler ResponseHandler
+	requestHandler  RequestHandler
+}
+
+func InitAuditHandler(app *App) *AuditHandler {
+	h := &AuditHandler{
+		app.AuditLog(),
+		NewAuditEventRepository(app.Db()),
+		app.ResponseHandler(),
+		app.RequestHandler(),
+	}
+
+	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	canRead := NewPermissionMiddleware(app, PermissionAuditRead)
+
+	admin := app.Engine().Group("/v1/admin", authMiddleware, rateLimit, canRead)
+	{
+		admin.GET("/audit", h.List)
+		admin.GET("/audit/verify", h.Verify)
+	}
+
+	app.Engine().GET("/v1/me/audit", authMiddleware, rateLimit, h.ListMine)
+
+	return h
+}
+
+func (h *AuditHandler) List(c *gin.Context) {
+	filter, err := h.filter(c)
+	if err != nil {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if actor := c.Query("actor"); actor != "" {
+		id, err := strconv.Atoi(actor)
+		if err != nil {
+			h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "The actor parameter must be a user id")
+			return
+		}
+
+		actorId := uint(id)
+		filter.ActorId = &actorId
+	}
+
+	h.list(c, filter)
+}
+
+// ListMine returns the events a user made, and those made to their account by others
+func (h *AuditHandler) ListMine(c *gin.Context) {
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	filter, err := h.filter(c)
+	if err != nil {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	filter.UserId = &user.ID
+	h.list(c, filter)
+}
+
+func (h *AuditHandler) Verify(c *gin.Context) {
+	result, err := h.auditLog.Verify()
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, result)
+}
+
+func (h *AuditHandler) list(c *gin.Context, filter AuditFilter) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit := 50
+	offset := (page * limit) - limit
+
+	events, err := h.eventRepository.FindAll(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, events)
+}
+
+// filter reads the action, target and RFC 3339 from/to time range from the query string
+func (h *AuditHandler) filter(c *gin.Context) (AuditFilter, error) {
+	filter := AuditFilter{
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+	}
+
+	var err error
+
+	if from := c.Query("from"); from != "" {
+		if filter.From, err = time.Parse(time.RFC3339, from); err != nil {
+			return filter, errors.New("The from parameter must be an RFC 3339 time")
+		}
+	}
+
+	if to := c.Query("to"); to != "" {
+		if filter.To, err = time.Parse(time.RFC3339, to); err != nil {
+			return filter, errors.New("The to parameter must be an RFC 3339 time")
+		}
+	}
+
+	return filter, nil
+}
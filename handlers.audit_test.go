@@ -0,0 +1,160 @@
+package main
+
+import (
+	"testing"
+	"context"
+	"net/http"
+	"encoding/json"
+	"fmt"
+)
+
+func decodeAuditEvents(t *testing.T, body []byte) []*AuditEvent {
+	events := struct {
+		Data []*AuditEvent `json:"data"`
+	}{}
+
+	if err := json.Unmarshal(body, &events); err != nil {
+		t.Errorf("Could not decode audit events: '%s'", err.Error())
+	}
+
+	return events.Data
+}
+
+func TestAuditLog_NoteChangesAreRecorded(t *testing.T) {
+	user := createTestUser(t, "audit-notes@go-notes.com", RoleUser)
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "audit notes", UserId: user.ID})
+
+	w := bearerRequest(http.MethodPost, "/v1/notes", pat, `{"title": "Audited"}`)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return
+	}
+
+	note := struct {
+		Data Note `json:"data"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &note)
+
+	if w := bearerRequest(http.MethodPatch, fmt.Sprintf("/v1/notes/%d", note.Data.ID), pat, `{"title": "Audited again"}`); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	w = adminRequest(http.MethodGet, fmt.Sprintf("/v1/admin/audit?action=note.*&target=note:%d", note.Data.ID), "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	events := decodeAuditEvents(t, w.Body.Bytes())
+	if len(events) != 2 {
+		t.Errorf("Expected 2 events, got '%d'", len(events))
+		return
+	}
+
+	updated := events[0]
+	if updated.Action != AuditNoteUpdated || updated.ActorId == nil || *updated.ActorId != user.ID {
+		t.Errorf("Expected note.updated by user %d, got '%s'", user.ID, updated.Action)
+	}
+
+	if updated.Before != `{"tags":null,"title":"Audited","workspace_id":0}` {
+		t.Errorf("Unexpected before summary '%s'", updated.Before)
+	}
+
+	if updated.After != `{"tags":null,"title":"Audited again","workspace_id":0}` {
+		t.Errorf("Unexpected after summary '%s'", updated.After)
+	}
+}
+
+func TestAuditLog_FailedLoginIsRecorded(t *testing.T) {
+	passwordGrant("audit-nobody@go-notes.com", "wrong")
+
+	w := adminRequest(http.MethodGet, "/v1/admin/audit?action=login.failed&target=username:audit-nobody@go-notes.com", "")
+	if events := decodeAuditEvents(t, w.Body.Bytes()); len(events) != 1 || events[0].ActorId != nil {
+		t.Errorf("Expected 1 anonymous failed login, got '%d'", len(events))
+	}
+}
+
+func TestAuditLog_TimeRangeValidation(t *testing.T) {
+	if w := adminRequest(http.MethodGet, "/v1/admin/audit?from=yesterday", ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code 422, got '%d'", w.Code)
+		return
+	}
+
+	if w := adminRequest(http.MethodGet, "/v1/admin/audit?from=2100-01-01T00:00:00Z", ""); len(decodeAuditEvents(t, w.Body.Bytes())) != 0 {
+		t.Error("Expected no events in the future")
+	}
+}
+
+func TestAuditLog_RequiresAdmin(t *testing.T) {
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "audit", UserId: 2})
+
+	if w := bearerRequest(http.MethodGet, "/v1/admin/audit", pat, ""); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code 403, got '%d'", w.Code)
+	}
+}
+
+func TestAuditLog_ListMine(t *testing.T) {
+	user := createTestUser(t, "audit-me@go-notes.com", RoleUser)
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "audit me", UserId: user.ID})
+
+	bearerRequest(http.MethodPost, "/v1/notes", pat, `{"title": "Audit me"}`)
+	adminRequest(http.MethodPost, fmt.Sprintf("/v1/admin/users/%d/force-password-reset", user.ID), "")
+	adminRequest(http.MethodPost, "/v1/workspaces", `{"name": "Not mine"}`)
+
+	events := decodeAuditEvents(t, bearerRequest(http.MethodGet, "/v1/me/audit", pat, "").Body.Bytes())
+	if len(events) != 2 {
+		t.Errorf("Expected 2 events, got '%d'", len(events))
+		return
+	}
+
+	if events[0].Action != AuditUserPasswordResetForced || events[1].Action != AuditNoteCreated {
+		t.Errorf("Unexpected events '%s' and '%s'", events[0].Action, events[1].Action)
+	}
+}
+
+func TestAuditLog_IsAppendOnly(t *testing.T) {
+	passwordGrant("audit-append-only@go-notes.com", "wrong")
+
+	event := new(AuditEvent)
+	app.Db().Order("id desc").First(event)
+
+	if err := app.Db().Delete(event).Error; err != ErrAuditEventImmutable {
+		t.Errorf("Expected deleting an event to fail, got '%v'", err)
+	}
+
+	event.Action = "tag.changed"
+	if err := app.Db().Save(event).Error; err != ErrAuditEventImmutable {
+		t.Errorf("Expected updating an event to fail, got '%v'", err)
+	}
+}
+
+func TestAuditLog_VerifyDetectsTampering(t *testing.T) {
+	passwordGrant("audit-tamper@go-notes.com", "wrong")
+
+	result := struct {
+		Data AuditVerification `json:"data"`
+	}{}
+	json.Unmarshal(adminRequest(http.MethodGet, "/v1/admin/audit/verify", "").Body.Bytes(), &result)
+
+	if !result.Data.Valid || result.Data.Checked == 0 {
+		t.Errorf("Expected a valid chain, got '%+v'", result.Data)
+		return
+	}
+
+	event := new(AuditEvent)
+	app.Db().Where("action = ?", AuditLoginFailed).Order("id desc").First(event)
+
+	app.Db().Exec("UPDATE audit_event SET target = ? WHERE id = ?", "username:someone-else", event.ID)
+	defer app.Db().Exec("UPDATE audit_event SET target = ? WHERE id = ?", event.Target, event.ID)
+
+	verification, err := app.AuditLog().Verify()
+	if err != nil {
+		t.Errorf("Could not verify: '%s'", err.Error())
+		return
+	}
+
+	if verification.Valid || verification.BrokenAt == nil || *verification.BrokenAt != event.ID {
+		t.Errorf("Expected the chain to break at event %d, got '%+v'", event.ID, verification)
+	}
+}
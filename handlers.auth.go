@@ -7,13 +7,25 @@ import (
 	"net/http"
 	"gopkg.in/go-playground/validator.v9"
 	"golang.org/x/crypto/bcrypt"
+	"time"
+	"strings"
+	"math"
+	"strconv"
 )
 
 type AuthHandler struct {
-	db              *gorm.DB
-	oauth2Server    *osin.Server
-	responseHandler ResponseHandler
-	validator       *validator.Validate
+	db               *gorm.DB
+	oauth2Server     *osin.Server
+	responseHandler  ResponseHandler
+	validator        *validator.Validate
+	idTokenIssuer    *IDTokenIssuer
+	twoFactor        *TwoFactorService
+	usernameThrottle LoginThrottle
+	ipThrottle       LoginThrottle
+	auditLog         *AuditLog
+	sessionTracker   *SessionTracker
+	metrics          *Metrics
+	rateLimiter      *RateLimiter
 }
 
 func InitAuthHandler(app *App) *AuthHandler {
@@ -22,18 +34,45 @@ func InitAuthHandler(app *App) *AuthHandler {
 		app.OAuth2Server(),
 		app.ResponseHandler(),
 		app.Validator(),
+		NewIDTokenIssuer(app.KeySet(), app.OAuth2Config()),
+		NewTwoFactorService(app.Db()),
+		NewGORMLoginThrottle(app.Db(), &app.Config().LoginThrottle.Username),
+		NewGORMLoginThrottle(app.Db(), &app.Config().LoginThrottle.IP),
+		app.AuditLog(),
+		app.SessionTracker(),
+		app.Metrics(),
+		app.RateLimiter(),
 	}
 
-	app.Engine().POST("/token", h.Token)
+	app.Engine().POST("/token", NewTokenRateLimitMiddleware(app), h.Token)
 
 	return h
 }
 
 func (h *AuthHandler) Token(c *gin.Context) {
-	resp := h.oauth2Server.NewResponse()
+	resp := newOAuth2Response(h.oauth2Server, c)
 	defer resp.Close()
 
+	allowCertificateClientAuth(c.Request)
+
 	if ar := h.oauth2Server.HandleAccessRequest(resp, c.Request); ar != nil {
+		var authTime time.Time
+
+		// Only now that the client is authenticated can it be charged for the request
+		if !takeRateLimit(h.rateLimiter, h.responseHandler, c, "token", "client:"+ar.Client.GetId()) {
+			return
+		}
+
+		if client, ok := ar.Client.(*osinClient); ok && !client.AllowsGrant(string(ar.Type)) {
+			h.responseHandler.Error(c, osin.E_UNAUTHORIZED_CLIENT, http.StatusBadRequest, "Client may not use this grant type")
+			return
+		}
+
+		if client, ok := ar.Client.(*osinClient); ok && !client.AllowsScope(ar.Scope) {
+			h.responseHandler.Error(c, osin.E_INVALID_SCOPE, http.StatusBadRequest, "Client may not request this scope")
+			return
+		}
+
 		switch ar.Type {
 		case osin.PASSWORD:
 			data := struct {
@@ -42,12 +81,13 @@ func (h *AuthHandler) Token(c *gin.Context) {
 				Password     string `form:"password" validate:"required"`
 				Scope        string `form:"scope" validate:"omitempty"`
 				ClientId     string `form:"client_id" validate:"required"`
-				ClientSecret string `form:"client_secret" validate:"required"`
+				ClientSecret string `form:"client_secret" validate:"omitempty"`
+				OTP          string `form:"otp" validate:"omitempty"`
+				NewPassword  string `form:"new_password" validate:"omitempty,min=8"`
 			}{}
 
 			if err := c.ShouldBind(&data); err != nil {
-				// todo not malformed json. fix error
-				h.responseHandler.MalformedJSON(c)
+				h.responseHandler.MalformedRequest(c)
 				return
 			}
 
@@ -56,25 +96,123 @@ func (h *AuthHandler) Token(c *gin.Context) {
 				return
 			}
 
+			attempt := new(loginAttempt)
+			if h.throttled(c, attempt, data.Username) {
+				return
+			}
+
 			user := new(User)
 
 			if err := h.db.Where("email = ?", data.Username).Find(user).Error; err != nil {
+				h.loginFailed(c, attempt, data.Username)
 				h.responseHandler.Error(c, AuthenticationError, http.StatusBadRequest, "Username or Password is incorrect")
 				return
 			}
 
-			if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(data.Password)); err != nil {
+			if err := compareHashAndPassword(c.Request.Context(), user.Password, data.Password); err != nil {
+				h.loginFailed(c, attempt, data.Username)
 				h.responseHandler.Error(c, AuthenticationError, http.StatusBadRequest, "Username or Password is incorrect")
 				return
 			}
 
+			if user.TOTPEnabled && data.OTP == "" {
+				// Failed codes for the challenge still count against the username
+				h.forgive(c, attempt)
+				h.mfaRequired(c, user, ar)
+				return
+			}
+
+			if user.TOTPEnabled && !h.twoFactor.Verify(user, data.OTP) {
+				h.loginFailed(c, attempt, data.Username)
+				h.responseHandler.Error(c, AuthenticationError, http.StatusBadRequest, "One-time password is incorrect")
+				return
+			}
+
+			h.loginSucceeded(c, attempt, data.Username)
+
+			if h.disabled(c, user) || !h.resetPassword(c, user, data.NewPassword) {
+				return
+			}
+
 			ar.UserData = user
 			ar.Authorized = true
+			authTime = time.Now()
+		case osin.ASSERTION:
+			if ar.AssertionType != MFAAssertionType {
+				h.responseHandler.Error(c, osin.E_INVALID_GRANT, http.StatusBadRequest, "Unsupported assertion type")
+				return
+			}
+
+			// Only the client address is known before the token is checked
+			attempt := new(loginAttempt)
+			if h.throttled(c, attempt, "") {
+				return
+			}
+
+			challenge, user, err := h.twoFactor.FindChallenge(ar.Assertion, ar.Client.GetId())
+			if err != nil {
+				h.loginFailed(c, attempt, "")
+				h.responseHandler.Error(c, AuthenticationError, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			// Codes for a user are limited however many challenges and addresses they
+			// are tried from
+			if h.throttled(c, attempt, user.Email) {
+				return
+			}
+
+			ok, err := h.twoFactor.CompleteChallenge(challenge, user, c.PostForm("otp"))
+			if err == ErrMFAChallengeInvalid {
+				h.loginFailed(c, attempt, user.Email)
+				h.responseHandler.Error(c, AuthenticationError, http.StatusBadRequest, err.Error())
+				return
+			}
+
+			if err != nil {
+				h.responseHandler.InternalServerError(c)
+				return
+			}
+
+			if !ok {
+				h.loginFailed(c, attempt, user.Email)
+				h.responseHandler.Error(c, AuthenticationError, http.StatusBadRequest, "One-time password is incorrect")
+				return
+			}
+
+			h.loginSucceeded(c, attempt, user.Email)
+
+			if h.disabled(c, user) || !h.resetPassword(c, user, c.PostForm("new_password")) {
+				return
+			}
+
+			ar.UserData = user
+			ar.Scope = challenge.Scope
+			ar.GenerateRefresh = true
+			ar.Authorized = true
+			authTime = time.Now()
 		case osin.REFRESH_TOKEN:
+			if user, ok := ar.UserData.(*User); ok && h.disabled(c, user) {
+				return
+			}
+
 			ar.Authorized = true
 		}
 
 		h.oauth2Server.FinishAccessRequest(resp, c.Request, ar)
+
+		if !resp.IsError && hasScope(ar.Scope, ScopeOpenID) {
+			h.issueIDToken(resp, ar, authTime)
+		}
+
+		if accessToken, ok := resp.Output["access_token"].(string); ok && !resp.IsError {
+			if err := h.sessionTracker.Start(accessToken, c.ClientIP(), c.Request.UserAgent()); err != nil {
+				NewRequestHandler().GetLogger(c).Error("Could not record session", "error", err)
+			}
+
+			h.auditIssued(c, ar, !authTime.IsZero())
+			h.metrics.TokenIssued(string(ar.Type))
+		}
 	}
 
 	if resp.IsError && resp.InternalError != nil {
@@ -93,3 +231,233 @@ func (h *AuthHandler) Token(c *gin.Context) {
 
 	osin.OutputJSON(resp, c.Writer, c.Request)
 }
+
+func (h *AuthHandler) issueIDToken(resp *osin.Response, ar *osin.AccessRequest, authTime time.Time) {
+	user, ok := ar.UserData.(*User)
+	if !ok {
+		resp.SetError(osin.E_SERVER_ERROR, "")
+		return
+	}
+
+	idToken, err := h.idTokenIssuer.Issue(user, ar.Client.GetId(), ar.Scope, authTime)
+	if err != nil {
+		resp.SetError(osin.E_SERVER_ERROR, "")
+		resp.InternalError = err
+		return
+	}
+
+	resp.Output["id_token"] = idToken
+}
+
+// mfaRequired responds with a token the client can exchange, along with a one-time
+// password, for an access token using the assertion grant
+func (h *AuthHandler) mfaRequired(c *gin.Context, user *User, ar *osin.AccessRequest) {
+	token, err := h.twoFactor.Challenge(user, ar.Client.GetId(), ar.Scope)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.Errors(c, http.StatusForbidden, []*ErrorObject{
+		&ErrorObject{
+			Title:  MFARequired,
+			Detail: "A one-time password is required",
+			Status: http.StatusForbidden,
+			Meta: map[string]interface{}{
+				"mfa_token":      token,
+				"assertion_type": MFAAssertionType,
+				"expires_in":     int(mfaChallengeLifetime.Seconds()),
+			},
+		},
+	})
+}
+
+func usernameThrottleKey(username string) string {
+	return "username:" + strings.ToLower(username)
+}
+
+// loginThrottles returns the throttles that apply to a login attempt, keyed by the
+// throttle key. The username is left out when it is not known.
+func (h *AuthHandler) loginThrottles(c *gin.Context, username string) map[string]LoginThrottle {
+	throttles := map[string]LoginThrottle{
+		"ip:" + c.ClientIP(): h.ipThrottle,
+	}
+
+	if username != "" {
+		throttles[usernameThrottleKey(username)] = h.usernameThrottle
+	}
+
+	return throttles
+}
+
+// loginAttempt holds the throttle keys a login attempt has been counted against, and
+// the keys it locked out
+type loginAttempt struct {
+	throttles map[string]LoginThrottle
+	lockouts  []string
+}
+
+// throttled counts the login attempt against the username and client address, unless
+// either has to wait before trying again, in which case it responds with 429 Too Many
+// Requests. Keys the attempt has already been counted against are skipped.
+func (h *AuthHandler) throttled(c *gin.Context, attempt *loginAttempt, username string) bool {
+	if attempt.throttles == nil {
+		attempt.throttles = map[string]LoginThrottle{}
+	}
+
+	var wait time.Duration
+	counted := map[string]LoginThrottle{}
+
+	for key, throttle := range h.loginThrottles(c, username) {
+		if _, ok := attempt.throttles[key]; ok {
+			continue
+		}
+
+		retryAfter, locked, err := throttle.Attempt(key)
+		if err != nil {
+			h.forgive(c, &loginAttempt{throttles: counted})
+			h.responseHandler.InternalServerError(c)
+			return true
+		}
+
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+
+		if retryAfter == 0 {
+			counted[key] = throttle
+		}
+
+		if locked {
+			attempt.lockouts = append(attempt.lockouts, key)
+		}
+	}
+
+	if wait == 0 {
+		for key, throttle := range counted {
+			attempt.throttles[key] = throttle
+		}
+
+		return false
+	}
+
+	// A refused attempt is not a failure
+	h.forgive(c, &loginAttempt{throttles: counted})
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	h.responseHandler.Error(c, TooManyLoginAttempts, http.StatusTooManyRequests, "Too many failed login attempts, try again in {0} seconds", seconds)
+
+	return true
+}
+
+func (h *AuthHandler) loginFailed(c *gin.Context, attempt *loginAttempt, username string) {
+	target := "mfa_challenge"
+	if username != "" {
+		target = usernameThrottleKey(username)
+	}
+
+	h.auditLog.Log(c, AuditLoginFailed, target, nil, nil)
+	h.metrics.LoginFailed()
+
+	for _, key := range attempt.lockouts {
+		h.auditLog.Log(c, AuditLoginLockout, key, nil, nil)
+	}
+}
+
+// forgive takes back the attempt from all its throttles
+func (h *AuthHandler) forgive(c *gin.Context, attempt *loginAttempt) {
+	for key, throttle := range attempt.throttles {
+		if err := throttle.Forgive(key); err != nil {
+			NewRequestHandler().GetLogger(c).Error("Could not forgive login attempt", "error", err)
+		}
+	}
+}
+
+// loginSucceeded forgets the failures of the username, and takes back the attempt from
+// the client address, which other users may be failing from
+func (h *AuthHandler) loginSucceeded(c *gin.Context, attempt *loginAttempt, username string) {
+	for key, throttle := range attempt.throttles {
+		var err error
+		if key == usernameThrottleKey(username) {
+			err = throttle.Succeed(key)
+		} else {
+			err = throttle.Forgive(key)
+		}
+
+		if err != nil {
+			NewRequestHandler().GetLogger(c).Error("Could not record successful login", "error", err)
+		}
+	}
+}
+
+func (h *AuthHandler) disabled(c *gin.Context, user *User) bool {
+	if !user.IsDisabled() {
+		return false
+	}
+
+	h.responseHandler.Error(c, Forbidden, http.StatusForbidden, "This account has been disabled")
+
+	return true
+}
+
+// resetPassword sets a new password for users who have been made to reset theirs. It
+// reports whether the login may continue.
+func (h *AuthHandler) resetPassword(c *gin.Context, user *User, newPassword string) bool {
+	if !user.ForcePasswordReset {
+		return true
+	}
+
+	if newPassword == "" {
+		h.responseHandler.Error(c, PasswordResetRequired, http.StatusForbidden, "A new password must be set with the new_password parameter")
+		return false
+	}
+
+	if len(newPassword) < 8 {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "The new password must be at least 8 characters")
+		return false
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return false
+	}
+
+	err = h.db.Model(user).UpdateColumns(map[string]interface{}{
+		"password":             string(hash),
+		"force_password_reset": false,
+	}).Error
+
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return false
+	}
+
+	return true
+}
+
+// auditIssued records the issue of a token, and the login it completed if any. The
+// user is not yet authenticated on the request, so the actor is set here.
+func (h *AuthHandler) auditIssued(c *gin.Context, ar *osin.AccessRequest, login bool) {
+	user, ok := ar.UserData.(*User)
+	if !ok {
+		return
+	}
+
+	actions := []string{AuditTokenIssued}
+	if login {
+		actions = []string{AuditLoginSucceeded, AuditTokenIssued}
+	}
+
+	for _, action := range actions {
+		e := NewAuditEvent(c, action)
+		e.ActorId = &user.ID
+		e.Target = "client:" + ar.Client.GetId()
+		e.Detail = string(ar.Type)
+
+		if err := h.auditLog.Record(e); err != nil {
+			NewRequestHandler().GetLogger(c).Error("Could not record audit event", "action", action, "error", err)
+		}
+	}
+}
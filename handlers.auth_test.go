@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"github.com/RangelReale/osin"
 	"net/url"
+	"github.com/gin-gonic/gin"
+	"time"
 )
 
 func TestAuthHandler_TokenPasswordSuccess(t *testing.T) {
@@ -331,3 +333,100 @@ func TestAuthHandler_TokenInvalidRefreshToken(t *testing.T) {
 		return true
 	})
 }
+
+func TestAuthHandler_TokenRefreshTokenReuseRevokesFamily(t *testing.T) {
+	token := func(params url.Values) (int, string) {
+		w := requestToken(app, "1", "secret", params)
+
+		data := struct {
+			RefreshToken string `json:"refresh_token"`
+		}{}
+		json.Unmarshal(w.Body.Bytes(), &data)
+
+		return w.Code, data.RefreshToken
+	}
+
+	refresh := func(refreshToken string) (int, string) {
+		return token(url.Values{"grant_type": {"refresh_token"}, "refresh_token": {refreshToken}})
+	}
+
+	code, first := token(url.Values{
+		"grant_type": {"password"},
+		"username":   {"test2@go-notes.com"},
+		"password":   {"password"},
+		"scope":      {"email"},
+	})
+	if code != http.StatusCreated {
+		t.Errorf("Expected status code '201', got '%d'", code)
+		return
+	}
+
+	code, rotated := refresh(first)
+	if code != http.StatusCreated {
+		t.Errorf("Expected status code '201', got '%d'", code)
+		return
+	}
+
+	if rotated == first {
+		t.Error("Expected a new refresh token to be issued")
+		return
+	}
+
+	if code, _ := refresh(first); code != http.StatusBadRequest {
+		t.Errorf("Expected reused refresh token to be rejected, got '%d'", code)
+		return
+	}
+
+	if code, _ := refresh(rotated); code != http.StatusBadRequest {
+		t.Errorf("Expected rotated refresh token to be revoked, got '%d'", code)
+		return
+	}
+}
+
+func TestAuthHandler_TokenPasswordThrottlesFailedLogins(t *testing.T) {
+	// The throttle clock is fixed, so delays cannot run out while passwords are checked
+	a := newTestApp(app.Db(), NewOAuth2Config())
+	a.engine = gin.New()
+	h := InitAuthHandler(a)
+
+	now := time.Now()
+	for _, throttle := range []LoginThrottle{h.usernameThrottle, h.ipThrottle} {
+		throttle.(*GORMLoginThrottle).now = func() time.Time { return now }
+	}
+
+	params := url.Values{
+		"grant_type": {"password"},
+		"username":   {"throttled@go-notes.com"},
+		"password":   {"wrong"},
+	}
+
+	fromAddress := func(req *http.Request) {
+		req.RemoteAddr = "192.0.2.10:1234"
+	}
+
+	// The first five failures are free, the sixth makes the next attempt wait
+	var w *httptest.ResponseRecorder
+	for i := 0; i < 7; i++ {
+		w = requestToken(a, "1", "secret", params, fromAddress)
+	}
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status code 429, got '%d'", w.Code)
+		return
+	}
+
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+		return
+	}
+
+	// Another username from the same address is still allowed to try
+	params.Set("username", "test2@go-notes.com")
+	params.Set("password", "password")
+	w = requestToken(a, "1", "secret", params, fromAddress)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return
+	}
+}
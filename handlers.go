@@ -4,4 +4,16 @@ func InitHandlers(app *App) {
 	InitNotesHandler(app)
 	InitTagsHandler(app)
 	InitAuthHandler(app)
+	InitWellKnownHandler(app)
+	InitUserInfoHandler(app)
+	InitPersonalAccessTokensHandler(app)
+	InitTwoFactorHandler(app)
+	InitSessionsHandler(app)
+	InitOAuth2ClientsHandler(app)
+	InitAdminUsersHandler(app)
+	InitAdminStatsHandler(app)
+	InitWorkspacesHandler(app)
+	InitAuditHandler(app)
+	InitHealthHandler(app)
+	InitMetricsHandler(app)
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type HealthHandler struct {
+	checker         *HealthChecker
+	responseHandler ResponseHandler
+}
+
+func InitHealthHandler(app *App) *HealthHandler {
+	config := app.Config()
+
+	checker := NewHealthChecker(config.Health.Timeout)
+	checker.Add("database", DatabaseHealthCheck(app.Db()))
+	checker.Add("migrations", MigrationsHealthCheck(app.Db()))
+	// Expired tokens piling up doesn't stop requests from being served
+	checker.AddOptional("token_janitor", TokenJanitorHealthCheck(app.TokenJanitor()))
+
+	if dir := sqliteDir(config.Database.DSN); config.Database.Driver == "sqlite3" && dir != "" {
+		checker.Add("disk", DiskHealthCheck(dir, uint64(config.Health.MinFreeDiskMB)<<20))
+	}
+
+	h := &HealthHandler{
+		checker,
+		app.ResponseHandler(),
+	}
+
+	// Unauthenticated, so orchestrators can probe them
+	app.Engine().GET("/healthz", h.Live)
+	app.Engine().GET("/readyz", h.Ready)
+
+	return h
+}
+
+// Live reports that the process is up and serving requests
+func (h *HealthHandler) Live(c *gin.Context) {
+	h.responseHandler.JSON(c, http.StatusOK, gin.H{"status": HealthStatusOK})
+}
+
+// Ready reports whether the dependencies needed to serve requests are usable
+func (h *HealthHandler) Ready(c *gin.Context) {
+	report := h.checker.Check(c.Request.Context())
+
+	status := http.StatusOK
+	if report.Status != HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+
+	h.responseHandler.JSON(c, status, report)
+}
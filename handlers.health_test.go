@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+	"context"
+	"time"
+)
+
+func readiness(t *testing.T) (int, *HealthReport) {
+	req, _ := http.NewRequest(http.MethodGet, "/readyz", nil)
+	w := httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+
+	report := struct {
+		Data *HealthReport `json:"data"`
+	}{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Could not decode readiness report: '%s'", err.Error())
+	}
+
+	return w.Code, report.Data
+}
+
+func TestHealthHandler_Live(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusOK
+	})
+}
+
+func TestHealthHandler_Ready(t *testing.T) {
+	app.TokenJanitor().Start()
+	defer app.TokenJanitor().Stop()
+
+	code, report := readiness(t)
+	if code != http.StatusOK || report.Status != HealthStatusOK {
+		t.Errorf("Expected status code 200, got '%d' '%+v'", code, report.Checks)
+		return
+	}
+
+	for _, name := range []string{"database", "migrations", "token_janitor", "disk"} {
+		if report.Checks[name] == nil || report.Checks[name].Status != HealthStatusOK {
+			t.Errorf("Expected check '%s' to pass", name)
+		}
+	}
+}
+
+func TestHealthHandler_ReadyWithoutJanitor(t *testing.T) {
+	code, report := readiness(t)
+	if code != http.StatusOK || report.Status != HealthStatusOK {
+		t.Errorf("Expected status code 200, got '%d'", code)
+		return
+	}
+
+	if check := report.Checks["token_janitor"]; check.Status != HealthStatusWarn || check.Error == "" {
+		t.Errorf("Expected a warning from the token janitor check, got '%+v'", check)
+	}
+
+	if check := report.Checks["database"]; check.Status != HealthStatusOK {
+		t.Errorf("Expected the database check to pass, got '%+v'", check)
+	}
+}
+
+func TestDiskHealthCheck(t *testing.T) {
+	if err := DiskHealthCheck(".", 1<<62)(context.Background()); err == nil {
+		t.Error("Expected the check to fail when too little space is free")
+	}
+
+	if sqliteDir("file::memory:?cache=shared") != "" || sqliteDir("/var/lib/notes/notes.db?_busy_timeout=5000") != "/var/lib/notes" {
+		t.Error("Unexpected SQLite directories")
+	}
+}
+
+func TestMigrationsHealthCheck_ReadOnly(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer closeMigrationTestDB(db)
+
+	if err := MigrationsHealthCheck(db)(context.Background()); err == nil {
+		t.Error("Expected the check to fail before migrating")
+	}
+
+	if db.HasTable(&SchemaMigration{}) {
+		t.Error("Expected the check not to create the migrations table")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := MigrationsHealthCheck(app.Db())(ctx); err == nil {
+		t.Error("Expected the check to fail when the context is done")
+	}
+}
+
+func TestTokenJanitorHealthCheck_Stale(t *testing.T) {
+	j := NewTokenJanitor(app.Db(), time.Hour, 100)
+	j.Start()
+	defer j.Stop()
+
+	if err := TokenJanitorHealthCheck(j)(context.Background()); err != nil {
+		t.Errorf("Expected a started janitor to be healthy, got '%s'", err.Error())
+	}
+
+	j.setLastRun(time.Now().Add(-tokenJanitorStaleIntervals * 2 * time.Hour))
+
+	if err := TokenJanitorHealthCheck(j)(context.Background()); err == nil {
+		t.Error("Expected the check to fail when the janitor has not run recently")
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func InitMetricsHandler(app *App) {
+	config := app.Config().Metrics
+	if !config.Enabled {
+		return
+	}
+
+	app.Engine().GET(config.Path, gin.WrapH(promhttp.HandlerFor(app.Metrics().Registry(), promhttp.HandlerOpts{})))
+}
@@ -15,6 +15,8 @@ type NotesHandler struct {
 	responseHandler ResponseHandler
 	requestHandler  RequestHandler
 	validator       *validator.Validate
+	auditLog        *AuditLog
+	pagination      PaginationConfig
 }
 
 func InitNotesHandler(app *App) *NotesHandler {
@@ -25,17 +27,29 @@ func InitNotesHandler(app *App) *NotesHandler {
 		app.ResponseHandler(),
 		app.requestHandler,
 		app.Validator(),
+		app.AuditLog(),
+		app.Config().Pagination,
 	}
 
 	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	canRead := NewPermissionMiddleware(app, PermissionNotesRead)
+	canWrite := NewPermissionMiddleware(app, PermissionNotesWrite)
+	workspaceRead := NewWorkspaceMiddleware(app, PermissionNotesRead)
+	workspaceWrite := NewWorkspaceMiddleware(app, PermissionNotesWrite)
 
-	v1 := app.engine.Group("/v1")
-	{
-		v1.Use(authMiddleware).GET("/notes", h.List)
-		v1.Use(authMiddleware).GET("/notes/:id", h.Get)
-		v1.Use(authMiddleware).POST("/notes", h.Create)
-		v1.Use(authMiddleware).DELETE("/notes/:id", h.Delete)
-		v1.Use(authMiddleware).PATCH("/notes/:id", h.Update)
+	// Notes are in the personal workspace unless one is selected by path or header
+	groups := []*gin.RouterGroup{
+		app.engine.Group("/v1", authMiddleware, rateLimit),
+		app.engine.Group("/v1/workspaces/:ws", authMiddleware, rateLimit),
+	}
+
+	for _, v1 := range groups {
+		v1.GET("/notes", canRead, workspaceRead, h.List)
+		v1.GET("/notes/:id", canRead, workspaceRead, h.Get)
+		v1.POST("/notes", canWrite, workspaceWrite, h.Create)
+		v1.DELETE("/notes/:id", canWrite, workspaceWrite, h.Delete)
+		v1.PATCH("/notes/:id", canWrite, workspaceWrite, h.Update)
 	}
 
 	return h
@@ -48,18 +62,24 @@ func (h *NotesHandler) List(c *gin.Context) {
 		return
 	}
 
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit := 10
-	offset := (page * limit) - limit
+	page, ok := readPagination(c, h.pagination, h.responseHandler)
+	if !ok {
+		return
+	}
 
-	notes, err := h.noteRepository.FindByUserId(int(user.ID), limit, offset)
+	var notes []*Note
+	if workspace := h.requestHandler.GetWorkspaceId(c); workspace == 0 {
+		notes, err = h.noteRepository.FindByUserId(c.Request.Context(), int(user.ID), page)
+	} else {
+		notes, err = h.noteRepository.InWorkspace(workspace).FindAll(c.Request.Context(), page)
+	}
 
 	if err != nil {
 		h.responseHandler.InternalServerError(c)
 		return
 	}
 
-	h.responseHandler.JSON(c, http.StatusOK, notes)
+	h.responseHandler.JSONPage(c, notes, page)
 }
 
 func (h *NotesHandler) Get(c *gin.Context) {
@@ -70,13 +90,13 @@ func (h *NotesHandler) Get(c *gin.Context) {
 	}
 
 	id, _ := strconv.Atoi(c.Param("id"))
-	note, err := h.noteRepository.FindById(id)
+	note, err := h.notes(c).FindById(c.Request.Context(), id)
 	if err != nil {
 		h.responseHandler.NotFound(c)
 		return
 	}
 
-	if note.CreatedById != user.ID {
+	if !h.canAccess(c, note, user) {
 		h.responseHandler.Unauthorised(c)
 		return
 	}
@@ -104,7 +124,7 @@ func (h *NotesHandler) Create(c *gin.Context) {
 	}
 
 	n.CreatedById = user.ID
-	note, err := h.noteRepository.Create(n)
+	note, err := h.notes(c).Create(c.Request.Context(), n)
 	note.CreatedBy = user
 
 	if err != nil {
@@ -112,6 +132,7 @@ func (h *NotesHandler) Create(c *gin.Context) {
 		return
 	}
 
+	h.auditLog.Log(c, AuditNoteCreated, auditTarget("note", note.ID), nil, note)
 	h.responseHandler.JSON(c, http.StatusCreated, note)
 }
 
@@ -123,39 +144,50 @@ func (h *NotesHandler) Delete(c *gin.Context) {
 	}
 
 	id, _ := strconv.Atoi(c.Param("id"))
-	note, err := h.noteRepository.FindById(id)
+	note, err := h.notes(c).FindById(c.Request.Context(), id)
 
 	if err != nil {
 		h.responseHandler.NotFound(c)
 		return
 	}
 
-	if note.CreatedById != user.ID {
+	if !h.canAccess(c, note, user) {
 		h.responseHandler.Unauthorised(c)
 		return
 	}
 
-	if err := h.noteRepository.Delete(note); err != nil {
+	if err := h.notes(c).Delete(c.Request.Context(), note); err != nil {
 		h.responseHandler.InternalServerError(c)
+		return
 	}
 
+	h.auditLog.Log(c, AuditNoteDeleted, auditTarget("note", note.ID), note, nil)
+
 	h.responseHandler.JSON(c, http.StatusNoContent, "")
 }
 
 func (h *NotesHandler) Update(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	n, err := h.noteRepository.FindById(id)
+	n, err := h.notes(c).FindById(c.Request.Context(), id)
 
 	if err != nil {
 		h.responseHandler.NotFound(c)
 		return
 	}
 
-	if _, err := h.requestHandler.GetUser(c); err != nil {
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
 		h.responseHandler.InternalServerError(c)
 		return
 	}
 
+	if !h.canAccess(c, n, user) {
+		h.responseHandler.Unauthorised(c)
+		return
+	}
+
+	// Binding reuses the note's tags, so the summary has to be taken first
+	before := NewAuditSnapshot(n)
 	if err := c.BindJSON(n); err != nil {
 		h.responseHandler.MalformedJSON(c)
 		return
@@ -166,12 +198,23 @@ func (h *NotesHandler) Update(c *gin.Context) {
 		return
 	}
 
-	note, err := h.noteRepository.Update(id, n)
+	note, err := h.notes(c).Update(c.Request.Context(), id, n)
 
 	if err != nil {
 		h.responseHandler.InternalServerError(c)
 		return
 	}
 
+	h.auditLog.Log(c, AuditNoteUpdated, auditTarget("note", note.ID), before, note)
 	h.responseHandler.JSON(c, http.StatusOK, note)
 }
+
+func (h *NotesHandler) notes(c *gin.Context) NoteRepository {
+	return h.noteRepository.InWorkspace(h.requestHandler.GetWorkspaceId(c))
+}
+
+// canAccess reports whether user may see note. Notes in a shared workspace are open
+// to every member, while personal notes are only open to their creator.
+func (h *NotesHandler) canAccess(c *gin.Context, note *Note, user *User) bool {
+	return h.requestHandler.GetWorkspaceId(c) != 0 || note.CreatedById == user.ID
+}
@@ -290,7 +290,7 @@ func TestNotesHandler_CreateValidationErrors(t *testing.T) {
 			return false
 		}
 
-		expectedDetail := "Field validation for 'Title' failed on the 'required' tag [Key: 'Note.Title']"
+		expectedDetail := "title is a required field"
 		if data.Errors[0].Detail != expectedDetail {
 			t.Errorf("Expected '%s', got '%s'", expectedDetail, data.Errors[0].Detail)
 			return false
@@ -369,7 +369,7 @@ func TestNotesHandler_UpdateValidationErrors(t *testing.T) {
 			return false
 		}
 
-		expectedDetail := "Field validation for 'Title' failed on the 'required' tag [Key: 'Note.Title']"
+		expectedDetail := "title is a required field"
 		if data.Errors[0].Detail != expectedDetail {
 			t.Errorf("Expected '%s', got '%s'", expectedDetail, data.Errors[0].Detail)
 			return false
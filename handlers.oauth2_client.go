@@ -0,0 +1,164 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type OAuth2ClientsHandler struct {
+	clientRepository OAuth2ClientRepository
+	storage          *GORMStorage
+	responseHandler  ResponseHandler
+	validator        *validator.Validate
+	auditLog         *AuditLog
+}
+
+// clientWithSecret is only ever returned when a secret is created or rotated
+type clientWithSecret struct {
+	*OAuth2Client
+	ClientSecret string `json:"client_secret"`
+}
+
+func InitOAuth2ClientsHandler(app *App) *OAuth2ClientsHandler {
+	h := &OAuth2ClientsHandler{
+		NewOAuth2ClientRepository(app.Db()),
+		oauth2Storage(app.OAuth2Server()),
+		app.ResponseHandler(),
+		app.Validator(),
+		app.AuditLog(),
+	}
+
+	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	canManage := NewPermissionMiddleware(app, PermissionClientsManage)
+
+	admin := app.Engine().Group("/v1/admin", authMiddleware, rateLimit, canManage)
+	{
+		admin.GET("/clients", h.List)
+		admin.GET("/clients/:id", h.Get)
+		admin.POST("/clients", h.Create)
+		admin.PATCH("/clients/:id", h.Update)
+		admin.POST("/clients/:id/secret", h.RotateSecret)
+		admin.DELETE("/clients/:id", h.Delete)
+	}
+
+	return h
+}
+
+func (h *OAuth2ClientsHandler) List(c *gin.Context) {
+	clients, err := h.clientRepository.FindAll(c.Request.Context())
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, clients)
+}
+
+func (h *OAuth2ClientsHandler) Get(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	client, err := h.clientRepository.FindById(c.Request.Context(), id)
+	if err != nil {
+		h.responseHandler.NotFound(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, client)
+}
+
+func (h *OAuth2ClientsHandler) Create(c *gin.Context) {
+	client := new(OAuth2Client)
+
+	if err := c.BindJSON(client); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(client); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	client, secret, err := h.clientRepository.Create(c.Request.Context(), client)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditClientCreated, auditTarget("client", client.ID), nil, client)
+	h.responseHandler.JSON(c, http.StatusCreated, &clientWithSecret{client, secret})
+}
+
+func (h *OAuth2ClientsHandler) Update(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	client, err := h.clientRepository.FindById(c.Request.Context(), id)
+	if err != nil {
+		h.responseHandler.NotFound(c)
+		return
+	}
+
+	before := *client
+	if err := c.BindJSON(client); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(client); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	client, err = h.clientRepository.Update(c.Request.Context(), id, client)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditClientUpdated, auditTarget("client", client.ID), &before, client)
+
+	h.responseHandler.JSON(c, http.StatusOK, client)
+}
+
+func (h *OAuth2ClientsHandler) RotateSecret(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	client, err := h.clientRepository.FindById(c.Request.Context(), id)
+	if err != nil {
+		h.responseHandler.NotFound(c)
+		return
+	}
+
+	secret, err := h.clientRepository.RotateSecret(c.Request.Context(), client)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditClientSecretRotated, auditTarget("client", client.ID), nil, nil)
+	h.responseHandler.JSON(c, http.StatusOK, &clientWithSecret{client, secret})
+}
+
+// Delete removes the client along with every token issued to it
+func (h *OAuth2ClientsHandler) Delete(c *gin.Context) {
+	id, _ := strconv.Atoi(c.Param("id"))
+	client, err := h.clientRepository.FindById(c.Request.Context(), id)
+	if err != nil {
+		h.responseHandler.NotFound(c)
+		return
+	}
+
+	if err := h.storage.RevokeClient(c.Request.Context(), client); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	if err := h.clientRepository.Delete(c.Request.Context(), client); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditClientDeleted, auditTarget("client", client.ID), client, nil)
+
+	h.responseHandler.JSON(c, http.StatusNoContent, "")
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"testing"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"encoding/json"
+	"fmt"
+	"bytes"
+)
+
+func adminRequest(method string, path string, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer access-token")
+
+	w := httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+
+	return w
+}
+
+func createClient(t *testing.T, body string) (string, string) {
+	w := adminRequest(http.MethodPost, "/v1/admin/clients", body)
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return "", ""
+	}
+
+	data := struct {
+		Client struct {
+			ID           uint   `json:"id"`
+			ClientSecret string `json:"client_secret"`
+		} `json:"data"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	return fmt.Sprint(data.Client.ID), data.Client.ClientSecret
+}
+
+func passwordParams(scope string) url.Values {
+	return url.Values{
+		"grant_type": {"password"},
+		"username":   {"test2@go-notes.com"},
+		"password":   {"password"},
+		"scope":      {scope},
+	}
+}
+
+func TestOAuth2ClientsHandler_CreateEnforcesGrantsAndScopes(t *testing.T) {
+	id, secret := createClient(t, `{"name": "CLI", "redirect_uri": "https://cli.example.com/callback", "allowed_grants": "password", "allowed_scopes": "email"}`)
+
+	w := requestToken(app, id, secret, passwordParams("email"))
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return
+	}
+
+	token := struct {
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &token)
+
+	w = requestToken(app, id, secret, url.Values{"grant_type": {"refresh_token"}, "refresh_token": {token.RefreshToken}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected refresh grant to be refused, got '%d'", w.Code)
+		return
+	}
+
+	w = requestToken(app, id, secret, passwordParams("email openid"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected openid scope to be refused, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestOAuth2ClientsHandler_CreateValidation(t *testing.T) {
+	w := adminRequest(http.MethodPost, "/v1/admin/clients", `{"name": "Bad", "redirect_uri": "not-a-uri", "allowed_grants": "implicit"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code 422, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestOAuth2ClientsHandler_RequiresAdmin(t *testing.T) {
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "not admin", UserId: 2})
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/admin/clients", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", pat))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusForbidden
+	})
+}
+
+func TestOAuth2ClientsHandler_RotateSecret(t *testing.T) {
+	id, secret := createClient(t, `{"name": "Rotate", "redirect_uri": "https://rotate.example.com/callback"}`)
+
+	w := adminRequest(http.MethodPost, fmt.Sprintf("/v1/admin/clients/%s/secret", id), "")
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	data := struct {
+		Client struct {
+			ClientSecret string `json:"client_secret"`
+		} `json:"data"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	if w := requestToken(app, id, secret, passwordParams("email")); w.Code == http.StatusCreated {
+		t.Error("Expected the old secret to be rejected")
+		return
+	}
+
+	if w := requestToken(app, id, data.Client.ClientSecret, passwordParams("email")); w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestOAuth2ClientsHandler_DeleteRevokesTokens(t *testing.T) {
+	id, secret := createClient(t, `{"name": "Delete", "redirect_uri": "https://delete.example.com/callback"}`)
+
+	w := requestToken(app, id, secret, passwordParams("email"))
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &token)
+
+	if w := adminRequest(http.MethodDelete, "/v1/admin/clients/"+id, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected status code 204, got '%d'", w.Code)
+		return
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/notes", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.AccessToken))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusUnauthorized
+	})
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type PersonalAccessTokensHandler struct {
+	tokenRepository PersonalAccessTokenRepository
+	responseHandler ResponseHandler
+	requestHandler  RequestHandler
+	validator       *validator.Validate
+	auditLog        *AuditLog
+}
+
+func InitPersonalAccessTokensHandler(app *App) *PersonalAccessTokensHandler {
+	h := &PersonalAccessTokensHandler{
+		NewPersonalAccessTokenRepository(app.Db()),
+		app.ResponseHandler(),
+		app.RequestHandler(),
+		app.Validator(),
+		app.AuditLog(),
+	}
+
+	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	oauth2Only := NewOAuth2OnlyMiddleware(app)
+
+	me := app.Engine().Group("/v1/me", authMiddleware, rateLimit, oauth2Only)
+	{
+		me.GET("/tokens", h.List)
+		me.POST("/tokens", h.Create)
+		me.DELETE("/tokens/:id", h.Delete)
+	}
+
+	return h
+}
+
+func (h *PersonalAccessTokensHandler) List(c *gin.Context) {
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	tokens, err := h.tokenRepository.FindByUserId(c.Request.Context(), int(user.ID))
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, tokens)
+}
+
+func (h *PersonalAccessTokensHandler) Create(c *gin.Context) {
+	t := new(PersonalAccessToken)
+
+	if err := c.BindJSON(t); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(t); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	if t.ExpiresAt != nil && t.ExpiresAt.Before(time.Now()) {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "Expiry must be in the future")
+		return
+	}
+
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	t.UserId = user.ID
+	token, secret, err := h.tokenRepository.Create(c.Request.Context(), t)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditTokenCreated, auditTarget("personal_access_token", token.ID), nil, token)
+
+	// The secret is only ever returned here
+	h.responseHandler.JSON(c, http.StatusCreated, struct {
+		*PersonalAccessToken
+		Token string `json:"token"`
+	}{token, secret})
+}
+
+func (h *PersonalAccessTokensHandler) Delete(c *gin.Context) {
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+	token, err := h.tokenRepository.FindById(c.Request.Context(), id)
+
+	if err != nil || token.UserId != user.ID {
+		h.responseHandler.NotFound(c)
+		return
+	}
+
+	if err := h.tokenRepository.Delete(c.Request.Context(), token); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditTokenRevoked, auditTarget("personal_access_token", token.ID), token, nil)
+
+	h.responseHandler.JSON(c, http.StatusNoContent, "")
+}
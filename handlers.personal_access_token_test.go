@@ -0,0 +1,205 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+	"fmt"
+	"bytes"
+	"time"
+)
+
+func createPersonalAccessToken(t *testing.T, body string) (uint, string) {
+	req, _ := http.NewRequest(http.MethodPost, "/v1/me/tokens", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", "access-token"))
+
+	w := httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return 0, ""
+	}
+
+	data := struct {
+		Token struct {
+			ID    uint   `json:"id"`
+			Token string `json:"token"`
+		} `json:"data"`
+	}{}
+
+	if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil {
+		t.Error("Failed to unmarshal json")
+		return 0, ""
+	}
+
+	return data.Token.ID, data.Token.Token
+}
+
+func TestPersonalAccessTokensHandler_CreateAndUse(t *testing.T) {
+	id, secret := createPersonalAccessToken(t, `{"name": "script"}`)
+	if !isPersonalAccessToken(secret) {
+		t.Errorf("Expected a personal access token, got '%s'", secret)
+		return
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/notes", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secret))
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusOK
+	})
+
+	pat := new(PersonalAccessToken)
+	app.Db().First(pat, id)
+
+	if pat.TokenHash == secret || pat.TokenHash != hashToken(secret) {
+		t.Error("Expected token to be stored hashed")
+	}
+
+	if pat.LastUsedAt == nil || pat.LastUsedIP != "192.0.2.1" {
+		t.Error("Expected last used time and IP to be recorded")
+	}
+
+	// Another use within the interval is not written
+	req, _ = http.NewRequest(http.MethodGet, "/v1/notes", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secret))
+	req.RemoteAddr = "192.0.2.2:1234"
+	app.Engine().ServeHTTP(httptest.NewRecorder(), req)
+
+	app.Db().First(pat, id)
+	if pat.LastUsedIP != "192.0.2.1" {
+		t.Errorf("Expected the last use to be written at most once a minute, got IP '%s'", pat.LastUsedIP)
+	}
+
+	req, _ = http.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/me/tokens/%d", id), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", "access-token"))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusNoContent
+	})
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/notes", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secret))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusUnauthorized
+	})
+}
+
+func TestPersonalAccessTokensHandler_ExpiredTokenIsRejected(t *testing.T) {
+	id, secret := createPersonalAccessToken(t, fmt.Sprintf(`{"name": "expiring", "expires_at": "%s"}`, time.Now().Add(time.Hour).Format(time.RFC3339)))
+
+	past := time.Now().Add(-time.Minute)
+	app.Db().Model(&PersonalAccessToken{}).Where("id = ?", id).UpdateColumn("expires_at", past)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/notes", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secret))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusUnauthorized
+	})
+}
+
+func TestPersonalAccessTokensHandler_ListDoesNotExposeSecrets(t *testing.T) {
+	createPersonalAccessToken(t, `{"name": "listed"}`)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/me/tokens", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", "access-token"))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code 200, got '%d'", w.Code)
+			return false
+		}
+
+		if bytes.Contains(w.Body.Bytes(), []byte(personalAccessTokenPrefix)) {
+			t.Error("Expected token secrets to be omitted")
+			return false
+		}
+
+		return true
+	})
+}
+
+func TestPersonalAccessTokensHandler_DeleteAnotherUsersToken(t *testing.T) {
+	id, _ := createPersonalAccessToken(t, `{"name": "not yours"}`)
+	other := createAccessToken(3)
+
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/me/tokens/%d", id), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", other))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusNotFound
+	})
+}
+
+func TestPersonalAccessTokensHandler_CreateValidationErrors(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/v1/me/tokens", bytes.NewBufferString(`{"name": ""}`))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", "access-token"))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusUnprocessableEntity
+	})
+}
+
+func TestPersonalAccessTokensHandler_ScopeLimitsPermissions(t *testing.T) {
+	_, secret := createPersonalAccessToken(t, `{"name": "reader", "scope": "notes:read"}`)
+
+	for _, r := range []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/v1/notes", "", http.StatusOK},
+		{http.MethodPost, "/v1/notes", `{"title": "Written by a reader"}`, http.StatusForbidden},
+		{http.MethodGet, "/v1/tags", "", http.StatusForbidden},
+	} {
+		req, _ := http.NewRequest(r.method, r.path, bytes.NewBufferString(r.body))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secret))
+
+		w := httptest.NewRecorder()
+		app.Engine().ServeHTTP(w, req)
+
+		if w.Code != r.status {
+			t.Errorf("Expected status code %d for %s %s, got '%d'", r.status, r.method, r.path, w.Code)
+		}
+	}
+}
+
+func TestPersonalAccessTokensHandler_CannotManageCredentials(t *testing.T) {
+	_, secret := createPersonalAccessToken(t, `{"name": "script"}`)
+
+	for _, r := range []struct {
+		method string
+		path   string
+	}{
+		{http.MethodPost, "/v1/me/tokens"},
+		{http.MethodGet, "/v1/me/tokens"},
+		{http.MethodPost, "/v1/me/2fa"},
+		{http.MethodGet, "/v1/me/sessions"},
+		{http.MethodDelete, "/v1/me/sessions"},
+	} {
+		req, _ := http.NewRequest(r.method, r.path, bytes.NewBufferString(`{"name": "another"}`))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", secret))
+
+		w := httptest.NewRecorder()
+		app.Engine().ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("Expected status code 403 for %s %s, got '%d'", r.method, r.path, w.Code)
+		}
+	}
+}
+
+func TestPersonalAccessTokensHandler_RejectsUnknownScope(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "/v1/me/tokens", bytes.NewBufferString(`{"name": "script", "scope": "notes:read everything"}`))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", "access-token"))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusUnprocessableEntity
+	})
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+type SessionsHandler struct {
+	sessionRepository SessionRepository
+	storage           *GORMStorage
+	responseHandler   ResponseHandler
+	requestHandler    RequestHandler
+	auditLog          *AuditLog
+}
+
+func InitSessionsHandler(app *App) *SessionsHandler {
+	h := &SessionsHandler{
+		NewSessionRepository(app.Db()),
+		oauth2Storage(app.OAuth2Server()),
+		app.ResponseHandler(),
+		app.RequestHandler(),
+		app.AuditLog(),
+	}
+
+	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	oauth2Only := NewOAuth2OnlyMiddleware(app)
+
+	me := app.Engine().Group("/v1/me", authMiddleware, rateLimit, oauth2Only)
+	{
+		me.GET("/sessions", h.List)
+		me.DELETE("/sessions", h.DeleteAll)
+		me.DELETE("/sessions/:id", h.Delete)
+	}
+
+	return h
+}
+
+func (h *SessionsHandler) List(c *gin.Context) {
+	token, err := h.requestHandler.GetToken(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	refreshTokens, err := h.sessionRepository.FindByUserId(c.Request.Context(), int(user.ID))
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	sessions := []*Session{}
+	for _, t := range refreshTokens {
+		sessions = append(sessions, NewSession(t, token.AccessToken))
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, sessions)
+}
+
+func (h *SessionsHandler) Delete(c *gin.Context) {
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+	refreshToken, err := h.sessionRepository.FindById(c.Request.Context(), id)
+
+	if err != nil || refreshToken.UserId != user.ID {
+		h.responseHandler.NotFound(c)
+		return
+	}
+
+	if err := h.storage.RevokeFamily(c.Request.Context(), refreshToken); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditSessionRevoked, auditTarget("session", refreshToken.ID), nil, nil)
+	h.responseHandler.JSON(c, http.StatusNoContent, "")
+}
+
+// DeleteAll signs the user out everywhere, including the session making the request
+func (h *SessionsHandler) DeleteAll(c *gin.Context) {
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	refreshTokens, err := h.sessionRepository.FindByUserId(c.Request.Context(), int(user.ID))
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	for _, t := range refreshTokens {
+		if err := h.storage.RevokeFamily(c.Request.Context(), t); err != nil {
+			h.responseHandler.InternalServerError(c)
+			return
+		}
+	}
+
+	h.auditLog.Log(c, AuditSessionsRevoked, auditTarget("user", user.ID), nil, nil)
+	h.responseHandler.JSON(c, http.StatusNoContent, "")
+}
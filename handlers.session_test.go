@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"encoding/json"
+	"fmt"
+)
+
+func signIn(t *testing.T, userAgent string) (string, string) {
+	params := url.Values{
+		"grant_type": {"password"},
+		"username":   {"test2@go-notes.com"},
+		"password":   {"password"},
+	}
+
+	w := requestToken(app, "1", "secret", params, func(req *http.Request) {
+		req.Header.Set("User-Agent", userAgent)
+		req.RemoteAddr = "192.0.2.20:1234"
+	})
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+	}
+
+	token := struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &token)
+
+	return token.AccessToken, token.RefreshToken
+}
+
+func listSessions(accessToken string) (*httptest.ResponseRecorder, []*Session) {
+	req, _ := http.NewRequest(http.MethodGet, "/v1/me/sessions", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	w := httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+
+	data := struct {
+		Sessions []*Session `json:"data"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	return w, data.Sessions
+}
+
+func TestSessionsHandler_List(t *testing.T) {
+	accessToken, _ := signIn(t, "session-list-test")
+
+	w, sessions := listSessions(accessToken)
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	var current *Session
+	for _, s := range sessions {
+		if s.Current {
+			current = s
+		}
+	}
+
+	if current == nil {
+		t.Error("Expected the current session to be listed")
+		return
+	}
+
+	if current.UserAgent != "session-list-test" || current.IP != "192.0.2.20" {
+		t.Errorf("Expected user agent and IP to be recorded, got '%s' and '%s'", current.UserAgent, current.IP)
+		return
+	}
+
+	if current.ClientName != "Go Notes" || current.LastUsedAt == nil {
+		t.Errorf("Expected client name 'Go Notes' and a last used time, got '%s' and '%v'", current.ClientName, current.LastUsedAt)
+		return
+	}
+}
+
+func TestSessionsHandler_Delete(t *testing.T) {
+	accessToken, _ := signIn(t, "session-delete-test")
+	otherAccessToken, otherRefreshToken := signIn(t, "session-delete-other")
+
+	_, sessions := listSessions(otherAccessToken)
+	var id uint
+	for _, s := range sessions {
+		if s.Current {
+			id = s.ID
+		}
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/me/sessions/%d", id), nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusNoContent
+	})
+
+	if w, _ := listSessions(otherAccessToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status code 401, got '%d'", w.Code)
+		return
+	}
+
+	w := requestToken(app, "1", "secret", url.Values{"grant_type": {"refresh_token"}, "refresh_token": {otherRefreshToken}})
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400, got '%d'", w.Code)
+		return
+	}
+
+	if w, _ := listSessions(accessToken); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestSessionsHandler_DeleteOtherUsersSession(t *testing.T) {
+	accessToken, _ := signIn(t, "session-other-user-test")
+
+	// Refresh token 1 belongs to user 1
+	req, _ := http.NewRequest(http.MethodDelete, "/v1/me/sessions/1", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusNotFound
+	})
+}
+
+func TestSessionsHandler_DeleteAll(t *testing.T) {
+	accessToken, _ := signIn(t, "session-delete-all-test")
+	otherAccessToken, _ := signIn(t, "session-delete-all-other")
+
+	req, _ := http.NewRequest(http.MethodDelete, "/v1/me/sessions", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusNoContent
+	})
+
+	for _, token := range []string{accessToken, otherAccessToken} {
+		if w, _ := listSessions(token); w.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status code 401, got '%d'", w.Code)
+			return
+		}
+	}
+}
@@ -6,14 +6,16 @@ import (
 	"net/http"
 	"strconv"
 	"gopkg.in/go-playground/validator.v9"
-	"fmt"
 )
 
 type TagsHandler struct {
 	db              *gorm.DB
 	tagRepository   TagRepository
 	responseHandler ResponseHandler
+	requestHandler  RequestHandler
 	validator       *validator.Validate
+	auditLog        *AuditLog
+	pagination      PaginationConfig
 }
 
 func InitTagsHandler(app *App) *TagsHandler {
@@ -21,40 +23,53 @@ func InitTagsHandler(app *App) *TagsHandler {
 		app.Db(),
 		NewTagRepository(app.Db()),
 		app.ResponseHandler(),
+		app.RequestHandler(),
 		app.Validator(),
+		app.AuditLog(),
+		app.Config().Pagination,
 	}
 
 	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	canRead := NewPermissionMiddleware(app, PermissionTagsRead)
+	canWrite := NewPermissionMiddleware(app, PermissionTagsWrite)
+	workspaceRead := NewWorkspaceMiddleware(app, PermissionTagsRead)
+	workspaceWrite := NewWorkspaceMiddleware(app, PermissionTagsWrite)
+
+	groups := []*gin.RouterGroup{
+		app.engine.Group("/v1", authMiddleware, rateLimit),
+		app.engine.Group("/v1/workspaces/:ws", authMiddleware, rateLimit),
+	}
 
-	v1 := app.engine.Group("/v1")
-	{
-		v1.Use(authMiddleware).GET("/tags", h.List)
-		v1.Use(authMiddleware).GET("/tags/:id", h.Get)
-		v1.Use(authMiddleware).POST("/tags", h.Create)
-		v1.Use(authMiddleware).DELETE("/tags/:id", h.Delete)
-		v1.Use(authMiddleware).PATCH("/tags/:id", h.Update)
+	for _, v1 := range groups {
+		v1.GET("/tags", canRead, workspaceRead, h.List)
+		v1.GET("/tags/:id", canRead, workspaceRead, h.Get)
+		v1.POST("/tags", canWrite, workspaceWrite, h.Create)
+		v1.DELETE("/tags/:id", canWrite, workspaceWrite, h.Delete)
+		v1.PATCH("/tags/:id", canWrite, workspaceWrite, h.Update)
 	}
 
 	return h
 }
 
 func (h *TagsHandler) List(c *gin.Context) {
-	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-	limit := 10
-	offset := (page * limit) - limit
+	page, ok := readPagination(c, h.pagination, h.responseHandler)
+	if !ok {
+		return
+	}
 
-	tags, err := h.tagRepository.FindAll(limit, offset)
+	tags, err := h.tags(c).FindAll(c.Request.Context(), page)
 	if err != nil {
 		h.responseHandler.InternalServerError(c)
 		return
 	}
 
-	h.responseHandler.JSON(c, http.StatusOK, tags)
+	h.responseHandler.JSONPage(c, tags, page)
 }
 
 func (h *TagsHandler) Get(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	tag, err := h.tagRepository.FindById(id)
+	tag, err := h.tags(c).FindById(c.Request.Context(), id)
 
 	if err != nil {
 		h.responseHandler.NotFound(c)
@@ -77,45 +92,50 @@ func (h *TagsHandler) Create(c *gin.Context) {
 		return
 	}
 
-	if _, err := h.tagRepository.FindByName(t.Name); err == nil {
-		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, fmt.Sprintf("Tag '%s' already exists", t.Name))
+	if _, err := h.tags(c).FindByName(c.Request.Context(), t.Name); err == nil {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "Tag '{0}' already exists", t.Name)
 		return
 	}
 
-	tag, err := h.tagRepository.Create(t)
+	tag, err := h.tags(c).Create(c.Request.Context(), t)
 	if err != nil {
 		h.responseHandler.InternalServerError(c)
 		return
 	}
 
+	h.auditLog.Log(c, AuditTagCreated, auditTarget("tag", tag.ID), nil, tag)
 	h.responseHandler.JSON(c, http.StatusCreated, tag)
 }
 
 func (h *TagsHandler) Delete(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	tag, err := h.tagRepository.FindById(id)
+	tag, err := h.tags(c).FindById(c.Request.Context(), id)
 
 	if err != nil {
 		h.responseHandler.NotFound(c)
 		return
 	}
 
-	if err := h.tagRepository.Delete(tag); err != nil {
+	if err := h.tags(c).Delete(c.Request.Context(), tag); err != nil {
 		h.responseHandler.InternalServerError(c)
+		return
 	}
 
+	h.auditLog.Log(c, AuditTagDeleted, auditTarget("tag", tag.ID), tag, nil)
+
 	h.responseHandler.JSON(c, http.StatusNoContent, "")
 }
 
 func (h *TagsHandler) Update(c *gin.Context) {
 	id, _ := strconv.Atoi(c.Param("id"))
-	t, err := h.tagRepository.FindById(id)
+	t, err := h.tags(c).FindById(c.Request.Context(), id)
 
 	if err != nil {
 		h.responseHandler.NotFound(c)
 		return
 	}
 
+	before := *t
 	if err := c.BindJSON(t); err != nil {
 		h.responseHandler.MalformedJSON(c)
 		return
@@ -126,17 +146,27 @@ func (h *TagsHandler) Update(c *gin.Context) {
 		return
 	}
 
-	tagExists, err := h.tagRepository.FindByName(t.Name)
+	tagExists, err := h.tags(c).FindByName(c.Request.Context(), t.Name)
 	if err == nil && tagExists.ID != uint(id) {
-		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, fmt.Sprintf("Tag '%s' already exists", t.Name))
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "Tag '{0}' already exists", t.Name)
 		return
 	}
 
-	tag, err := h.tagRepository.Update(id, t)
+	tag, err := h.tags(c).Update(c.Request.Context(), id, t)
 	if err != nil {
 		h.responseHandler.InternalServerError(c)
 		return
 	}
 
+	h.auditLog.Log(c, AuditTagUpdated, auditTarget("tag", tag.ID), &before, tag)
 	h.responseHandler.JSON(c, http.StatusOK, tag)
 }
+
+func (h *TagsHandler) tags(c *gin.Context) TagRepository {
+	var owner uint
+	if user, err := h.requestHandler.GetUser(c); err == nil {
+		owner = user.ID
+	}
+
+	return h.tagRepository.InWorkspace(h.requestHandler.GetWorkspaceId(c), owner)
+}
@@ -112,7 +112,7 @@ func TestTagsHandler_ListSuccessPage2(t *testing.T) {
 }
 
 func TestTagsHandler_DeleteSuccess(t *testing.T) {
-	tag := &Tag{Name: "Go"}
+	tag := &Tag{Name: "Go", CreatedById: 1}
 	app.Db().Create(&tag)
 	req, _ := http.NewRequest(http.MethodDelete, fmt.Sprintf("/v1/tags/%d", tag.ID), nil)
 	req.Header.Set(
@@ -241,7 +241,7 @@ func TestTagsHandler_CreateValidationErrors(t *testing.T) {
 			return false
 		}
 
-		expectedDetail := "Field validation for 'Name' failed on the 'required' tag [Key: 'Tag.Name']"
+		expectedDetail := "name is a required field"
 		if data.Errors[0].Detail != expectedDetail {
 			t.Errorf("Expected '%s', got '%s'", expectedDetail, data.Errors[0].Detail)
 			return false
@@ -311,7 +311,7 @@ func TestTagsHandler_UpdateValidationErrors(t *testing.T) {
 			return false
 		}
 
-		expectedDetail := "Field validation for 'Name' failed on the 'required' tag [Key: 'Tag.Name']"
+		expectedDetail := "name is a required field"
 		if data.Errors[0].Detail != expectedDetail {
 			t.Errorf("Expected '%s', got '%s'", expectedDetail, data.Errors[0].Detail)
 			return false
@@ -376,3 +376,46 @@ func TestTagsHandler_UpdateNameCanRemainTheSame(t *testing.T) {
 		return true
 	})
 }
+
+func TestTagsHandler_PersonalTagsOfAnotherUserAreNotFound(t *testing.T) {
+	token := createAccessToken(2)
+	data, _ := json.Marshal(Tag{Name: "Renamed"})
+
+	for _, method := range []string{http.MethodGet, http.MethodPatch, http.MethodDelete} {
+		req, _ := http.NewRequest(method, "/v1/tags/1", bytes.NewBuffer(data))
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+		testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+			if w.Code != http.StatusNotFound {
+				t.Errorf("Expected status code 404 for %s, got '%d'", method, w.Code)
+				return false
+			}
+
+			return true
+		})
+	}
+
+	tag := new(Tag)
+	if app.Db().First(tag, 1); tag.Name != "Tag 1" {
+		t.Errorf("Expected the tag to be unchanged, got '%s'", tag.Name)
+	}
+}
+
+func TestTagsHandler_ListOnlyShowsOwnPersonalTags(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/v1/tags", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", createAccessToken(2)))
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		var data struct {
+			Tags []*Tag `json:"data"`
+		}
+		json.NewDecoder(w.Body).Decode(&data)
+
+		if len(data.Tags) != 0 {
+			t.Errorf("Expected no tags, got '%d'", len(data.Tags))
+			return false
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type TwoFactorHandler struct {
+	db              *gorm.DB
+	twoFactor       *TwoFactorService
+	responseHandler ResponseHandler
+	requestHandler  RequestHandler
+	validator       *validator.Validate
+	auditLog        *AuditLog
+}
+
+func InitTwoFactorHandler(app *App) *TwoFactorHandler {
+	h := &TwoFactorHandler{
+		app.Db(),
+		NewTwoFactorService(app.Db()),
+		app.ResponseHandler(),
+		app.RequestHandler(),
+		app.Validator(),
+		app.AuditLog(),
+	}
+
+	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	oauth2Only := NewOAuth2OnlyMiddleware(app)
+
+	me := app.Engine().Group("/v1/me", authMiddleware, rateLimit, oauth2Only)
+	{
+		me.POST("/2fa", h.Enrol)
+		me.POST("/2fa/confirm", h.Confirm)
+	}
+
+	return h
+}
+
+func (h *TwoFactorHandler) Enrol(c *gin.Context) {
+	user, err := h.loadUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	if user.TOTPEnabled {
+		h.responseHandler.Error(c, Conflict, http.StatusConflict, "Two-factor authentication is already enabled")
+		return
+	}
+
+	enrolment, err := h.twoFactor.Enrol(user)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusCreated, enrolment)
+}
+
+func (h *TwoFactorHandler) Confirm(c *gin.Context) {
+	data := struct {
+		Code string `json:"code" validate:"required"`
+	}{}
+
+	if err := c.BindJSON(&data); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(data); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	user, err := h.loadUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	if !h.twoFactor.Confirm(user, data.Code) {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "Code is invalid")
+		return
+	}
+
+	user.TOTPEnabled = true
+	h.auditLog.Log(c, AuditTwoFactorEnabled, auditTarget("user", user.ID), nil, nil)
+	h.responseHandler.JSON(c, http.StatusOK, user)
+}
+
+// loadUser reads the authenticated user from the database, as users built from
+// self-contained tokens do not carry their two-factor settings
+func (h *TwoFactorHandler) loadUser(c *gin.Context) (*User, error) {
+	u, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	user := new(User)
+	if err := h.db.First(user, u.ID).Error; err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
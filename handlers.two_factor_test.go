@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"encoding/json"
+	"fmt"
+	"bytes"
+	"time"
+	"github.com/pquerna/otp/totp"
+)
+
+func enrolTwoFactor(t *testing.T, userId uint) *TOTPEnrolment {
+	token := createAccessToken(userId)
+
+	req, _ := http.NewRequest(http.MethodPost, "/v1/me/2fa", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w := httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return nil
+	}
+
+	data := struct {
+		Enrolment *TOTPEnrolment `json:"data"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	code, _ := totp.GenerateCode(data.Enrolment.Secret, time.Now())
+	req, _ = http.NewRequest(http.MethodPost, "/v1/me/2fa/confirm", bytes.NewBufferString(fmt.Sprintf(`{"code": "%s"}`, code)))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	w = httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return nil
+	}
+
+	return data.Enrolment
+}
+
+func TestTwoFactorHandler_PasswordGrantRequiresOTP(t *testing.T) {
+	enrolment := enrolTwoFactor(t, 3)
+	if enrolment == nil {
+		return
+	}
+
+	if len(enrolment.RecoveryCodes) != recoveryCodeCount {
+		t.Errorf("Expected '%d' recovery codes, got '%d'", recoveryCodeCount, len(enrolment.RecoveryCodes))
+		return
+	}
+
+	password := func(otp string) *httptest.ResponseRecorder {
+		params := url.Values{"grant_type": {"password"}, "username": {"test3@go-notes.com"}, "password": {"password"}, "scope": {"email"}}
+		if otp != "" {
+			params.Add("otp", otp)
+		}
+
+		return requestToken(app, "1", "secret", params)
+	}
+
+	w := password("")
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code 403, got '%d'", w.Code)
+		return
+	}
+
+	data := struct {
+		Errors []*ErrorObject `json:"errors"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	if data.Errors[0].Title != MFARequired {
+		t.Errorf("Expected error '%s', got '%s'", MFARequired, data.Errors[0].Title)
+		return
+	}
+
+	// The code of the current step was used to confirm enrolment, so the next one is
+	// used here, which is accepted as drift
+	mfaToken, _ := data.Errors[0].Meta["mfa_token"].(string)
+	code, _ := totp.GenerateCode(enrolment.Secret, time.Now().Add(totpPeriod*time.Second))
+	complete := url.Values{"grant_type": {"assertion"}, "assertion_type": {MFAAssertionType}, "assertion": {mfaToken}, "otp": {code}}
+
+	if w := requestToken(app, "1", "secret", complete); w.Code != http.StatusCreated {
+		t.Errorf("Expected MFA token to complete login, got '%d'", w.Code)
+		return
+	}
+
+	if w := requestToken(app, "1", "secret", complete); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected MFA token to be single use, got '%d'", w.Code)
+		return
+	}
+
+	if w := password(code); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected TOTP code to be single use, got '%d'", w.Code)
+		return
+	}
+
+	if w := password("000000x"); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected invalid code to be rejected, got '%d'", w.Code)
+		return
+	}
+
+	if w := password(enrolment.RecoveryCodes[0]); w.Code != http.StatusCreated {
+		t.Errorf("Expected recovery code to be accepted, got '%d'", w.Code)
+		return
+	}
+
+	if w := password(enrolment.RecoveryCodes[0]); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected recovery code to be single use, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestTwoFactorHandler_RecoveryCodesAreStoredHashed(t *testing.T) {
+	enrolment := enrolTwoFactor(t, 1)
+	if enrolment == nil {
+		return
+	}
+
+	defer app.Db().Model(&User{}).Where("id = ?", 1).UpdateColumns(map[string]interface{}{"totp_enabled": false, "totp_secret": ""})
+
+	var count int
+	app.Db().Model(&UserRecoveryCode{}).Where("code_hash IN (?)", enrolment.RecoveryCodes).Count(&count)
+
+	if count != 0 {
+		t.Error("Expected recovery codes not to be stored in plain text")
+	}
+}
+
+func TestTwoFactorService_ChallengeAllowsFewAttempts(t *testing.T) {
+	key, _ := totp.Generate(totp.GenerateOpts{Issuer: totpIssuer, AccountName: "mfa-attempts@go-notes.com"})
+	user := &User{Email: "mfa-attempts@go-notes.com", TOTPSecret: key.Secret(), TOTPEnabled: true}
+	app.Db().Create(user)
+	defer app.Db().Delete(user)
+
+	s := NewTwoFactorService(app.Db())
+	token, _ := s.Challenge(user, "1", "email")
+
+	for i := 0; i < mfaChallengeMaxAttempts; i++ {
+		challenge, u, err := s.FindChallenge(token, "1")
+		if err != nil {
+			t.Fatalf("Expected challenge to be found, got '%s'", err.Error())
+		}
+
+		if ok, err := s.CompleteChallenge(challenge, u, "000000x"); ok || err != nil {
+			t.Errorf("Expected an incorrect code to be rejected, got '%t', '%v'", ok, err)
+		}
+	}
+
+	challenge, u, _ := s.FindChallenge(token, "1")
+	code, _ := totp.GenerateCode(key.Secret(), time.Now())
+
+	if ok, err := s.CompleteChallenge(challenge, u, code); ok || err != ErrMFAChallengeInvalid {
+		t.Errorf("Expected challenge to be void after %d attempts, got '%t', '%v'", mfaChallengeMaxAttempts, ok, err)
+	}
+
+	if _, _, err := s.FindChallenge(token, "1"); err != ErrMFAChallengeInvalid {
+		t.Errorf("Expected void challenge to be deleted, got '%v'", err)
+	}
+}
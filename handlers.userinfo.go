@@ -0,0 +1,50 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type UserInfoHandler struct {
+	responseHandler ResponseHandler
+	requestHandler  RequestHandler
+}
+
+func InitUserInfoHandler(app *App) *UserInfoHandler {
+	h := &UserInfoHandler{
+		app.ResponseHandler(),
+		app.RequestHandler(),
+	}
+
+	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+
+	app.Engine().GET("/userinfo", authMiddleware, rateLimit, h.UserInfo)
+	app.Engine().POST("/userinfo", authMiddleware, rateLimit, h.UserInfo)
+
+	return h
+}
+
+// UserInfo returns the claims about the authenticated user as a bare JSON object, as
+// expected by OpenID Connect clients
+func (h *UserInfoHandler) UserInfo(c *gin.Context) {
+	token, err := h.requestHandler.GetToken(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	if !hasScope(token.Scope, ScopeOpenID) {
+		c.Header("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		h.responseHandler.Error(c, Forbidden, http.StatusForbidden, "The access token was not granted the 'openid' scope")
+		return
+	}
+
+	c.JSON(http.StatusOK, NewUserInfoClaims(user, token.Scope))
+}
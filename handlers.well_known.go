@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type WellKnownHandler struct {
+	keySet       *KeySet
+	oauth2Config *OAuth2Config
+}
+
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+func InitWellKnownHandler(app *App) *WellKnownHandler {
+	h := &WellKnownHandler{
+		app.KeySet(),
+		app.OAuth2Config(),
+	}
+
+	app.Engine().GET("/.well-known/jwks.json", h.JWKS)
+	app.Engine().GET("/.well-known/openid-configuration", h.OpenIDConfiguration)
+
+	return h
+}
+
+func (h *WellKnownHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, h.keySet.JWKS())
+}
+
+func (h *WellKnownHandler) OpenIDConfiguration(c *gin.Context) {
+	issuer := h.oauth2Config.Issuer
+
+	c.JSON(http.StatusOK, &OpenIDConfiguration{
+		Issuer:           issuer,
+		TokenEndpoint:    issuer + "/token",
+		UserInfoEndpoint: issuer + "/userinfo",
+		JWKSURI:          issuer + "/.well-known/jwks.json",
+		ScopesSupported:  []string{ScopeOpenID, ScopeEmail, ScopeProfile},
+		// Tokens are only issued directly from the token endpoint, there is no
+		// authorization endpoint
+		ResponseTypesSupported:            []string{},
+		GrantTypesSupported:               []string{"password", "refresh_token"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{h.oauth2Config.SigningAlgorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "email", "given_name", "family_name"},
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+)
+
+func TestWellKnownHandler_JWKS(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code 200, got '%d'", w.Code)
+			return false
+		}
+
+		jwks := new(JSONWebKeySet)
+		if err := json.Unmarshal(w.Body.Bytes(), jwks); err != nil {
+			t.Error("Failed to unmarshal json")
+			return false
+		}
+
+		current, _ := app.KeySet().Current()
+
+		var key *JSONWebKey
+		for _, k := range jwks.Keys {
+			if k.Kid == current.ID {
+				key = k
+			}
+		}
+
+		if key == nil || key.Kty != "RSA" || key.Alg != SigningAlgorithmRS256 || key.N == "" {
+			t.Errorf("Expected the current key '%s' to be published, got '%+v'", current.ID, jwks.Keys)
+			return false
+		}
+
+		return true
+	})
+}
+
+func TestWellKnownHandler_OpenIDConfiguration(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/.well-known/openid-configuration", nil)
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		if w.Code != http.StatusOK {
+			t.Errorf("Expected status code 200, got '%d'", w.Code)
+			return false
+		}
+
+		config := new(OpenIDConfiguration)
+		if err := json.Unmarshal(w.Body.Bytes(), config); err != nil {
+			t.Error("Failed to unmarshal json")
+			return false
+		}
+
+		issuer := app.OAuth2Config().Issuer
+		if config.Issuer != issuer || config.JWKSURI != issuer+"/.well-known/jwks.json" || config.TokenEndpoint != issuer+"/token" || config.UserInfoEndpoint != issuer+"/userinfo" {
+			t.Errorf("Unexpected endpoints '%+v'", config)
+			return false
+		}
+
+		if len(config.IDTokenSigningAlgValuesSupported) != 1 || config.IDTokenSigningAlgValuesSupported[0] != app.OAuth2Config().SigningAlgorithm {
+			t.Errorf("Unexpected signing algorithms '%v'", config.IDTokenSigningAlgValuesSupported)
+			return false
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"gopkg.in/go-playground/validator.v9"
+)
+
+type WorkspacesHandler struct {
+	workspaceRepository WorkspaceRepository
+	responseHandler     ResponseHandler
+	requestHandler      RequestHandler
+	validator           *validator.Validate
+	auditLog            *AuditLog
+	mailer              Mailer
+}
+
+func InitWorkspacesHandler(app *App) *WorkspacesHandler {
+	h := &WorkspacesHandler{
+		NewWorkspaceRepository(app.Db()),
+		app.ResponseHandler(),
+		app.RequestHandler(),
+		app.Validator(),
+		app.AuditLog(),
+		app.Mailer(),
+	}
+
+	authMiddleware := NewAuthMiddleware(app)
+	rateLimit := NewRateLimitMiddleware(app)
+	canWrite := NewPermissionMiddleware(app, PermissionNotesWrite)
+	isMember := NewWorkspaceMiddleware(app, PermissionNotesRead)
+	isOwner := NewWorkspaceMiddleware(app, PermissionWorkspaceManage)
+
+	v1 := app.Engine().Group("/v1", authMiddleware, rateLimit)
+	{
+		v1.GET("/workspaces", h.List)
+		v1.POST("/workspaces", canWrite, h.Create)
+		v1.GET("/workspaces/:ws", isMember, h.Get)
+		v1.PATCH("/workspaces/:ws", isOwner, h.Update)
+		v1.DELETE("/workspaces/:ws", isOwner, h.Delete)
+		v1.GET("/workspaces/:ws/members", isMember, h.ListMembers)
+		v1.PATCH("/workspaces/:ws/members/:user", isOwner, h.UpdateMember)
+		v1.DELETE("/workspaces/:ws/members/:user", isMember, h.RemoveMember)
+		v1.POST("/workspaces/:ws/invitations", isOwner, h.Invite)
+		v1.POST("/invitations/accept", h.AcceptInvitation)
+	}
+
+	return h
+}
+
+func (h *WorkspacesHandler) List(c *gin.Context) {
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	workspaces, err := h.workspaceRepository.FindByUserId(c.Request.Context(), int(user.ID))
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, workspaces)
+}
+
+func (h *WorkspacesHandler) Create(c *gin.Context) {
+	w := new(Workspace)
+
+	if err := c.BindJSON(w); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(w); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	w.CreatedById = user.ID
+	workspace, err := h.workspaceRepository.Create(c.Request.Context(), w)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditWorkspaceCreated, auditTarget("workspace", workspace.ID), nil, workspace)
+	h.responseHandler.JSON(c, http.StatusCreated, workspace)
+}
+
+func (h *WorkspacesHandler) Get(c *gin.Context) {
+	workspace, err := h.workspaceRepository.FindById(c.Request.Context(), int(h.requestHandler.GetWorkspaceId(c)))
+	if err != nil {
+		h.responseHandler.NotFound(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, workspace)
+}
+
+func (h *WorkspacesHandler) Update(c *gin.Context) {
+	w := new(Workspace)
+
+	if err := c.BindJSON(w); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(w); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	before, err := h.workspaceRepository.FindById(c.Request.Context(), int(h.requestHandler.GetWorkspaceId(c)))
+	if err != nil {
+		h.responseHandler.NotFound(c)
+		return
+	}
+
+	workspace, err := h.workspaceRepository.Update(c.Request.Context(), int(before.ID), w)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditWorkspaceUpdated, auditTarget("workspace", workspace.ID), before, workspace)
+
+	h.responseHandler.JSON(c, http.StatusOK, workspace)
+}
+
+func (h *WorkspacesHandler) Delete(c *gin.Context) {
+	workspace, err := h.workspaceRepository.FindById(c.Request.Context(), int(h.requestHandler.GetWorkspaceId(c)))
+	if err != nil {
+		h.responseHandler.NotFound(c)
+		return
+	}
+
+	if err := h.workspaceRepository.Delete(c.Request.Context(), workspace); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditWorkspaceDeleted, auditTarget("workspace", workspace.ID), workspace, nil)
+
+	h.responseHandler.JSON(c, http.StatusNoContent, "")
+}
+
+func (h *WorkspacesHandler) ListMembers(c *gin.Context) {
+	members, err := h.workspaceRepository.FindMembers(c.Request.Context(), h.requestHandler.GetWorkspaceId(c))
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.responseHandler.JSON(c, http.StatusOK, members)
+}
+
+func (h *WorkspacesHandler) UpdateMember(c *gin.Context) {
+	member, ok := h.findMember(c)
+	if !ok {
+		return
+	}
+
+	data := struct {
+		Role string `json:"role" validate:"required,oneof=owner editor viewer"`
+	}{}
+
+	if err := c.BindJSON(&data); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(data); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	if member.Role == WorkspaceRoleOwner && data.Role != WorkspaceRoleOwner && h.isLastOwner(c, member) {
+		return
+	}
+
+	before := *member
+	if err := h.workspaceRepository.SetMemberRole(c.Request.Context(), member, data.Role); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	member.Role = data.Role
+	h.auditLog.Log(c, AuditWorkspaceMemberUpdated, auditTarget("workspace", member.WorkspaceId), &before, member)
+	h.responseHandler.JSON(c, http.StatusOK, member)
+}
+
+// RemoveMember lets owners remove anyone, and other members leave
+func (h *WorkspacesHandler) RemoveMember(c *gin.Context) {
+	member, ok := h.findMember(c)
+	if !ok {
+		return
+	}
+
+	self, _ := c.Get("workspace_member")
+	if self.(*WorkspaceMember).UserId != member.UserId && !self.(*WorkspaceMember).Can(PermissionWorkspaceManage) {
+		h.responseHandler.Error(c, Forbidden, http.StatusForbidden, "Your workspace role does not allow this")
+		return
+	}
+
+	if member.Role == WorkspaceRoleOwner && h.isLastOwner(c, member) {
+		return
+	}
+
+	if err := h.workspaceRepository.RemoveMember(c.Request.Context(), member); err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditWorkspaceMemberRemoved, auditTarget("workspace", member.WorkspaceId), member, nil)
+
+	h.responseHandler.JSON(c, http.StatusNoContent, "")
+}
+
+// Invite mails the invitation token to the invitee. It is not returned, as only the
+// invited address may see it.
+func (h *WorkspacesHandler) Invite(c *gin.Context) {
+	i := new(WorkspaceInvitation)
+
+	if err := c.BindJSON(i); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(i); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	i.WorkspaceId = h.requestHandler.GetWorkspaceId(c)
+	i.InvitedById = user.ID
+
+	workspace, err := h.workspaceRepository.FindById(c.Request.Context(), int(i.WorkspaceId))
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	invitation, token, err := h.workspaceRepository.CreateInvitation(c.Request.Context(), i)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	if err := h.mailer.Send(c.Request.Context(), NewInvitationMail(invitation, workspace, user, token)); err != nil {
+		h.requestHandler.GetLogger(c).Error("Could not send invitation", "error", err)
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditWorkspaceShared, auditTarget("workspace", invitation.WorkspaceId), nil, invitation)
+	h.responseHandler.JSON(c, http.StatusCreated, invitation)
+}
+
+func (h *WorkspacesHandler) AcceptInvitation(c *gin.Context) {
+	data := struct {
+		Token string `json:"token" validate:"required"`
+	}{}
+
+	if err := c.BindJSON(&data); err != nil {
+		h.responseHandler.MalformedJSON(c)
+		return
+	}
+
+	if err := h.validator.Struct(data); err != nil {
+		h.responseHandler.ValidationErrors(c, err)
+		return
+	}
+
+	user, err := h.requestHandler.GetUser(c)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	member, err := h.workspaceRepository.AcceptInvitation(c.Request.Context(), data.Token, user)
+	if err == ErrInvitationInvalid {
+		h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return
+	}
+
+	h.auditLog.Log(c, AuditWorkspaceJoined, auditTarget("workspace", member.WorkspaceId), nil, member)
+	h.responseHandler.JSON(c, http.StatusOK, member)
+}
+
+func (h *WorkspacesHandler) findMember(c *gin.Context) (*WorkspaceMember, bool) {
+	userId, _ := strconv.Atoi(c.Param("user"))
+	member, err := h.workspaceRepository.FindMember(c.Request.Context(), h.requestHandler.GetWorkspaceId(c), uint(userId))
+	if err != nil {
+		h.responseHandler.NotFound(c)
+		return nil, false
+	}
+
+	return member, true
+}
+
+// isLastOwner responds with a validation error if member is the workspace's only
+// owner, as a workspace without an owner could not be managed
+func (h *WorkspacesHandler) isLastOwner(c *gin.Context, member *WorkspaceMember) bool {
+	members, err := h.workspaceRepository.FindMembers(c.Request.Context(), member.WorkspaceId)
+	if err != nil {
+		h.responseHandler.InternalServerError(c)
+		return true
+	}
+
+	for _, m := range members {
+		if m.Role == WorkspaceRoleOwner && m.ID != member.ID {
+			return false
+		}
+	}
+
+	h.responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "A workspace must have at least one owner")
+
+	return true
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"testing"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+func createUserPAT(userId uint) string {
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "workspaces", UserId: userId})
+
+	return pat
+}
+
+func createWorkspace(t *testing.T, pat string, name string) uint {
+	w := bearerRequest(http.MethodPost, "/v1/workspaces", pat, fmt.Sprintf(`{"name": "%s"}`, name))
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return 0
+	}
+
+	data := struct {
+		Workspace *Workspace `json:"data"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	return data.Workspace.ID
+}
+
+func inviteToWorkspace(t *testing.T, pat string, workspace uint, email string, role string) string {
+	path := fmt.Sprintf("/v1/workspaces/%d/invitations", workspace)
+	w := bearerRequest(http.MethodPost, path, pat, fmt.Sprintf(`{"email": "%s", "role": "%s"}`, email, role))
+	if w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return ""
+	}
+
+	if strings.Contains(w.Body.String(), "token") {
+		t.Error("Expected the invitation token to only be sent to the invitee")
+		return ""
+	}
+
+	mail := lastMailTo(email)
+	if mail == nil {
+		t.Errorf("Expected an invitation to be mailed to '%s'", email)
+		return ""
+	}
+
+	// The token is the last line of the mail
+	fields := strings.Fields(mail.Body)
+
+	return fields[len(fields)-1]
+}
+
+func TestWorkspacesHandler_NotesAreScopedToWorkspace(t *testing.T) {
+	owner := createUserPAT(2)
+	outsider := createUserPAT(3)
+	workspace := createWorkspace(t, owner, "Team")
+	notes := fmt.Sprintf("/v1/workspaces/%d/notes", workspace)
+
+	if w := bearerRequest(http.MethodPost, notes, owner, `{"title": "Team note"}`); w.Code != http.StatusCreated {
+		t.Errorf("Expected status code 201, got '%d'", w.Code)
+		return
+	}
+
+	w := bearerRequest(http.MethodGet, notes, owner, "")
+	data := struct {
+		Notes []*Note `json:"data"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	if len(data.Notes) != 1 || data.Notes[0].WorkspaceId != workspace {
+		t.Errorf("Expected the workspace note only, got '%s'", w.Body.String())
+		return
+	}
+
+	// The personal workspace does not see it
+	w = bearerRequest(http.MethodGet, "/v1/notes", owner, "")
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	for _, n := range data.Notes {
+		if n.WorkspaceId != 0 {
+			t.Errorf("Expected personal notes only, got note in workspace '%d'", n.WorkspaceId)
+			return
+		}
+	}
+
+	if w := bearerRequest(http.MethodGet, notes, outsider, ""); w.Code != http.StatusNotFound {
+		t.Errorf("Expected status code 404 for a non-member, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestWorkspacesHandler_SelectWorkspaceByHeader(t *testing.T) {
+	owner := createUserPAT(2)
+	workspace := createWorkspace(t, owner, "Header")
+	bearerRequest(http.MethodPost, fmt.Sprintf("/v1/workspaces/%d/tags", workspace), owner, `{"name": "Tag 1"}`)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/tags", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", owner))
+	req.Header.Set(WorkspaceHeader, fmt.Sprint(workspace))
+
+	w := httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+	data := struct {
+		Tags []*Tag `json:"data"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+
+	if w.Code != http.StatusOK || len(data.Tags) != 1 || data.Tags[0].WorkspaceId != workspace {
+		t.Errorf("Expected the workspace tag only, got '%s'", w.Body.String())
+		return
+	}
+}
+
+func TestWorkspacesHandler_Invitation(t *testing.T) {
+	owner := createUserPAT(2)
+	invitee := createUserPAT(3)
+	workspace := createWorkspace(t, owner, "Invitation")
+	token := inviteToWorkspace(t, owner, workspace, "test3@go-notes.com", WorkspaceRoleViewer)
+
+	// Invitations can only be accepted by the invited address
+	if w := bearerRequest(http.MethodPost, "/v1/invitations/accept", "access-token", fmt.Sprintf(`{"token": "%s"}`, token)); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code 422, got '%d'", w.Code)
+		return
+	}
+
+	if w := bearerRequest(http.MethodPost, "/v1/invitations/accept", invitee, fmt.Sprintf(`{"token": "%s"}`, token)); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	if w := bearerRequest(http.MethodPost, "/v1/invitations/accept", invitee, fmt.Sprintf(`{"token": "%s"}`, token)); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected a used invitation to be rejected, got '%d'", w.Code)
+		return
+	}
+
+	notes := fmt.Sprintf("/v1/workspaces/%d/notes", workspace)
+	if w := bearerRequest(http.MethodGet, notes, invitee, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected status code 200, got '%d'", w.Code)
+		return
+	}
+
+	if w := bearerRequest(http.MethodPost, notes, invitee, `{"title": "Viewer note"}`); w.Code != http.StatusForbidden {
+		t.Errorf("Expected status code 403 for a viewer, got '%d'", w.Code)
+		return
+	}
+}
+
+func TestWorkspacesHandler_LastOwnerCannotLeave(t *testing.T) {
+	owner := createUserPAT(2)
+	workspace := createWorkspace(t, owner, "Owner")
+
+	if w := bearerRequest(http.MethodDelete, fmt.Sprintf("/v1/workspaces/%d/members/2", workspace), owner, ""); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status code 422, got '%d'", w.Code)
+		return
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HealthStatusOK   = "ok"
+	HealthStatusWarn = "warn"
+	HealthStatusFail = "fail"
+)
+
+// HealthCheck reports whether a dependency is usable
+type HealthCheck func(ctx context.Context) error
+
+type HealthCheckResult struct {
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type HealthReport struct {
+	Status string                        `json:"status"`
+	Checks map[string]*HealthCheckResult `json:"checks"`
+}
+
+// HealthChecker runs a set of named checks concurrently, failing any that take longer
+// than timeout
+type HealthChecker struct {
+	checks   map[string]HealthCheck
+	optional map[string]bool
+	timeout  time.Duration
+}
+
+func NewHealthChecker(timeout time.Duration) *HealthChecker {
+	return &HealthChecker{map[string]HealthCheck{}, map[string]bool{}, timeout}
+}
+
+func (h *HealthChecker) Add(name string, check HealthCheck) {
+	h.checks[name] = check
+}
+
+// AddOptional adds a check for something requests don't depend on. It is reported
+// with a warning when it fails, but the report still passes.
+func (h *HealthChecker) AddOptional(name string, check HealthCheck) {
+	h.checks[name] = check
+	h.optional[name] = true
+}
+
+func (h *HealthChecker) Check(ctx context.Context) *HealthReport {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	report := &HealthReport{Status: HealthStatusOK, Checks: map[string]*HealthCheckResult{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for name, check := range h.checks {
+		wg.Add(1)
+
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+
+			result := &HealthCheckResult{Status: HealthStatusOK}
+			start := time.Now()
+			err := runHealthCheck(ctx, check)
+			result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil && h.optional[name] {
+				result.Status = HealthStatusWarn
+				result.Error = err.Error()
+			} else if err != nil {
+				result.Status = HealthStatusFail
+				result.Error = err.Error()
+				report.Status = HealthStatusFail
+			}
+
+			report.Checks[name] = result
+		}(name, check)
+	}
+
+	wg.Wait()
+
+	return report
+}
+
+// runHealthCheck returns when check does or ctx is done, whichever is first, as not
+// every check can be interrupted
+func runHealthCheck(ctx context.Context, check HealthCheck) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- check(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return errors.New("Timed out")
+	}
+}
+
+func DatabaseHealthCheck(db *gorm.DB) HealthCheck {
+	return func(ctx context.Context) error {
+		return db.DB().PingContext(ctx)
+	}
+}
+
+func MigrationsHealthCheck(db *gorm.DB) HealthCheck {
+	return func(ctx context.Context) error {
+		pending, err := NewMigrator(db).unapplied(ctx)
+		if err != nil {
+			return err
+		}
+
+		if len(pending) > 0 {
+			return fmt.Errorf("%d migrations are pending", len(pending))
+		}
+
+		return nil
+	}
+}
+
+func TokenJanitorHealthCheck(j *TokenJanitor) HealthCheck {
+	return func(ctx context.Context) error {
+		if !j.Running() {
+			return errors.New("Token janitor is not running")
+		}
+
+		if j.Stale() {
+			return errors.New("Token janitor has not pruned tokens recently")
+		}
+
+		return nil
+	}
+}
+
+// DiskHealthCheck fails when the filesystem holding dir has less than minFree bytes
+// available
+func DiskHealthCheck(dir string, minFree uint64) HealthCheck {
+	return func(ctx context.Context) error {
+		free, err := freeDiskSpace(dir)
+		if err != nil {
+			return err
+		}
+
+		if free < minFree {
+			return fmt.Errorf("%d MB free, at least %d MB is required", free>>20, minFree>>20)
+		}
+
+		return nil
+	}
+}
+
+// sqliteDir returns the directory of a SQLite database file, or "" for in-memory
+// databases
+func sqliteDir(dsn string) string {
+	path := strings.TrimPrefix(strings.SplitN(dsn, "?", 2)[0], "file:")
+	if path == "" || path == ":memory:" {
+		return ""
+	}
+
+	return filepath.Dir(path)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// A janitor that has not pruned tokens for this many intervals is reported unhealthy
+const tokenJanitorStaleIntervals = 3
+
+// TokenJanitor periodically purges expired and orphaned OAuth2 tokens
+type TokenJanitor struct {
+	db        *gorm.DB
+	interval  time.Duration
+	batchSize int
+	mu        sync.Mutex
+	stop      chan struct{}
+	done      chan struct{}
+	// When tokens were last pruned successfully, or when the janitor was started.
+	// Guarded by its own mutex, as Stop holds mu while waiting for run to return.
+	lastRunMu sync.Mutex
+	lastRun   time.Time
+}
+
+func NewTokenJanitor(db *gorm.DB, interval time.Duration, batchSize int) *TokenJanitor {
+	return &TokenJanitor{
+		db:        db,
+		interval:  interval,
+		batchSize: batchSize,
+	}
+}
+
+func (j *TokenJanitor) Start() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.stop != nil {
+		return
+	}
+
+	j.stop = make(chan struct{})
+	j.done = make(chan struct{})
+	j.setLastRun(time.Now())
+
+	go j.run(j.stop, j.done)
+}
+
+func (j *TokenJanitor) Running() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.stop != nil
+}
+
+// Stale reports whether the janitor has failed to prune tokens for too long
+func (j *TokenJanitor) Stale() bool {
+	j.lastRunMu.Lock()
+	defer j.lastRunMu.Unlock()
+
+	return time.Since(j.lastRun) > tokenJanitorStaleIntervals*j.interval
+}
+
+func (j *TokenJanitor) setLastRun(t time.Time) {
+	j.lastRunMu.Lock()
+	defer j.lastRunMu.Unlock()
+
+	j.lastRun = t
+}
+
+func (j *TokenJanitor) Stop() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.stop == nil {
+		return
+	}
+
+	close(j.stop)
+	<-j.done
+
+	j.stop = nil
+	j.done = nil
+}
+
+func (j *TokenJanitor) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := PruneTokens(j.db, j.batchSize); err != nil {
+				slog.Error("Could not prune tokens", "error", err)
+				continue
+			}
+
+			j.setLastRun(time.Now())
+		}
+	}
+}
+
+// PruneTokens deletes expired tokens, tokens whose client or user no longer exists,
+// expired denylist entries and MFA challenges, batchSize rows at a time. It returns the number of deleted rows.
+func PruneTokens(db *gorm.DB, batchSize int) (int, error) {
+	now := time.Now()
+	users := db.Model(&User{}).Select("id").QueryExpr()
+	clients := db.Model(&OAuth2Client{}).Select("id").QueryExpr()
+	total := 0
+
+	for _, model := range []interface{}{&OAuth2RefreshToken{}, &OAuth2AccessToken{}} {
+		scopes := []*gorm.DB{
+			db.Where("expires < ?", now),
+			db.Where("user_id NOT IN (?)", users),
+			db.Where("client_id NOT IN (?)", clients),
+		}
+
+		for _, scope := range scopes {
+			n, err := deleteInBatches(scope.Model(model), model, batchSize)
+			total += n
+
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+
+	for _, model := range []interface{}{&OAuth2RevokedToken{}, &MFAChallenge{}} {
+		n, err := deleteInBatches(db.Where("expires < ?", now).Model(model), model, batchSize)
+		total += n
+
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+func deleteInBatches(query *gorm.DB, model interface{}, batchSize int) (int, error) {
+	total := 0
+
+	for {
+		var ids []uint
+		if err := query.Limit(batchSize).Pluck("id", &ids).Error; err != nil {
+			return total, err
+		}
+
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		if err := query.New().Where("id IN (?)", ids).Delete(model).Error; err != nil {
+			return total, err
+		}
+
+		total += len(ids)
+
+		if len(ids) < batchSize {
+			return total, nil
+		}
+	}
+}
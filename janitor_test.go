@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+	"github.com/satori/go.uuid"
+)
+
+func TestPruneTokens(t *testing.T) {
+	expired := &OAuth2AccessToken{AccessToken: uuid.NewV4().String(), Expires: time.Now().Add(-time.Hour), ClientId: 1, UserId: 1}
+	orphaned := &OAuth2AccessToken{AccessToken: uuid.NewV4().String(), Expires: time.Now().Add(time.Hour), ClientId: 1, UserId: 999}
+	valid := &OAuth2AccessToken{AccessToken: uuid.NewV4().String(), Expires: time.Now().Add(time.Hour), ClientId: 1, UserId: 1}
+	expiredRefresh := &OAuth2RefreshToken{RefreshToken: uuid.NewV4().String(), Expires: time.Now().Add(-time.Hour), ClientId: 1, UserId: 1}
+
+	for _, token := range []interface{}{expired, orphaned, valid, expiredRefresh} {
+		if err := app.Db().Create(token).Error; err != nil {
+			t.Errorf("Could not create token: '%s'", err.Error())
+			return
+		}
+	}
+
+	if _, err := PruneTokens(app.Db(), 1); err != nil {
+		t.Errorf("Could not prune tokens: '%s'", err.Error())
+		return
+	}
+
+	for _, id := range []uint{expired.ID, orphaned.ID} {
+		if !app.Db().First(&OAuth2AccessToken{}, id).RecordNotFound() {
+			t.Errorf("Expected access token '%d' to be pruned", id)
+		}
+	}
+
+	if !app.Db().First(&OAuth2RefreshToken{}, expiredRefresh.ID).RecordNotFound() {
+		t.Errorf("Expected refresh token '%d' to be pruned", expiredRefresh.ID)
+	}
+
+	if app.Db().First(&OAuth2AccessToken{}, valid.ID).RecordNotFound() {
+		t.Errorf("Expected access token '%d' to be kept", valid.ID)
+	}
+}
+
+func TestTokenJanitor_StartStop(t *testing.T) {
+	expired := &OAuth2AccessToken{AccessToken: uuid.NewV4().String(), Expires: time.Now().Add(-time.Hour), ClientId: 1, UserId: 1}
+	if err := app.Db().Create(expired).Error; err != nil {
+		t.Fatalf("Could not create token: '%s'", err.Error())
+	}
+
+	j := NewTokenJanitor(app.Db(), time.Millisecond, 100)
+	if j.Running() {
+		t.Errorf("Expected janitor not to be running before start")
+	}
+
+	j.Start()
+	j.Start()
+	if !j.Running() {
+		t.Errorf("Expected janitor to be running after start")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !app.Db().First(&OAuth2AccessToken{}, expired.ID).RecordNotFound() {
+		if time.Now().After(deadline) {
+			t.Errorf("Expected access token '%d' to be pruned while running", expired.ID)
+			break
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	j.Stop()
+	j.Stop()
+	if j.Running() {
+		t.Errorf("Expected janitor not to be running after stop")
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// NewLogger writes JSON, or logfmt if format is text, at or above the configured level.
+// Attributes and query parameters that look like secrets are redacted.
+func NewLogger(config LogConfig, w io.Writer) *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(config.Level))
+
+	options := &slog.HandlerOptions{Level: level, ReplaceAttr: redactAttr}
+
+	if config.Format == "text" {
+		return slog.New(slog.NewTextHandler(w, options))
+	}
+
+	return slog.New(slog.NewJSONHandler(w, options))
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if isSecret(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+
+	return a
+}
+
+// isSecret reports whether a log attribute or query parameter named key may hold a
+// password, token or other credential
+func isSecret(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, s := range []string{"password", "secret", "token", "authorization", "cookie"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+
+	return key == "code" || key == "code_verifier" || key == "otp"
+}
+
+// redactedURL returns the path and query of u with the values of secret parameters
+// replaced
+func redactedURL(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.Path
+	}
+
+	query := u.Query()
+	for key := range query {
+		if isSecret(key) {
+			query.Set(key, redacted)
+		}
+	}
+
+	return u.Path + "?" + query.Encode()
+}
+
+// LogQueries logs every query at debug level and those slower than slowQuery at warn
+// level, or none if slowQuery is 0. Bound values are left out, as they hold user data
+// and credentials.
+func LogQueries(db *gorm.DB, logger *slog.Logger, slowQuery time.Duration) {
+	db.LogMode(false)
+
+	start := func(scope *gorm.Scope) {
+		scope.InstanceSet("logger:start", time.Now())
+	}
+
+	finish := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			started, ok := scope.InstanceGet("logger:start")
+			if !ok {
+				return
+			}
+
+			duration := time.Since(started.(time.Time))
+			attrs := []interface{}{
+				"operation", operation,
+				"table", scope.TableName(),
+				"sql", scope.SQL,
+				"duration_ms", float64(duration.Microseconds()) / 1000,
+			}
+
+			if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+				logger.Error("Query failed", append(attrs, "error", err.Error())...)
+			} else if slowQuery > 0 && duration >= slowQuery {
+				logger.Warn("Slow query", attrs...)
+			} else {
+				logger.Debug("Query", attrs...)
+			}
+		}
+	}
+
+	registerQueryCallbacks(db, "logger", start, finish)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"testing"
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+func TestLoggerMiddleware_GeneratesRequestId(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/v1/notes/9999", nil)
+	req.Header.Set("Authorization", "Bearer access-token")
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		id := w.Header().Get(RequestIdHeader)
+		if id == "" {
+			t.Errorf("Expected a request ID to be generated")
+			return false
+		}
+
+		body := struct {
+			Errors []*ErrorObject `json:"errors"`
+		}{}
+
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil || len(body.Errors) != 1 {
+			t.Errorf("Could not decode errors")
+			return false
+		}
+
+		if body.Errors[0].RequestId != id {
+			t.Errorf("Expected error to have request ID '%s', got '%s'", id, body.Errors[0].RequestId)
+			return false
+		}
+
+		return true
+	})
+}
+
+func TestLoggerMiddleware_PropagatesRequestId(t *testing.T) {
+	for id, expected := range map[string]bool{"abc-123": true, "bad id\n": false} {
+		req, _ := http.NewRequest(http.MethodGet, "/healthz", nil)
+		req.Header.Set(RequestIdHeader, id)
+
+		w := httptest.NewRecorder()
+		app.Engine().ServeHTTP(w, req)
+
+		if (w.Header().Get(RequestIdHeader) == id) != expected {
+			t.Errorf("Expected request ID '%q' kept to be %t, got '%s'", id, expected, w.Header().Get(RequestIdHeader))
+		}
+	}
+}
+
+func TestLoggerMiddleware_LogsRequest(t *testing.T) {
+	buf := new(bytes.Buffer)
+	engine := gin.New()
+	engine.Use(NewLoggerMiddleware(NewLogger(LogConfig{Level: "info", Format: "json"}, buf)))
+	engine.GET("/items/:id", func(c *gin.Context) {
+		NewRequestHandler().GetLogger(c).Info("Handling")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/items/1?access_token=hunter2&page=2", nil)
+	req.Header.Set(RequestIdHeader, "req-1")
+	engine.ServeHTTP(httptest.NewRecorder(), req)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 log lines, got '%s'", buf.String())
+	}
+
+	for _, line := range lines {
+		if !strings.Contains(line, `"request_id":"req-1"`) {
+			t.Errorf("Expected line to have the request ID, got '%s'", line)
+		}
+	}
+
+	entry := map[string]interface{}{}
+	json.Unmarshal([]byte(lines[1]), &entry)
+
+	if entry["route"] != "/items/:id" || entry["status"] != float64(200) || entry["level"] != "INFO" {
+		t.Errorf("Unexpected request log '%s'", lines[1])
+	}
+
+	if strings.Contains(lines[1], "hunter2") || !strings.Contains(lines[1], "page=2") {
+		t.Errorf("Expected the token to be redacted from the path, got '%s'", lines[1])
+	}
+}
+
+func TestNewLogger_RedactsSecrets(t *testing.T) {
+	buf := new(bytes.Buffer)
+	logger := NewLogger(LogConfig{Level: "warn", Format: "text"}, buf)
+
+	logger.Info("Ignored")
+	logger.Warn("Login", "username", "test@go-notes.com", "password", "hunter2", "client_secret", "s3cret", "refresh_token", "r3fresh")
+
+	out := buf.String()
+	if strings.Contains(out, "Ignored") {
+		t.Errorf("Expected lines below the level to be dropped")
+	}
+
+	for _, secret := range []string{"hunter2", "s3cret", "r3fresh"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("Expected '%s' to be redacted, got '%s'", secret, out)
+		}
+	}
+
+	if !strings.Contains(out, "username=test@go-notes.com") || !strings.Contains(out, "level=WARN") {
+		t.Errorf("Expected a logfmt line, got '%s'", out)
+	}
+}
+
+func TestRedactedURL(t *testing.T) {
+	u, _ := url.Parse("/authorize?client_id=1&code=abc&state=xyz")
+
+	if redacted := redactedURL(u); strings.Contains(redacted, "abc") || !strings.Contains(redacted, "state=xyz") {
+		t.Errorf("Expected the code to be redacted, got '%s'", redacted)
+	}
+}
+
+func TestLogQueries_SlowQueries(t *testing.T) {
+	db, err := gorm.Open("sqlite3", "./notes-logger-test.db")
+	if err != nil {
+		t.Fatalf("Cannot connect to database: '%s'", err.Error())
+	}
+	defer os.Remove("./notes-logger-test.db")
+	defer db.Close()
+
+	db.SingularTable(true)
+	db.AutoMigrate(&Tag{})
+
+	buf := new(bytes.Buffer)
+	LogQueries(db, NewLogger(LogConfig{Level: "info", Format: "json"}, buf), time.Nanosecond)
+	defer LogQueries(db, slog.Default(), 0)
+
+	db.Create(&Tag{Name: "private-tag-name"})
+
+	out := buf.String()
+	if !strings.Contains(out, "Slow query") || !strings.Contains(out, "INSERT") {
+		t.Errorf("Expected the insert to be logged as slow, got '%s'", out)
+	}
+
+	if strings.Contains(out, "private-tag-name") {
+		t.Errorf("Expected bound values to be left out, got '%s'", out)
+	}
+}
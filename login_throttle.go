@@ -0,0 +1,250 @@
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"errors"
+	"math"
+	"sync"
+	"time"
+)
+
+// ThrottlePolicy describes how failed logins for a key are slowed down. After
+// FreeAttempts failures every further attempt has to wait BaseDelay, doubling with each
+// failure up to MaxDelay. After LockoutThreshold failures the key is locked for
+// LockoutDuration. Failures are forgotten after ResetAfter without a failure.
+type ThrottlePolicy struct {
+	FreeAttempts     int           `yaml:"free_attempts" validate:"min=0"`
+	BaseDelay        time.Duration `yaml:"base_delay" validate:"min=0"`
+	MaxDelay         time.Duration `yaml:"max_delay" validate:"gtefield=BaseDelay"`
+	LockoutThreshold int           `yaml:"lockout_threshold" validate:"gtfield=FreeAttempts"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration" validate:"min=0"`
+	ResetAfter       time.Duration `yaml:"reset_after" validate:"min=1"`
+}
+
+// RetryAfter returns how long the key of a has to wait before its next attempt
+func (p *ThrottlePolicy) RetryAfter(a *LoginAttempt, now time.Time) time.Duration {
+	if a.LockedUntil != nil && a.LockedUntil.After(now) {
+		return a.LockedUntil.Sub(now)
+	}
+
+	if a.Failures <= p.FreeAttempts || now.Sub(a.LastFailure) > p.ResetAfter {
+		return 0
+	}
+
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(a.Failures-p.FreeAttempts-1))
+	delay = math.Min(delay, float64(p.MaxDelay))
+
+	if wait := a.LastFailure.Add(time.Duration(delay)).Sub(now); wait > 0 {
+		return wait
+	}
+
+	return 0
+}
+
+// forgets reports whether the failures on a are forgotten by now, as it has been
+// quiet for ResetAfter or its lockout has run out
+func (p *ThrottlePolicy) forgets(a *LoginAttempt, now time.Time) bool {
+	return now.Sub(a.LastFailure) > p.ResetAfter || (a.LockedUntil != nil && a.LockedUntil.Before(now))
+}
+
+// fail records a failure on a and reports whether it caused a lockout
+func (p *ThrottlePolicy) fail(a *LoginAttempt, now time.Time) bool {
+	if p.forgets(a, now) {
+		a.Failures = 0
+		a.LockedUntil = nil
+	}
+
+	a.Failures++
+	a.LastFailure = now
+
+	if a.Failures >= p.LockoutThreshold && a.LockedUntil == nil {
+		lockedUntil := now.Add(p.LockoutDuration)
+		a.LockedUntil = &lockedUntil
+		return true
+	}
+
+	return false
+}
+
+// forgive takes back the last failure on a, lifting its lockout if it falls below the
+// threshold
+func (p *ThrottlePolicy) forgive(a *LoginAttempt) {
+	if a.Failures > 0 {
+		a.Failures--
+	}
+
+	if a.Failures < p.LockoutThreshold {
+		a.LockedUntil = nil
+	}
+}
+
+// LoginThrottle counts every login attempt as failed when it is made, so that a burst
+// of attempts cannot all pass the check before any of them is recorded. Attempts that
+// turn out not to have failed are taken back with Forgive or Succeed.
+type LoginThrottle interface {
+	// Attempt returns how long key has to wait before its next login attempt or, if
+	// it need not wait, counts the attempt and reports whether it locked key out
+	Attempt(key string) (time.Duration, bool, error)
+	// Forgive takes back an attempt for key that did not fail
+	Forgive(key string) error
+	// Succeed forgets the failures of key
+	Succeed(key string) error
+}
+
+type MemoryLoginThrottle struct {
+	policy   *ThrottlePolicy
+	mu       sync.Mutex
+	attempts map[string]*LoginAttempt
+	now      func() time.Time
+}
+
+func NewMemoryLoginThrottle(policy *ThrottlePolicy) LoginThrottle {
+	return &MemoryLoginThrottle{
+		policy:   policy,
+		attempts: map[string]*LoginAttempt{},
+		now:      time.Now,
+	}
+}
+
+func (t *MemoryLoginThrottle) Attempt(key string) (time.Duration, bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	a, ok := t.attempts[key]
+	if !ok {
+		a = &LoginAttempt{Key: key}
+		t.attempts[key] = a
+	}
+
+	if wait := t.policy.RetryAfter(a, now); wait > 0 {
+		return wait, false, nil
+	}
+
+	// Stop the map growing without bound under a spray of usernames
+	if len(t.attempts) > 100000 {
+		for k, v := range t.attempts {
+			if t.policy.RetryAfter(v, now) == 0 && now.Sub(v.LastFailure) > t.policy.ResetAfter {
+				delete(t.attempts, k)
+			}
+		}
+
+		t.attempts[key] = a
+	}
+
+	return 0, t.policy.fail(a, now), nil
+}
+
+func (t *MemoryLoginThrottle) Forgive(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if a, ok := t.attempts[key]; ok {
+		t.policy.forgive(a)
+	}
+
+	return nil
+}
+
+func (t *MemoryLoginThrottle) Succeed(key string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, key)
+
+	return nil
+}
+
+// loginAttemptRetries bounds how often an attempt is retried after losing a race with
+// a parallel attempt for the same key
+const loginAttemptRetries = 10
+
+var ErrLoginAttemptContended = errors.New("Too many parallel login attempts")
+
+// GORMLoginThrottle keeps failures in the database, so they are shared between
+// instances and survive restarts
+type GORMLoginThrottle struct {
+	db     *gorm.DB
+	policy *ThrottlePolicy
+	now    func() time.Time
+}
+
+func NewGORMLoginThrottle(db *gorm.DB, policy *ThrottlePolicy) LoginThrottle {
+	return &GORMLoginThrottle{db, policy, time.Now}
+}
+
+// Attempt only writes the row if it still holds the failures it was checked against,
+// and starts over if a parallel attempt got there first
+func (t *GORMLoginThrottle) Attempt(key string) (time.Duration, bool, error) {
+	for i := 0; i < loginAttemptRetries; i++ {
+		now := t.now()
+		a := new(LoginAttempt)
+
+		err := t.db.Where("throttle_key = ?", key).Find(a).Error
+		if gorm.IsRecordNotFoundError(err) {
+			a = &LoginAttempt{Key: key}
+			locked := t.policy.fail(a, now)
+
+			// Fails on the unique key if a parallel attempt created it first
+			if err := t.db.Create(a).Error; err == nil {
+				return 0, locked, nil
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return 0, false, err
+		}
+
+		if wait := t.policy.RetryAfter(a, now); wait > 0 {
+			return wait, false, nil
+		}
+
+		// Starting from a new row means a stale write cannot match it
+		if t.policy.forgets(a, now) {
+			err := t.db.Where("id = ? AND failures = ?", a.ID, a.Failures).Delete(&LoginAttempt{}).Error
+			if err != nil {
+				return 0, false, err
+			}
+
+			continue
+		}
+
+		failures := a.Failures
+		locked := t.policy.fail(a, now)
+
+		res := t.db.Model(&LoginAttempt{}).Where("id = ? AND failures = ?", a.ID, failures).UpdateColumns(map[string]interface{}{
+			"failures":     a.Failures,
+			"last_failure": a.LastFailure,
+			"locked_until": a.LockedUntil,
+		})
+
+		if res.Error != nil {
+			return 0, false, res.Error
+		}
+
+		if res.RowsAffected == 1 {
+			return 0, locked, nil
+		}
+	}
+
+	return 0, false, ErrLoginAttemptContended
+}
+
+func (t *GORMLoginThrottle) Forgive(key string) error {
+	quote := t.db.Dialect().Quote
+
+	// The lockout is set first, as MySQL assigns in order
+	return t.db.Exec(
+		"UPDATE "+quote("login_attempt")+" SET "+
+			quote("locked_until")+" = CASE WHEN "+quote("failures")+" <= ? THEN NULL ELSE "+quote("locked_until")+" END, "+
+			quote("failures")+" = "+quote("failures")+" - 1 "+
+			"WHERE "+quote("throttle_key")+" = ? AND "+quote("failures")+" > 0",
+		t.policy.LockoutThreshold, key,
+	).Error
+}
+
+func (t *GORMLoginThrottle) Succeed(key string) error {
+	return t.db.Where("throttle_key = ?", key).Delete(&LoginAttempt{}).Error
+}
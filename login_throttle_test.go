@@ -0,0 +1,168 @@
+package main
+
+import (
+	"testing"
+	"sync"
+	"time"
+)
+
+func newTestThrottlePolicy() *ThrottlePolicy {
+	return &ThrottlePolicy{
+		FreeAttempts:     2,
+		BaseDelay:        time.Second,
+		MaxDelay:         4 * time.Second,
+		LockoutThreshold: 5,
+		LockoutDuration:  time.Minute,
+		ResetAfter:       time.Hour,
+	}
+}
+
+func TestThrottlePolicy_RetryAfter(t *testing.T) {
+	p := newTestThrottlePolicy()
+	now := time.Now()
+	a := &LoginAttempt{Key: "username:test"}
+
+	for i := 0; i < 2; i++ {
+		p.fail(a, now)
+	}
+
+	if d := p.RetryAfter(a, now); d != 0 {
+		t.Errorf("Expected no delay within the free attempts, got '%s'", d)
+		return
+	}
+
+	p.fail(a, now)
+	if d := p.RetryAfter(a, now); d != time.Second {
+		t.Errorf("Expected a delay of 1s, got '%s'", d)
+		return
+	}
+
+	p.fail(a, now)
+	if d := p.RetryAfter(a, now); d != 2*time.Second {
+		t.Errorf("Expected a delay of 2s, got '%s'", d)
+		return
+	}
+
+	if locked := p.fail(a, now); !locked {
+		t.Error("Expected key to be locked out")
+		return
+	}
+
+	if d := p.RetryAfter(a, now); d != time.Minute {
+		t.Errorf("Expected a delay of 1m, got '%s'", d)
+		return
+	}
+
+	if d := p.RetryAfter(a, now.Add(2*time.Hour)); d != 0 {
+		t.Errorf("Expected failures to be forgotten, got '%s'", d)
+		return
+	}
+}
+
+func TestMemoryLoginThrottle(t *testing.T) {
+	now := time.Now()
+	throttle := NewMemoryLoginThrottle(newTestThrottlePolicy()).(*MemoryLoginThrottle)
+	throttle.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		throttle.Attempt("username:test")
+	}
+
+	if d, _, _ := throttle.Attempt("username:test"); d != time.Second {
+		t.Errorf("Expected a delay of 1s, got '%s'", d)
+		return
+	}
+
+	if d, _, _ := throttle.Attempt("username:other"); d != 0 {
+		t.Errorf("Expected no delay for another key, got '%s'", d)
+		return
+	}
+
+	throttle.Forgive("username:test")
+	if d, _, _ := throttle.Attempt("username:test"); d != 0 {
+		t.Errorf("Expected no delay after an attempt was forgiven, got '%s'", d)
+		return
+	}
+
+	throttle.Succeed("username:test")
+	if d, _, _ := throttle.Attempt("username:test"); d != 0 {
+		t.Errorf("Expected no delay after a success, got '%s'", d)
+		return
+	}
+}
+
+func TestGORMLoginThrottle(t *testing.T) {
+	now := time.Now()
+	throttle := NewGORMLoginThrottle(app.Db(), newTestThrottlePolicy()).(*GORMLoginThrottle)
+	throttle.now = func() time.Time { return now }
+
+	var locked bool
+	for i := 0; i < 5; i++ {
+		// Past the delay of the attempt before
+		now = now.Add(10 * time.Second)
+
+		var err error
+		if _, locked, err = throttle.Attempt("username:gorm-throttle"); err != nil {
+			t.Errorf("Could not record attempt: '%s'", err.Error())
+			return
+		}
+	}
+
+	if !locked {
+		t.Error("Expected key to be locked out")
+		return
+	}
+
+	if d, _, err := throttle.Attempt("username:gorm-throttle"); err != nil || d != time.Minute {
+		t.Errorf("Expected a delay of 1m, got '%s'", d)
+		return
+	}
+
+	if err := throttle.Forgive("username:gorm-throttle"); err != nil {
+		t.Errorf("Could not forgive attempt: '%s'", err.Error())
+		return
+	}
+
+	now = now.Add(10 * time.Second)
+	if d, _, _ := throttle.Attempt("username:gorm-throttle"); d != 0 {
+		t.Errorf("Expected the lockout to be lifted below the threshold, got '%s'", d)
+		return
+	}
+
+	if err := throttle.Succeed("username:gorm-throttle"); err != nil {
+		t.Errorf("Could not reset key: '%s'", err.Error())
+		return
+	}
+
+	a := new(LoginAttempt)
+	if !app.Db().Where("throttle_key = ?", "username:gorm-throttle").Find(a).RecordNotFound() {
+		t.Error("Expected failures to be forgotten after a success")
+		return
+	}
+}
+
+func TestGORMLoginThrottle_CountsParallelAttempts(t *testing.T) {
+	policy := newTestThrottlePolicy()
+	policy.FreeAttempts = 100
+	policy.LockoutThreshold = 100
+	throttle := NewGORMLoginThrottle(app.Db(), policy)
+	throttle.Succeed("username:gorm-parallel")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			throttle.Attempt("username:gorm-parallel")
+		}()
+	}
+	wg.Wait()
+
+	a := new(LoginAttempt)
+	app.Db().Where("throttle_key = ?", "username:gorm-parallel").Find(a)
+
+	if a.Failures != 10 {
+		t.Errorf("Expected 10 failures, got '%d'", a.Failures)
+		return
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+const (
+	MailDriverLog  = "log"
+	MailDriverSMTP = "smtp"
+)
+
+// Mail is a plain text email
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers mail to users, such as tokens that must only reach them
+type Mailer interface {
+	Send(ctx context.Context, m *Mail) error
+}
+
+func NewMailer(config MailConfig) (Mailer, error) {
+	switch config.Driver {
+	case MailDriverSMTP:
+		if config.Addr == "" {
+			return nil, errors.New("An SMTP server address is required")
+		}
+
+		return &SMTPMailer{config}, nil
+	default:
+		return &LogMailer{config.From}, nil
+	}
+}
+
+// LogMailer writes mail to the log instead of sending it, for development
+type LogMailer struct {
+	from string
+}
+
+func (m *LogMailer) Send(ctx context.Context, mail *Mail) error {
+	slog.InfoContext(ctx, "Mail", "from", m.from, "to", mail.To, "subject", mail.Subject, "body", mail.Body)
+
+	return nil
+}
+
+type SMTPMailer struct {
+	config MailConfig
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, mail *Mail) error {
+	// A line break would let the value add headers of its own
+	if strings.ContainsAny(mail.To+mail.Subject, "\r\n") {
+		return errors.New("Mail headers cannot contain line breaks")
+	}
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		host, _, _ := net.SplitHostPort(m.config.Addr)
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, host)
+	}
+
+	message := fmt.Sprintf(
+		"From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		m.config.From, mail.To, mail.Subject, time.Now().Format(time.RFC1123Z), strings.Replace(mail.Body, "\n", "\r\n", -1),
+	)
+
+	return smtp.SendMail(m.config.Addr, auth, m.config.From, []string{mail.To}, []byte(message))
+}
+
+// NewInvitationMail tells the invitee how to join the workspace. The token is only
+// ever sent to the invited address.
+func NewInvitationMail(invitation *WorkspaceInvitation, workspace *Workspace, inviter *User, token string) *Mail {
+	return &Mail{
+		To:      invitation.Email,
+		Subject: "You have been invited to a workspace",
+		Body: fmt.Sprintf(
+			"%s invited you to the workspace %s as %s.\n\nTo join, sign in and accept the invitation at POST /v1/invitations/accept with this token before %s:\n\n%s\n",
+			inviter.Email, workspace.Name, invitation.Role, invitation.Expires.Format(time.RFC1123), token,
+		),
+	}
+}
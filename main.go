@@ -1,6 +1,31 @@
 package main
 
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
 func main() {
-	app := InitApp()
-	app.Run()
+	config, args, err := LoadConfig(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	slog.SetDefault(NewLogger(config.Log, os.Stdout))
+
+	if len(args) > 0 {
+		if err := RunCommand(config, args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
+	if err := InitApp(config).Run(); err != nil {
+		slog.Error("Server stopped", "error", err)
+		os.Exit(1)
+	}
 }
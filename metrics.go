@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"sync"
+	"time"
+)
+
+const (
+	RevocationToken   = "token"
+	RevocationSession = "session"
+	RevocationClient  = "client"
+	RevocationUser    = "user"
+)
+
+// Metrics holds the Prometheus collectors of an app. Each app has its own registry,
+// so that test apps do not clash. The methods do nothing on a nil *Metrics.
+type Metrics struct {
+	registry         *prometheus.Registry
+	httpRequests     *prometheus.CounterVec
+	httpDuration     *prometheus.HistogramVec
+	httpInFlight     prometheus.Gauge
+	dbDuration       *prometheus.HistogramVec
+	dbErrors         *prometheus.CounterVec
+	tokensIssued     *prometheus.CounterVec
+	tokensRefreshed  prometheus.Counter
+	loginFailures    prometheus.Counter
+	tokenRevocations *prometheus.CounterVec
+}
+
+// NewMetrics counts the stored notes and tags at most once every countInterval
+func NewMetrics(db *gorm.DB, countInterval time.Duration) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by method, route template and status class",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by method and route template",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		httpInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "http_requests_in_flight",
+			Help: "HTTP requests being served",
+		}),
+		dbDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "db_query_duration_seconds",
+			Help:    "Database query latency by operation",
+			Buckets: []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1},
+		}, []string{"operation"}),
+		dbErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "db_query_errors_total",
+			Help: "Failed database queries by operation, not counting records not found",
+		}, []string{"operation"}),
+		tokensIssued: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oauth2_tokens_issued_total",
+			Help: "Access tokens issued by grant type",
+		}, []string{"grant_type"}),
+		tokensRefreshed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "oauth2_tokens_refreshed_total",
+			Help: "Access tokens issued with a refresh token",
+		}),
+		loginFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "oauth2_login_failures_total",
+			Help: "Logins that failed on a wrong password or one-time password",
+		}),
+		tokenRevocations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "oauth2_revocations_total",
+			Help: "Revocations by what was revoked: a token, a session, or all tokens of a client or user",
+		}, []string{"kind"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.httpInFlight,
+		m.dbDuration,
+		m.dbErrors,
+		m.tokensIssued,
+		m.tokensRefreshed,
+		m.loginFailures,
+		m.tokenRevocations,
+		countGauge(db, "stored_notes", "Notes in every workspace", &Note{}, countInterval),
+		countGauge(db, "stored_tags", "Tags in every workspace", &Tag{}, countInterval),
+	)
+
+	return m
+}
+
+// countGauge reports the rows of model. They are counted again when a scrape finds the
+// count older than interval, so frequent scrapes don't each scan the table.
+func countGauge(db *gorm.DB, name string, help string, model interface{}, interval time.Duration) prometheus.GaugeFunc {
+	var mu sync.Mutex
+	var countedAt time.Time
+	count := 0
+
+	return prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: name, Help: help}, func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if time.Since(countedAt) > interval {
+			counted := 0
+			if err := db.Model(model).Count(&counted).Error; err == nil {
+				count, countedAt = counted, time.Now()
+			}
+		}
+
+		return float64(count)
+	})
+}
+
+func (m *Metrics) Registry() *prometheus.Registry {
+	return m.registry
+}
+
+func (m *Metrics) RequestStarted() {
+	if m == nil {
+		return
+	}
+
+	m.httpInFlight.Inc()
+}
+
+func (m *Metrics) RequestFinished() {
+	if m == nil {
+		return
+	}
+
+	m.httpInFlight.Dec()
+}
+
+func (m *Metrics) ObserveRequest(method string, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	m.httpRequests.WithLabelValues(method, route, fmt.Sprintf("%dxx", status/100)).Inc()
+	m.httpDuration.WithLabelValues(method, route).Observe(duration.Seconds())
+}
+
+func (m *Metrics) TokenIssued(grantType string) {
+	if m == nil {
+		return
+	}
+
+	m.tokensIssued.WithLabelValues(grantType).Inc()
+
+	if grantType == "refresh_token" {
+		m.tokensRefreshed.Inc()
+	}
+}
+
+func (m *Metrics) LoginFailed() {
+	if m == nil {
+		return
+	}
+
+	m.loginFailures.Inc()
+}
+
+func (m *Metrics) Revoked(kind string) {
+	if m == nil {
+		return
+	}
+
+	m.tokenRevocations.WithLabelValues(kind).Inc()
+}
+
+// InstrumentDB times every query made through the returned database. GORM callbacks
+// are shared by every database, so they look up the metrics each query is recorded in.
+func (m *Metrics) InstrumentDB(db *gorm.DB) *gorm.DB {
+	start := func(scope *gorm.Scope) {
+		scope.InstanceSet("metrics:start", time.Now())
+	}
+
+	finish := func(operation string) func(scope *gorm.Scope) {
+		return func(scope *gorm.Scope) {
+			started, ok := scope.InstanceGet("metrics:start")
+			if !ok {
+				return
+			}
+
+			metrics, ok := scope.Get("metrics")
+			if !ok {
+				return
+			}
+
+			m := metrics.(*Metrics)
+			m.dbDuration.WithLabelValues(operation).Observe(time.Since(started.(time.Time)).Seconds())
+
+			if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+				m.dbErrors.WithLabelValues(operation).Inc()
+			}
+		}
+	}
+
+	registerQueryCallbacks(db, "metrics", start, finish)
+
+	return db.Set("metrics", m)
+}
+
+// registerQueryCallbacks runs start before and finish after every kind of query, with
+// callbacks named after prefix
+func registerQueryCallbacks(db *gorm.DB, prefix string, start func(scope *gorm.Scope), finish func(operation string) func(scope *gorm.Scope)) {
+	callbacks := db.Callback()
+
+	registerCallback(callbacks.Create().Before("gorm:begin_transaction"), prefix+":start_create", start)
+	registerCallback(callbacks.Create().After("gorm:commit_or_rollback_transaction"), prefix+":finish_create", finish("create"))
+	registerCallback(callbacks.Update().Before("gorm:begin_transaction"), prefix+":start_update", start)
+	registerCallback(callbacks.Update().After("gorm:commit_or_rollback_transaction"), prefix+":finish_update", finish("update"))
+	registerCallback(callbacks.Delete().Before("gorm:begin_transaction"), prefix+":start_delete", start)
+	registerCallback(callbacks.Delete().After("gorm:commit_or_rollback_transaction"), prefix+":finish_delete", finish("delete"))
+	registerCallback(callbacks.Query().Before("gorm:query"), prefix+":start_query", start)
+	registerCallback(callbacks.Query().After("gorm:after_query"), prefix+":finish_query", finish("query"))
+	registerCallback(callbacks.RowQuery().Before("gorm:row_query"), prefix+":start_row_query", start)
+	registerCallback(callbacks.RowQuery().After("gorm:row_query"), prefix+":finish_row_query", finish("row_query"))
+}
+
+// registerCallback replaces the callback if a database is instrumented again, e.g.
+// by a second app sharing it
+func registerCallback(p *gorm.CallbackProcessor, name string, f func(scope *gorm.Scope)) {
+	if p.Get(name) != nil {
+		p.Replace(name, f)
+		return
+	}
+
+	p.Register(name, f)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+func scrapeMetrics() string {
+	req, _ := http.NewRequest(http.MethodGet, "/metrics", nil)
+	w := httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+
+	return w.Body.String()
+}
+
+func TestMetrics_HTTPAndDB(t *testing.T) {
+	for _, path := range []string{"/v1/notes/1", "/v1/notes/2"} {
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer access-token")
+		app.Engine().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	metrics := scrapeMetrics()
+
+	expected := []string{
+		`http_requests_total{method="GET",route="/v1/notes/:id",status="2xx"}`,
+		`http_request_duration_seconds_count{method="GET",route="/v1/notes/:id"}`,
+		`http_requests_in_flight`,
+		`db_query_duration_seconds_count{operation="query"}`,
+		`stored_notes`,
+		`stored_tags`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(metrics, e) {
+			t.Errorf("Expected metrics to contain '%s'", e)
+		}
+	}
+
+	if strings.Contains(metrics, `route="/v1/notes/1"`) {
+		t.Error("Expected requests to be recorded by route template")
+	}
+}
+
+func TestMetrics_OAuth2(t *testing.T) {
+	for _, password := range []string{"wrong", "password"} {
+		passwordGrant("test2@go-notes.com", password)
+	}
+
+	metrics := scrapeMetrics()
+
+	for _, e := range []string{`oauth2_login_failures_total`, `oauth2_tokens_issued_total{grant_type="password"}`} {
+		if !strings.Contains(metrics, e) {
+			t.Errorf("Expected metrics to contain '%s'", e)
+		}
+	}
+}
+
+func TestMetrics_StoredCountsAreCachedForTheInterval(t *testing.T) {
+	metrics := NewMetrics(app.Db(), time.Hour)
+
+	storedTags := func() float64 {
+		families, _ := metrics.Registry().Gather()
+		for _, f := range families {
+			if f.GetName() == "stored_tags" {
+				return f.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+
+		return -1
+	}
+
+	before := storedTags()
+	tag := &Tag{Name: "Counted", CreatedById: 1}
+	app.Db().Create(tag)
+	defer app.Db().Delete(tag)
+
+	if after := storedTags(); before < 1 || after != before {
+		t.Errorf("Expected the tags to be counted once an interval, got '%v' then '%v'", before, after)
+	}
+}
+
+func TestMetrics_NilDoesNothing(t *testing.T) {
+	var metrics *Metrics
+
+	metrics.RequestStarted()
+	metrics.ObserveRequest(http.MethodGet, "/v1/notes", http.StatusOK, time.Millisecond)
+	metrics.RequestFinished()
+	metrics.TokenIssued("password")
+}
@@ -1,24 +1,98 @@
 package main
 
 import (
+	"github.com/RangelReale/osin"
 	"github.com/gin-gonic/gin"
+	"time"
 )
 
 func NewAuthMiddleware(app *App) gin.HandlerFunc {
+	jwtTokens, _ := app.oauth2Server.AccessTokenGen.(*JWTAccessTokenGen)
+	personalAccessTokens := NewPersonalAccessTokenRepository(app.Db())
+
 	return func(c *gin.Context) {
-		resp := app.oauth2Server.NewResponse()
+		if bearer := osin.CheckBearerAuth(c.Request); bearer != nil && isPersonalAccessToken(bearer.Code) {
+			pat, err := personalAccessTokens.FindByToken(c.Request.Context(), bearer.Code)
+
+			if err != nil || pat.IsExpired() || pat.User == nil || pat.User.IsDisabled() {
+				app.responseHandler.Unauthorised(c)
+				c.Abort()
+				return
+			}
+
+			// Like sessions, the last use is only written once an interval
+			if !pat.UsedWithin(app.config.Tokens.SessionActivity) {
+				if err := personalAccessTokens.Touch(c.Request.Context(), pat, c.ClientIP()); err != nil {
+					app.responseHandler.InternalServerError(c)
+					c.Abort()
+					return
+				}
+			}
+
+			token := &osin.AccessData{
+				Client:      &osin.DefaultClient{},
+				UserData:    pat.User,
+				AccessToken: bearer.Code,
+				Scope:       pat.Scope,
+				CreatedAt:   pat.CreatedAt,
+			}
+
+			if pat.ExpiresAt != nil {
+				token.ExpiresIn = int32(pat.ExpiresAt.Sub(pat.CreatedAt) / time.Second)
+			}
+
+			c.Set("token", token)
+			c.Next()
+			return
+		}
+
+		// Self-contained tokens are verified without touching the database. Anything
+		// else, such as tokens issued before JWTs were enabled, is loaded through osin.
+		if bearer := osin.CheckBearerAuth(c.Request); jwtTokens != nil && bearer != nil && isJWT(bearer.Code) {
+			token, err := jwtTokens.Verify(bearer.Code)
+
+			if err != nil || app.denylist.IsRevoked(bearer.Code) {
+				app.responseHandler.Unauthorised(c)
+				c.Abort()
+				return
+			}
+
+			touchSession(app, c, bearer.Code)
+			c.Set("token", token)
+			c.Next()
+			return
+		}
+
+		resp := newOAuth2Response(app.oauth2Server, c)
 		defer resp.Close()
 
-		if ir := app.oauth2Server.HandleInfoRequest(resp, c.Request); ir != nil {
-			c.Set("token", ir.AccessData)
+		ir := app.oauth2Server.HandleInfoRequest(resp, c.Request)
+
+		if resp.IsError || ir == nil {
+			app.responseHandler.Unauthorised(c)
+			c.Abort()
+			return
 		}
 
-		if resp.IsError {
+		// Self-contained tokens are revoked when a user is disabled, but opaque tokens are
+		// checked here as the user has already been loaded
+		if user, ok := ir.AccessData.UserData.(*User); ok && user.IsDisabled() {
 			app.responseHandler.Unauthorised(c)
 			c.Abort()
 			return
 		}
 
+		touchSession(app, c, ir.AccessData.AccessToken)
+		c.Set("token", ir.AccessData)
+
 		c.Next()
 	}
 }
+
+// touchSession records the use of an access token for the sessions list. A failure is
+// not worth failing the request over.
+func touchSession(app *App, c *gin.Context, token string) {
+	if err := app.sessionTracker.Touch(token, c.ClientIP(), c.Request.UserAgent()); err != nil {
+		app.requestHandler.GetLogger(c).Error("Could not record session use", "error", err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// NewBodyLimitMiddleware refuses requests whose body is declared larger than limit, and
+// stops reading bodies that turn out to be larger. A limit of 0 allows any size.
+func NewBodyLimitMiddleware(limit int64, responseHandler ResponseHandler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit <= 0 {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			responseHandler.Error(c, RequestTooLarge, http.StatusRequestEntityTooLarge, "Request bodies may be at most {0} bytes", limit)
+			c.Abort()
+			return
+		}
+
+		if c.Request.Body != nil {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+
+		c.Next()
+	}
+}
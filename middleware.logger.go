@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/trace"
+	"io/ioutil"
+	"log/slog"
+	"regexp"
+	"runtime/debug"
+	"time"
+)
+
+const RequestIdHeader = "X-Request-ID"
+
+// Request IDs given by clients or proxies are kept if they are short and safe to log
+var requestIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// NewLoggerMiddleware gives each request an ID, taken from the X-Request-ID header if
+// there is a valid one, and a logger that adds it to every line. Each request is
+// logged once it has been handled.
+func NewLoggerMiddleware(logger *slog.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		id := c.GetHeader(RequestIdHeader)
+		if !requestIdPattern.MatchString(id) {
+			id, _ = randomString(16)
+		}
+
+		requestLogger := logger.With("request_id", id)
+		if span := trace.SpanContextFromContext(c.Request.Context()); span.IsValid() {
+			requestLogger = requestLogger.With("trace_id", span.TraceID().String())
+		}
+
+		c.Set("request_id", id)
+		c.Set("logger", requestLogger)
+		c.Header(RequestIdHeader, id)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= 500 {
+			level = slog.LevelError
+		}
+
+		attrs := []interface{}{
+			"method", c.Request.Method,
+			"route", c.FullPath(),
+			"path", redactedURL(c.Request.URL),
+			"status", status,
+			"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+			"bytes", c.Writer.Size(),
+			"ip", c.ClientIP(),
+			"user_agent", c.Request.UserAgent(),
+		}
+
+		if user, err := NewRequestHandler().GetUser(c); err == nil {
+			attrs = append(attrs, "user_id", user.ID)
+		}
+
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "error", c.Errors.String())
+		}
+
+		NewRequestHandler().GetLogger(c).Log(c.Request.Context(), level, "Request", attrs...)
+	}
+}
+
+// NewRecoveryMiddleware logs a panic in a handler with its stack and responds with an
+// internal server error
+func NewRecoveryMiddleware(responseHandler ResponseHandler) gin.HandlerFunc {
+	return gin.CustomRecoveryWithWriter(ioutil.Discard, func(c *gin.Context, err interface{}) {
+		NewRequestHandler().GetLogger(c).Error("Panic", "error", err, "stack", string(debug.Stack()))
+		responseHandler.InternalServerError(c)
+		c.Abort()
+	})
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// NewMetricsMiddleware records every request under its route template, so that paths
+// with ids in them do not each get their own series
+func NewMetricsMiddleware(metrics *Metrics) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		metrics.RequestStarted()
+		defer metrics.RequestFinished()
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		metrics.ObserveRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// NewPermissionMiddleware only lets through users whose role grants permission, and
+// whose personal access token, if that is what they used, has it in its scope. It
+// must run after NewAuthMiddleware, which has loaded the user, or read their role from
+// a self-contained token. Disabled users are already refused by NewAuthMiddleware.
+func NewPermissionMiddleware(app *App, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !tokenAllows(app.RequestHandler(), c, permission) {
+			app.ResponseHandler().Error(c, Forbidden, http.StatusForbidden, "The token's scope does not allow this")
+			c.Abort()
+			return
+		}
+
+		user, err := app.RequestHandler().GetUser(c)
+		if err != nil || user.IsDisabled() {
+			app.ResponseHandler().Unauthorised(c)
+			c.Abort()
+			return
+		}
+
+		if !user.Can(permission) {
+			app.ResponseHandler().Error(c, Forbidden, http.StatusForbidden, "You do not have permission to do this")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// NewOAuth2OnlyMiddleware refuses personal access tokens, on routes that manage the
+// user's credentials and sessions. It must run after NewAuthMiddleware.
+func NewOAuth2OnlyMiddleware(app *App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token, err := app.RequestHandler().GetToken(c); err != nil || isPersonalAccessToken(token.AccessToken) {
+			app.ResponseHandler().Error(c, Forbidden, http.StatusForbidden, "Personal access tokens cannot be used for this")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// tokenAllows reports whether the request's token may be used for permission. The
+// scope of a personal access token lists the permissions it is limited to, if any.
+// OAuth2 scopes only select claims, so they do not limit permissions.
+func tokenAllows(requestHandler RequestHandler, c *gin.Context, permission string) bool {
+	token, err := requestHandler.GetToken(c)
+	if err != nil {
+		return false
+	}
+
+	if !isPersonalAccessToken(token.AccessToken) || token.Scope == "" {
+		return true
+	}
+
+	return hasScope(token.Scope, permission)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"math"
+	"net/http"
+	"strconv"
+)
+
+// NewRateLimitMiddleware limits requests by the user, or OAuth2 client, of their
+// token, with a budget for reads and another for writes. It goes after
+// NewAuthMiddleware and only counts a request once, however many groups add it.
+func NewRateLimitMiddleware(app *App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		budget := "write"
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			budget = "read"
+		}
+
+		limitRequest(app, c, budget, rateLimitKey(app.RequestHandler(), c))
+	}
+}
+
+// NewTokenRateLimitMiddleware limits token requests by IP address. The client they
+// name is not authenticated yet, so anyone could use up its budget. Once it is, the
+// request is also limited by client with takeRateLimit.
+func NewTokenRateLimitMiddleware(app *App) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limitRequest(app, c, "token", "ip:"+c.ClientIP())
+	}
+}
+
+func rateLimitKey(requestHandler RequestHandler, c *gin.Context) string {
+	if user, err := requestHandler.GetUser(c); err == nil {
+		return fmt.Sprintf("user:%d", user.ID)
+	}
+
+	if token, err := requestHandler.GetToken(c); err == nil && token.Client != nil && token.Client.GetId() != "" {
+		return "client:" + token.Client.GetId()
+	}
+
+	return "ip:" + c.ClientIP()
+}
+
+func limitRequest(app *App, c *gin.Context, budget string, key string) {
+	limiter := app.RateLimiter()
+	if !limiter.Enabled() || c.GetBool("rate_limited") {
+		c.Next()
+		return
+	}
+
+	c.Set("rate_limited", true)
+
+	if !takeRateLimit(limiter, app.ResponseHandler(), c, budget, key) {
+		c.Abort()
+		return
+	}
+
+	c.Next()
+}
+
+// takeRateLimit counts a request against the budget of key, and responds with 429 if it
+// has been used up. It reports whether the request may go on.
+func takeRateLimit(limiter *RateLimiter, responseHandler ResponseHandler, c *gin.Context, budget string, key string) bool {
+	if !limiter.Enabled() {
+		return true
+	}
+
+	result, err := limiter.Take(c.Request.Context(), budget, key)
+	if err != nil {
+		// Better to serve without limits than not at all while the store is down
+		NewRequestHandler().GetLogger(c).Error("Could not check rate limit", "budget", budget, "error", err)
+		return true
+	}
+
+	c.Header("RateLimit-Limit", strconv.Itoa(result.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+
+	if result.Allowed {
+		return true
+	}
+
+	seconds := int(math.Ceil(result.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	responseHandler.Error(c, TooManyRequests, http.StatusTooManyRequests, "Rate limit exceeded, try again in {0} seconds", seconds)
+
+	return false
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+)
+
+// WorkspaceHeader selects a workspace on routes without a workspace path prefix
+const WorkspaceHeader = "X-Workspace-ID"
+
+// NewWorkspaceMiddleware selects the workspace from the :ws path parameter or the
+// X-Workspace-ID header and checks that the user's membership grants permission.
+// Requests that select no workspace act on the user's personal workspace. It must run
+// after NewAuthMiddleware.
+func NewWorkspaceMiddleware(app *App, permission string) gin.HandlerFunc {
+	workspaces := NewWorkspaceRepository(app.Db())
+
+	return func(c *gin.Context) {
+		if !tokenAllows(app.RequestHandler(), c, permission) {
+			app.ResponseHandler().Error(c, Forbidden, http.StatusForbidden, "The token's scope does not allow this")
+			c.Abort()
+			return
+		}
+
+		param := c.Param("ws")
+		if param == "" {
+			param = c.GetHeader(WorkspaceHeader)
+		}
+
+		if param == "" {
+			c.Next()
+			return
+		}
+
+		user, err := app.RequestHandler().GetUser(c)
+		if err != nil {
+			app.ResponseHandler().Unauthorised(c)
+			c.Abort()
+			return
+		}
+
+		// Workspaces the user is not a member of are reported as missing, so that
+		// their ids cannot be probed
+		id, _ := strconv.Atoi(param)
+		member, err := workspaces.FindMember(c.Request.Context(), uint(id), user.ID)
+		if err != nil {
+			app.ResponseHandler().NotFound(c)
+			c.Abort()
+			return
+		}
+
+		if !member.Can(permission) {
+			app.ResponseHandler().Error(c, Forbidden, http.StatusForbidden, "Your workspace role does not allow this")
+			c.Abort()
+			return
+		}
+
+		c.Set("workspace_member", member)
+		c.Next()
+	}
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+// A lock older than this is assumed to have been left by a migration that crashed.
+// Held locks are renewed every migrationLockRenewal, so long migrations keep them.
+const (
+	migrationLockTimeout = 15 * time.Minute
+	migrationLockRenewal = time.Minute
+)
+
+var (
+	ErrMigrationLocked   = errors.New("Migrations are being run by another process")
+	ErrMigrationLockLost = errors.New("The migration lock was taken over by another process")
+)
+
+// Migration changes the schema from the previous version to this one. Versions are
+// UTC timestamps, so they sort in the order the migrations were written.
+type Migration struct {
+	Version string
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+var migrations []*Migration
+
+func RegisterMigration(m *Migration) {
+	migrations = append(migrations, m)
+}
+
+type MigrationStatus struct {
+	*Migration
+	AppliedAt *time.Time
+}
+
+type Migrator struct {
+	db         *gorm.DB
+	migrations []*Migration
+	// How long to wait for another process to finish migrating
+	lockWait time.Duration
+	// How often the lock is renewed while a migration runs
+	lockRenewal time.Duration
+	// Identifies the migrator as the holder of the lock
+	owner        string
+	stopRenewing chan struct{}
+}
+
+func NewMigrator(db *gorm.DB) *Migrator {
+	return newMigrator(db, migrations)
+}
+
+func newMigrator(db *gorm.DB, list []*Migration) *Migrator {
+	sorted := append([]*Migration(nil), list...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	host, _ := os.Hostname()
+	id, _ := randomString(8)
+
+	return &Migrator{db, sorted, time.Minute, migrationLockRenewal, fmt.Sprintf("%s:%d:%s", host, os.Getpid(), id), nil}
+}
+
+// Status lists every migration along with when it was applied
+func (m *Migrator) Status() ([]*MigrationStatus, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var status []*MigrationStatus
+	for _, migration := range m.migrations {
+		s := &MigrationStatus{Migration: migration}
+
+		if a, ok := applied[migration.Version]; ok {
+			s.AppliedAt = &a.AppliedAt
+		}
+
+		status = append(status, s)
+	}
+
+	return status, nil
+}
+
+// Pending lists the migrations that have not been applied, oldest first
+func (m *Migrator) Pending() ([]*Migration, error) {
+	status, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []*Migration
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			pending = append(pending, s.Migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// Up applies up to steps pending migrations, or all of them if steps is 0, and
+// returns the ones it applied
+func (m *Migrator) Up(steps int) ([]*Migration, error) {
+	if err := m.lock(); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	pending, err := m.Pending()
+	if err != nil {
+		return nil, err
+	}
+
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+
+	for i, migration := range pending {
+		if err := m.renew(); err != nil {
+			return pending[:i], err
+		}
+
+		err := m.run(migration.Up, func(tx *gorm.DB) error {
+			return tx.Create(&SchemaMigration{migration.Version, migration.Name, time.Now()}).Error
+		})
+
+		if err != nil {
+			return pending[:i], fmt.Errorf("Migration %s_%s failed: %s", migration.Version, migration.Name, err)
+		}
+	}
+
+	return pending, nil
+}
+
+// Down reverts the last steps applied migrations, newest first, and returns the ones
+// it reverted
+func (m *Migrator) Down(steps int) ([]*Migration, error) {
+	if err := m.lock(); err != nil {
+		return nil, err
+	}
+	defer m.unlock()
+
+	status, err := m.Status()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []*Migration
+	for i := len(status) - 1; i >= 0 && len(reverted) < steps; i-- {
+		migration := status[i].Migration
+		if status[i].AppliedAt == nil {
+			continue
+		}
+
+		if err := m.renew(); err != nil {
+			return reverted, err
+		}
+
+		err := m.run(migration.Down, func(tx *gorm.DB) error {
+			return tx.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error
+		})
+
+		if err != nil {
+			return reverted, fmt.Errorf("Reverting migration %s_%s failed: %s", migration.Version, migration.Name, err)
+		}
+
+		reverted = append(reverted, migration)
+	}
+
+	return reverted, nil
+}
+
+// run calls f and then record, in one transaction where the database can roll back
+// schema changes. MySQL commits each schema change as soon as it is made.
+func (m *Migrator) run(f func(tx *gorm.DB) error, record func(tx *gorm.DB) error) error {
+	if m.db.Dialect().GetName() == "mysql" {
+		if err := f(m.db); err != nil {
+			return err
+		}
+
+		return record(m.db)
+	}
+
+	tx := m.db.Begin()
+
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (m *Migrator) applied() (map[string]*SchemaMigration, error) {
+	if err := m.db.AutoMigrate(&SchemaMigration{}, &SchemaMigrationLock{}).Error; err != nil {
+		return nil, err
+	}
+
+	var rows []*SchemaMigration
+	if err := m.db.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	applied := map[string]*SchemaMigration{}
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+
+	return applied, nil
+}
+
+// unapplied lists the migrations that have not been applied. Unlike Pending it only
+// reads, so it can be used by health checks.
+func (m *Migrator) unapplied(ctx context.Context) ([]*Migration, error) {
+	rows, err := m.db.DB().QueryContext(ctx, "SELECT version FROM "+m.db.Dialect().Quote(m.db.NewScope(&SchemaMigration{}).TableName()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+
+		applied[version] = true
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []*Migration
+	for _, migration := range m.migrations {
+		if !applied[migration.Version] {
+			pending = append(pending, migration)
+		}
+	}
+
+	return pending, nil
+}
+
+// lock waits up to lockWait for other processes to finish migrating, taking over
+// locks that have been held for longer than migrationLockTimeout
+func (m *Migrator) lock() error {
+	if err := m.db.AutoMigrate(&SchemaMigrationLock{}).Error; err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(m.lockWait)
+
+	for {
+		if err := m.db.Create(&SchemaMigrationLock{ID: 1, Owner: m.owner, LockedAt: time.Now()}).Error; err == nil {
+			m.stopRenewing = make(chan struct{})
+			if m.db.Dialect().GetName() != "sqlite3" {
+				go m.renewEvery(m.lockRenewal, m.stopRenewing)
+			}
+
+			return nil
+		}
+
+		stale := m.db.Where("id = 1 AND locked_at < ?", time.Now().Add(-migrationLockTimeout)).Delete(&SchemaMigrationLock{})
+		if stale.Error == nil && stale.RowsAffected > 0 {
+			continue
+		}
+
+		if time.Now().After(deadline) {
+			return ErrMigrationLocked
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// renew keeps the lock from going stale, and fails if another process has taken it
+// over
+func (m *Migrator) renew() error {
+	res := m.db.Model(&SchemaMigrationLock{}).Where("id = 1 AND owner = ?", m.owner).UpdateColumn("locked_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected != 1 {
+		return ErrMigrationLockLost
+	}
+
+	return nil
+}
+
+// renewEvery renews the lock while a single migration runs for longer than interval.
+// SQLite has a single writer, so it is not used there: renewing would wait on the
+// migration's transaction and fail, and no other process can take the lock over while
+// that transaction is open anyway.
+func (m *Migrator) renewEvery(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := m.renew(); err != nil {
+				slog.Warn("Could not renew the migration lock", "error", err)
+			}
+		}
+	}
+}
+
+func (m *Migrator) unlock() {
+	close(m.stopRenewing)
+	m.db.Where("id = 1 AND owner = ?", m.owner).Delete(&SchemaMigrationLock{})
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"testing"
+	"bytes"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+type migrationTestTable struct {
+	ID uint
+}
+
+func openMigrationTestDB(t *testing.T) *gorm.DB {
+	db, err := OpenDB(DatabaseConfig{Driver: "sqlite3", DSN: "./notes-migrate-test.db"})
+	if err != nil {
+		t.Fatalf("Cannot connect to test database: '%s'", err.Error())
+	}
+
+	db.LogMode(false)
+
+	return db
+}
+
+func closeMigrationTestDB(db *gorm.DB) {
+	db.Close()
+	os.Remove("./notes-migrate-test.db")
+}
+
+func testMigrations() []*Migration {
+	return []*Migration{
+		{
+			Version: "20260102000000",
+			Name:    "second",
+			Up: func(tx *gorm.DB) error {
+				return tx.Model(&migrationTestTable{}).AddIndex("idx_migration_test", "id").Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.Model(&migrationTestTable{}).RemoveIndex("idx_migration_test").Error
+			},
+		},
+		{
+			Version: "20260101000000",
+			Name:    "first",
+			Up: func(tx *gorm.DB) error {
+				return tx.CreateTable(&migrationTestTable{}).Error
+			},
+			Down: func(tx *gorm.DB) error {
+				return tx.DropTable(&migrationTestTable{}).Error
+			},
+		},
+	}
+}
+
+func TestMigrator_UpAndDown(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer closeMigrationTestDB(db)
+
+	migrator := newMigrator(db, testMigrations())
+
+	applied, err := migrator.Up(1)
+	if err != nil || len(applied) != 1 || applied[0].Name != "first" {
+		t.Fatalf("Expected the oldest migration to be applied first, got '%v' '%v'", applied, err)
+	}
+
+	if applied, _ := migrator.Up(0); len(applied) != 1 || applied[0].Name != "second" {
+		t.Errorf("Expected the remaining migration to be applied, got '%v'", applied)
+	}
+
+	status, _ := migrator.Status()
+	if status[0].AppliedAt == nil || status[1].AppliedAt == nil {
+		t.Error("Expected both migrations to be recorded as applied")
+	}
+
+	if reverted, err := migrator.Down(2); err != nil || len(reverted) != 2 || reverted[0].Name != "second" {
+		t.Errorf("Expected migrations to be reverted newest first, got '%v' '%v'", reverted, err)
+	}
+
+	if db.HasTable(&migrationTestTable{}) {
+		t.Error("Expected the table to be dropped")
+	}
+
+	if pending, _ := migrator.Pending(); len(pending) != 2 {
+		t.Errorf("Expected 2 pending migrations, got '%d'", len(pending))
+	}
+}
+
+func TestMigrator_FailedMigrationIsRolledBack(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer closeMigrationTestDB(db)
+
+	failing := &Migration{
+		Version: "20260103000000",
+		Name:    "failing",
+		Up: func(tx *gorm.DB) error {
+			tx.CreateTable(&migrationTestTable{})
+			return errors.New("Backfill failed")
+		},
+	}
+
+	if _, err := newMigrator(db, []*Migration{failing}).Up(0); err == nil {
+		t.Fatal("Expected the migration to fail")
+	}
+
+	if db.HasTable(&migrationTestTable{}) {
+		t.Error("Expected the table created by the failed migration to be rolled back")
+	}
+
+	if pending, _ := newMigrator(db, []*Migration{failing}).Pending(); len(pending) != 1 {
+		t.Error("Expected the failed migration to still be pending")
+	}
+}
+
+func TestMigrator_Lock(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer closeMigrationTestDB(db)
+
+	db.AutoMigrate(&SchemaMigrationLock{})
+	db.Create(&SchemaMigrationLock{ID: 1, Owner: "other", LockedAt: time.Now()})
+
+	migrator := newMigrator(db, testMigrations())
+	migrator.lockWait = 0
+
+	if _, err := migrator.Up(0); err != ErrMigrationLocked {
+		t.Errorf("Expected migrations to be locked, got '%v'", err)
+	}
+
+	// Locks left behind by a crashed process expire
+	db.Model(&SchemaMigrationLock{}).Where("id = 1").UpdateColumn("locked_at", time.Now().Add(-time.Hour))
+
+	if _, err := migrator.Up(0); err != nil {
+		t.Errorf("Expected a stale lock to be taken over, got '%v'", err)
+	}
+
+	count := 0
+	db.Model(&SchemaMigrationLock{}).Count(&count)
+	if count != 0 {
+		t.Error("Expected the lock to be released")
+	}
+}
+
+func TestMigrator_LockLost(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer closeMigrationTestDB(db)
+
+	list := testMigrations()
+	up := list[1].Up
+	list[1].Up = func(tx *gorm.DB) error {
+		// Another process takes over the lock while the migration runs
+		tx.Model(&SchemaMigrationLock{}).Where("id = 1").UpdateColumn("owner", "other")
+
+		return up(tx)
+	}
+
+	applied, err := newMigrator(db, list).Up(0)
+	if err != ErrMigrationLockLost {
+		t.Errorf("Expected the lock to be lost, got '%v'", err)
+	}
+
+	if len(applied) != 1 {
+		t.Errorf("Expected only the first migration to be applied, got %d", len(applied))
+	}
+
+	count := 0
+	db.Model(&SchemaMigrationLock{}).Where("owner = ?", "other").Count(&count)
+	if count != 1 {
+		t.Error("Expected the other process's lock to be kept")
+	}
+}
+
+func TestMigrator_SlowMigrationOnSQLite(t *testing.T) {
+	// Writers give up on a locked database after the busy timeout, which the
+	// migration outlasts
+	db, err := OpenDB(DatabaseConfig{Driver: "sqlite3", DSN: "./notes-migrate-test.db?_busy_timeout=50"})
+	if err != nil {
+		t.Fatalf("Cannot connect to test database: '%s'", err.Error())
+	}
+	defer closeMigrationTestDB(db)
+
+	db.LogMode(false)
+
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(defaultLogger)
+
+	list := testMigrations()
+	up := list[1].Up
+	list[1].Up = func(tx *gorm.DB) error {
+		if err := up(tx); err != nil {
+			return err
+		}
+
+		// Outlast a few renewals while the transaction holds the write lock
+		time.Sleep(300 * time.Millisecond)
+
+		return nil
+	}
+
+	migrator := newMigrator(db, list)
+	migrator.lockRenewal = 20 * time.Millisecond
+
+	if _, err := migrator.Up(0); err != nil {
+		t.Fatalf("Could not migrate: '%s'", err.Error())
+	}
+
+	if strings.Contains(logs.String(), "Could not renew the migration lock") {
+		t.Errorf("Expected the lock not to be renewed while SQLite is locked by the migration, got '%s'", logs.String())
+	}
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "notes-migrations")
+	defer os.RemoveAll(dir)
+
+	path, err := CreateMigration(dir, "add_tag_owner", time.Date(2026, 10, 19, 12, 30, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Could not create migration: '%s'", err.Error())
+	}
+
+	if !strings.HasSuffix(path, "migration.20261019123000_add_tag_owner.go") {
+		t.Errorf("Unexpected path '%s'", path)
+	}
+
+	contents, _ := ioutil.ReadFile(path)
+	if !strings.Contains(string(contents), `Version: "20261019123000"`) {
+		t.Errorf("Expected the migration to be versioned, got '%s'", contents)
+	}
+}
+
+func TestMigration_UserRolesFromScope(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer closeMigrationTestDB(db)
+
+	type user struct {
+		ID    uint
+		Scope string
+		Role  string
+	}
+
+	db.Table("user").CreateTable(&user{})
+	db.Table("user").Create(&user{Scope: "email admin", Role: RoleUser})
+	db.Table("user").Create(&user{Scope: "email", Role: RoleUser})
+
+	for _, m := range migrations {
+		if m.Version != "20261020110000" {
+			continue
+		}
+
+		if err := m.Up(db); err != nil {
+			t.Fatalf("Could not migrate: '%s'", err.Error())
+		}
+	}
+
+	var users []*user
+	db.Table("user").Order("id").Find(&users)
+
+	if len(users) != 2 || users[0].Role != RoleAdmin || users[1].Role != RoleUser {
+		t.Errorf("Expected only the user with the admin scope to become an admin, got %+v", users)
+		return
+	}
+}
+
+func TestMigration_TagOwner(t *testing.T) {
+	db := openMigrationTestDB(t)
+	defer closeMigrationTestDB(db)
+
+	type note struct {
+		ID          uint
+		CreatedById uint `gorm:"column:created_by"`
+		WorkspaceId uint
+	}
+
+	type noteTag struct {
+		NoteId uint
+		TagId  uint
+	}
+
+	type unownedTag struct {
+		ID          uint
+		Name        string
+		WorkspaceId uint
+	}
+
+	type tag struct {
+		ID          uint
+		Name        string
+		WorkspaceId uint
+		CreatedById uint `gorm:"column:created_by"`
+	}
+
+	db.Table("note").CreateTable(&note{})
+	db.Table("note_tags").CreateTable(&noteTag{})
+	db.Table("tag").CreateTable(&unownedTag{})
+
+	db.Table("tag").Create(&unownedTag{Name: "shared"})
+	db.Table("tag").Create(&unownedTag{Name: "team", WorkspaceId: 1})
+	db.Table("note").Create(&note{CreatedById: 1})
+	db.Table("note").Create(&note{CreatedById: 2})
+	db.Table("note").Create(&note{CreatedById: 1, WorkspaceId: 1})
+	db.Table("note_tags").Create(&noteTag{NoteId: 1, TagId: 1})
+	db.Table("note_tags").Create(&noteTag{NoteId: 2, TagId: 1})
+	db.Table("note_tags").Create(&noteTag{NoteId: 3, TagId: 2})
+
+	for _, m := range migrations {
+		if m.Version != "20261021090000" {
+			continue
+		}
+
+		if err := m.Up(db); err != nil {
+			t.Fatalf("Could not migrate: '%s'", err.Error())
+		}
+	}
+
+	var tags []*tag
+	db.Table("tag").Order("id").Find(&tags)
+
+	if len(tags) != 3 || tags[0].CreatedById != 1 || tags[1].CreatedById != 0 || tags[2].CreatedById != 2 || tags[2].Name != "shared" {
+		t.Errorf("Expected the shared personal tag to be split between its owners, got %+v", tags)
+		return
+	}
+
+	var noteTags []*noteTag
+	db.Table("note_tags").Order("note_id").Find(&noteTags)
+
+	if len(noteTags) != 3 || noteTags[0].TagId != 1 || noteTags[1].TagId != 3 || noteTags[2].TagId != 2 {
+		t.Errorf("Expected the second owner's note to use their copy of the tag, got %+v", noteTags)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// The schema as it was created by AutoMigrate, which databases created before
+// migrations were introduced already have. AutoMigrate only adds what is missing, so
+// applying this to them is safe. The models are copied as they were then, so later
+// changes to them don't change what this migration creates.
+func init() {
+	// Embedded fields are only migrated when their type is exported
+	type Model struct {
+		ID        uint
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+
+	type note struct {
+		Model
+		Title       string
+		Text        string `gorm:"type:text"`
+		CreatedById uint   `gorm:"column:created_by"`
+		WorkspaceId uint   `gorm:"not null;default:0;index"`
+	}
+
+	type noteTag struct {
+		NoteId uint `gorm:"primary_key;auto_increment:false"`
+		TagId  uint `gorm:"primary_key;auto_increment:false"`
+	}
+
+	type tag struct {
+		Model
+		Name        string
+		WorkspaceId uint `gorm:"not null;default:0;index"`
+	}
+
+	type user struct {
+		Model
+		Email              string
+		Password           string
+		Firstname          string
+		Lastname           string
+		Scope              string
+		Role               string `gorm:"default:'user'"`
+		DisabledAt         *time.Time
+		ForcePasswordReset bool
+		TOTPSecret         string `gorm:"column:totp_secret"`
+		TOTPEnabled        bool   `gorm:"column:totp_enabled"`
+	}
+
+	type oauth2Client struct {
+		Model
+		Name          string
+		Secret        string
+		Extra         string
+		RedirectURI   string
+		AllowedGrants string
+		AllowedScopes string
+	}
+
+	type oauth2RefreshToken struct {
+		Model
+		RefreshToken  string `gorm:"unique_index"`
+		Family        string `gorm:"index"`
+		AccessTokenId uint
+		ClientId      uint
+		UserId        uint
+		Expires       time.Time
+		Scope         string
+		UsedAt        *time.Time
+		SignedInAt    time.Time
+	}
+
+	type oauth2AccessToken struct {
+		Model
+		AccessToken string `gorm:"type:text"`
+		TokenHash   string `gorm:"unique_index"`
+		ClientId    uint
+		UserId      uint
+		Expires     time.Time
+		Scope       string
+		LastUsedAt  *time.Time
+		LastUsedIP  string
+		UserAgent   string
+	}
+
+	type oauth2RevokedToken struct {
+		Model
+		TokenHash string `gorm:"unique_index"`
+		Expires   time.Time
+	}
+
+	type personalAccessToken struct {
+		Model
+		Name       string
+		TokenHash  string `gorm:"unique_index"`
+		Scope      string
+		ExpiresAt  *time.Time
+		LastUsedAt *time.Time
+		LastUsedIP string
+		UserId     uint
+	}
+
+	type userRecoveryCode struct {
+		Model
+		UserId   uint   `gorm:"index"`
+		CodeHash string `gorm:"unique_index"`
+		UsedAt   *time.Time
+	}
+
+	type mfaChallenge struct {
+		Model
+		TokenHash string `gorm:"unique_index"`
+		UserId    uint
+		ClientId  string
+		Scope     string
+		Expires   time.Time
+	}
+
+	type loginAttempt struct {
+		Model
+		Key         string `gorm:"column:throttle_key;unique_index"`
+		Failures    int
+		LastFailure time.Time
+		LockedUntil *time.Time
+	}
+
+	type auditEvent struct {
+		Model
+		Action    string `gorm:"index"`
+		ActorId   *uint  `gorm:"index"`
+		IP        string
+		UserAgent string
+		Target    string `gorm:"index"`
+		Detail    string
+		Before    string `gorm:"type:text"`
+		After     string `gorm:"type:text"`
+		PrevHash  string `gorm:"unique_index"`
+		Hash      string
+	}
+
+	type workspace struct {
+		Model
+		Name        string
+		CreatedById uint `gorm:"column:created_by"`
+	}
+
+	type workspaceMember struct {
+		Model
+		WorkspaceId uint `gorm:"unique_index:idx_workspace_member"`
+		UserId      uint `gorm:"unique_index:idx_workspace_member"`
+		Role        string
+	}
+
+	type workspaceInvitation struct {
+		Model
+		WorkspaceId uint
+		Email       string
+		Role        string
+		TokenHash   string `gorm:"unique_index"`
+		InvitedById uint
+		Expires     time.Time
+		AcceptedAt  *time.Time
+	}
+
+	tables := []struct {
+		name  string
+		model interface{}
+	}{
+		{"note", &note{}},
+		{"note_tags", &noteTag{}},
+		{"tag", &tag{}},
+		{"user", &user{}},
+		{"oauth2_client", &oauth2Client{}},
+		{"oauth2_refresh_token", &oauth2RefreshToken{}},
+		{"oauth2_access_token", &oauth2AccessToken{}},
+		{"oauth2_revoked_token", &oauth2RevokedToken{}},
+		{"personal_access_token", &personalAccessToken{}},
+		{"user_recovery_code", &userRecoveryCode{}},
+		{"mfa_challenge", &mfaChallenge{}},
+		{"login_attempt", &loginAttempt{}},
+		{"audit_event", &auditEvent{}},
+		{"workspace", &workspace{}},
+		{"workspace_member", &workspaceMember{}},
+		{"workspace_invitation", &workspaceInvitation{}},
+	}
+
+	RegisterMigration(&Migration{
+		Version: "20261019000000",
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			for _, t := range tables {
+				if err := tx.Table(t.name).AutoMigrate(t.model).Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, t := range tables {
+				if err := tx.DropTableIfExists(t.name).Error; err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	})
+}
@@ -0,0 +1,21 @@
+package main
+
+import "github.com/jinzhu/gorm"
+
+// Clients can be authenticated by a client certificate with this subject
+func init() {
+	type oauth2Client struct {
+		TLSClientAuthSubjectDN string
+	}
+
+	RegisterMigration(&Migration{
+		Version: "20261019120000",
+		Name:    "oauth2_client_tls_subject",
+		Up: func(tx *gorm.DB) error {
+			return tx.Table("oauth2_client").AutoMigrate(&oauth2Client{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Table("oauth2_client").DropColumn("tls_client_auth_subject_dn").Error
+		},
+	})
+}
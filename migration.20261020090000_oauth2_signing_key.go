@@ -0,0 +1,29 @@
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Signing keys are stored so that JWTs stay valid across restarts and instances
+func init() {
+	type oauth2SigningKey struct {
+		ID         uint
+		CreatedAt  time.Time
+		UpdatedAt  time.Time
+		Kid        string `gorm:"unique_index"`
+		Algorithm  string
+		PrivateKey string `gorm:"type:text"`
+	}
+
+	RegisterMigration(&Migration{
+		Version: "20261020090000",
+		Name:    "oauth2_signing_key",
+		Up: func(tx *gorm.DB) error {
+			return tx.Table("oauth2_signing_key").AutoMigrate(&oauth2SigningKey{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.DropTableIfExists("oauth2_signing_key").Error
+		},
+	})
+}
@@ -0,0 +1,33 @@
+package main
+
+import "github.com/jinzhu/gorm"
+
+// A TOTP code cannot be used twice, and an MFA challenge only allows a few codes
+func init() {
+	type user struct {
+		TOTPLastStep int64 `gorm:"column:totp_last_step;not null;default:0"`
+	}
+
+	type mfaChallenge struct {
+		Attempts int `gorm:"not null;default:0"`
+	}
+
+	RegisterMigration(&Migration{
+		Version: "20261020100000",
+		Name:    "two_factor_attempts",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Table("user").AutoMigrate(&user{}).Error; err != nil {
+				return err
+			}
+
+			return tx.Table("mfa_challenge").AutoMigrate(&mfaChallenge{}).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("user").DropColumn("totp_last_step").Error; err != nil {
+				return err
+			}
+
+			return tx.Table("mfa_challenge").DropColumn("attempts").Error
+		},
+	})
+}
@@ -0,0 +1,48 @@
+package main
+
+import "github.com/jinzhu/gorm"
+
+// Admins used to be users with the admin scope. They keep admin access as the admin
+// role. The scope column is no longer read, and is left in place as SQLite cannot drop
+// columns.
+func init() {
+	type user struct {
+		ID    uint
+		Scope string
+	}
+
+	RegisterMigration(&Migration{
+		Version: "20261020110000",
+		Name:    "user_roles_from_scope",
+		Up: func(tx *gorm.DB) error {
+			if !tx.Dialect().HasColumn("user", "scope") {
+				return nil
+			}
+
+			var users []*user
+			if err := tx.Table("user").Select("id, scope").Where("scope <> ''").Find(&users).Error; err != nil {
+				return err
+			}
+
+			var admins []uint
+			for _, u := range users {
+				if hasScope(u.Scope, "admin") {
+					admins = append(admins, u.ID)
+				}
+			}
+
+			if len(admins) == 0 {
+				return nil
+			}
+
+			return tx.Table("user").Where("id IN (?)", admins).UpdateColumn("role", RoleAdmin).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("user").AutoMigrate(&user{}).Error; err != nil {
+				return err
+			}
+
+			return tx.Table("user").Where("role = ?", RoleAdmin).UpdateColumn("scope", "admin").Error
+		},
+	})
+}
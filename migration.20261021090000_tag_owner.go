@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// Personal tags belong to the user who created them. Existing personal tags are given
+// to the owners of the notes using them, and a tag shared by several users is copied
+// so each of them gets their own. Personal tags no note uses have no owner to give
+// them to, and are left unowned.
+func init() {
+	type tag struct {
+		ID          uint
+		CreatedAt   time.Time
+		UpdatedAt   time.Time
+		Name        string
+		WorkspaceId uint
+		CreatedById uint `gorm:"column:created_by;not null;default:0;index"`
+	}
+
+	type usage struct {
+		TagId     uint
+		CreatedBy uint
+	}
+
+	RegisterMigration(&Migration{
+		Version: "20261021090000",
+		Name:    "tag_owner",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Table("tag").AutoMigrate(&tag{}).Error; err != nil {
+				return err
+			}
+
+			var usages []*usage
+			err := tx.Table("note_tags").
+				Select("note_tags.tag_id, note.created_by").
+				Joins("JOIN note ON note.id = note_tags.note_id").
+				Joins("JOIN tag ON tag.id = note_tags.tag_id").
+				Where("tag.workspace_id = 0 AND tag.created_by = 0").
+				Group("note_tags.tag_id, note.created_by").
+				Order("note_tags.tag_id, note.created_by").
+				Scan(&usages).Error
+			if err != nil {
+				return err
+			}
+
+			owned := map[uint]bool{}
+			for _, u := range usages {
+				if !owned[u.TagId] {
+					owned[u.TagId] = true
+					if err := tx.Table("tag").Where("id = ?", u.TagId).UpdateColumn("created_by", u.CreatedBy).Error; err != nil {
+						return err
+					}
+					continue
+				}
+
+				original := new(tag)
+				if err := tx.Table("tag").Where("id = ?", u.TagId).First(original).Error; err != nil {
+					return err
+				}
+
+				now := time.Now()
+				copied := &tag{CreatedAt: now, UpdatedAt: now, Name: original.Name, CreatedById: u.CreatedBy}
+				if err := tx.Table("tag").Create(copied).Error; err != nil {
+					return err
+				}
+
+				err := tx.Table("note_tags").
+					Where("tag_id = ? AND note_id IN (SELECT id FROM note WHERE created_by = ?)", u.TagId, u.CreatedBy).
+					UpdateColumn("tag_id", copied.ID).Error
+				if err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Table("tag").RemoveIndex("idx_tag_created_by").Error; err != nil {
+				return err
+			}
+
+			return tx.Table("tag").DropColumn("created_by").Error
+		},
+	})
+}
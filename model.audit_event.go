@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var ErrAuditEventImmutable = errors.New("Audit events cannot be changed or deleted")
+
+// AuditEvent is an entry in the append-only audit log. Each event includes the hash
+// of the one before it, so altering or removing an event breaks the chain.
+type AuditEvent struct {
+	BaseModel
+	Action    string `json:"action" gorm:"index"`
+	ActorId   *uint  `json:"actor_id" gorm:"index"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent"`
+	Target    string `json:"target" gorm:"index"`
+	Detail    string `json:"detail"`
+	// JSON summaries of the target before and after the change
+	Before   string `json:"before,omitempty" gorm:"type:text"`
+	After    string `json:"after,omitempty" gorm:"type:text"`
+	PrevHash string `json:"prev_hash" gorm:"unique_index"`
+	Hash     string `json:"hash"`
+}
+
+func (e *AuditEvent) BeforeUpdate() error {
+	return ErrAuditEventImmutable
+}
+
+func (e *AuditEvent) BeforeDelete() error {
+	return ErrAuditEventImmutable
+}
+
+// ComputeHash hashes the event's contents along with the hash of the previous event
+func (e *AuditEvent) ComputeHash() string {
+	contents, _ := json.Marshal([]interface{}{
+		e.PrevHash,
+		e.Action,
+		e.ActorId,
+		e.IP,
+		e.UserAgent,
+		e.Target,
+		e.Detail,
+		e.Before,
+		e.After,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+	})
+
+	sum := sha256.Sum256(contents)
+
+	return hex.EncodeToString(sum[:])
+}
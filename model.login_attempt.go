@@ -0,0 +1,11 @@
+package main
+
+import "time"
+
+type LoginAttempt struct {
+	BaseModel
+	Key         string     `json:"key" gorm:"column:throttle_key;unique_index"`
+	Failures    int        `json:"failures"`
+	LastFailure time.Time  `json:"last_failure"`
+	LockedUntil *time.Time `json:"locked_until"`
+}
@@ -0,0 +1,17 @@
+package main
+
+import "time"
+
+// MFAChallenge is issued when a user with two-factor authentication enabled passes the
+// password check without a one-time password. Presenting its token with a one-time
+// password completes the login.
+type MFAChallenge struct {
+	BaseModel
+	TokenHash string    `json:"-" gorm:"unique_index"`
+	UserId    uint      `json:"-"`
+	ClientId  string    `json:"-"`
+	Scope     string    `json:"-"`
+	Expires   time.Time `json:"expires"`
+	// One-time passwords tried with the challenge
+	Attempts int `json:"-" gorm:"not null;default:0"`
+}
@@ -7,10 +7,11 @@ import (
 type Note struct {
 	BaseModel
 	Title       string `json:"title" validate:"required"`
-	Text        string `json:"text" validate:"omitempty"`
+	Text        string `json:"text" validate:"omitempty" gorm:"type:text"`
 	Tags        []*Tag `json:"tags,omitempty" gorm:"many2many:note_tags;" validate:"omitempty,dive,required"`
 	CreatedBy   *User  `json:"created_by" gorm:"ForeignKey:CreatedById"`
 	CreatedById uint   `json:"-" gorm:"column:created_by"`
+	WorkspaceId uint   `json:"workspace_id" gorm:"not null;default:0;index"`
 }
 
 /*
@@ -19,3 +20,20 @@ type Note struct {
 func (n *Note) BeforeDelete(tx *gorm.DB) {
 	tx.Model(n).Association("Tags").Clear()
 }
+
+// deleteNoteTags removes the links between notes and tags whose column is in values,
+// which may be a single id, a slice or a subquery
+func deleteNoteTags(tx *gorm.DB, column string, values interface{}) error {
+	quote := tx.Dialect().Quote
+
+	return tx.Exec("DELETE FROM "+quote("note_tags")+" WHERE "+quote(column)+" IN (?)", values).Error
+}
+
+func (n *Note) AuditSummary() map[string]interface{} {
+	var tags []string
+	for _, t := range n.Tags {
+		tags = append(tags, t.Name)
+	}
+
+	return map[string]interface{}{"title": n.Title, "tags": tags, "workspace_id": n.WorkspaceId}
+}
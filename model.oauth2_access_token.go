@@ -4,13 +4,23 @@ import "time"
 
 type OAuth2AccessToken struct {
 	BaseModel
-	AccessToken string        `json:"access_token" gorm:"unique_index"`
+	AccessToken string        `json:"access_token" gorm:"type:text"`
+	TokenHash   string        `json:"-" gorm:"unique_index"`
 	Client      *OAuth2Client `json:"client" gorm:"ForeignKey:ClientId"`
 	ClientId    uint          `json:"-"`
 	User        *User         `json:"user" gorm:"ForeignKey:UserId"`
 	UserId      uint          `json:"-"`
 	Expires     time.Time     `json:"expires"`
 	Scope       string        `json:"scope"`
+	LastUsedAt  *time.Time    `json:"last_used_at"`
+	LastUsedIP  string        `json:"last_used_ip"`
+	UserAgent   string        `json:"user_agent"`
+}
+
+// BeforeSave sets the hash tokens are looked up by, as self-contained tokens are too
+// long to index on every database
+func (t *OAuth2AccessToken) BeforeSave() {
+	t.TokenHash = hashToken(t.AccessToken)
 }
 
 func (*OAuth2AccessToken) TableName() string {
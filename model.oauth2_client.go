@@ -1,15 +1,25 @@
 package main
 
 import (
+	"context"
 	"strconv"
-	"golang.org/x/crypto/bcrypt"
+	"strings"
 )
 
 type OAuth2Client struct {
 	BaseModel
-	Secret      string `json:"-"`
-	Extra       string `json:"extra"`
-	RedirectURI string `json:"redirect_uri"`
+	Name   string `json:"name" validate:"required,max=100"`
+	Secret string `json:"-"`
+	Extra  string `json:"extra"`
+	// Space separated lists. An empty list of grants or scopes allows any. osin refuses
+	// clients without a redirect URI, even for grants that do not redirect.
+	RedirectURI   string `json:"redirect_uri" validate:"required,uri_list"`
+	AllowedGrants string `json:"allowed_grants" validate:"omitempty,grant_list"`
+	AllowedScopes string `json:"allowed_scopes"`
+	// Subject of a client certificate that authenticates the client in place of its
+	// secret, e.g. CN=reports,O=Example. The certificate must be issued by the
+	// server's client CA.
+	TLSClientAuthSubjectDN string `json:"tls_client_auth_subject_dn" validate:"max=255"`
 }
 
 func (c *OAuth2Client) GetId() string {
@@ -32,10 +42,47 @@ func (*OAuth2Client) TableName() string {
 	return "oauth2_client"
 }
 
-func (c *OAuth2Client) ClientSecretMatches(secret string) bool {
-	if err := bcrypt.CompareHashAndPassword([]byte(c.Secret), []byte(secret)); err != nil {
+// Authenticate reports whether a request presented the client's secret, or a verified
+// client certificate with the client's subject. certificateSubject is empty if the
+// request has no certificate.
+func (c *OAuth2Client) Authenticate(ctx context.Context, secret string, certificateSubject string) bool {
+	if c.TLSClientAuthSubjectDN != "" && certificateSubject == c.TLSClientAuthSubjectDN {
+		return true
+	}
+
+	if err := compareHashAndPassword(ctx, c.Secret, secret); err != nil {
 		return false
 	}
 
 	return true
 }
+
+func (c *OAuth2Client) AllowsGrant(grant string) bool {
+	return c.AllowedGrants == "" || hasScope(c.AllowedGrants, grant)
+}
+
+// AllowsScope reports whether every scope in the space separated scope may be
+// requested by the client
+func (c *OAuth2Client) AllowsScope(scope string) bool {
+	if c.AllowedScopes == "" {
+		return true
+	}
+
+	for _, s := range strings.Fields(scope) {
+		if !hasScope(c.AllowedScopes, s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *OAuth2Client) AuditSummary() map[string]interface{} {
+	return map[string]interface{}{
+		"name":                       c.Name,
+		"redirect_uri":               c.RedirectURI,
+		"allowed_grants":             c.AllowedGrants,
+		"allowed_scopes":             c.AllowedScopes,
+		"tls_client_auth_subject_dn": c.TLSClientAuthSubjectDN,
+	}
+}
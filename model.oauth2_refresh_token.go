@@ -5,6 +5,7 @@ import "time"
 type OAuth2RefreshToken struct {
 	BaseModel
 	RefreshToken  string             `json:"refresh_token" gorm:"unique_index"`
+	Family        string             `json:"-" gorm:"index"`
 	AccessToken   *OAuth2AccessToken `json:"access_token" gorm:"ForeignKey:AccessTokenId"`
 	AccessTokenId uint               `json:"-"`
 	Client        *OAuth2Client      `json:"client" gorm:"ForeignKey:ClientId"`
@@ -13,6 +14,9 @@ type OAuth2RefreshToken struct {
 	UserId        uint               `json:"-"`
 	Expires       time.Time          `json:"expires"`
 	Scope         string             `json:"scope"`
+	UsedAt        *time.Time         `json:"used_at"`
+	// When the login that started the family happened
+	SignedInAt time.Time `json:"signed_in_at"`
 }
 
 func (*OAuth2RefreshToken) TableName() string {
@@ -0,0 +1,13 @@
+package main
+
+import "time"
+
+type OAuth2RevokedToken struct {
+	BaseModel
+	TokenHash string    `json:"-" gorm:"unique_index"`
+	Expires   time.Time `json:"expires"`
+}
+
+func (*OAuth2RevokedToken) TableName() string {
+	return "oauth2_revoked_token"
+}
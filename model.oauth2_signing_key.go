@@ -0,0 +1,15 @@
+package main
+
+// OAuth2SigningKey stores a token signing key, so that tokens outlive restarts and
+// every instance signs and verifies with the same keys
+type OAuth2SigningKey struct {
+	BaseModel
+	Kid       string `gorm:"unique_index"`
+	Algorithm string
+	// PKCS #8, PEM encoded
+	PrivateKey string `gorm:"type:text"`
+}
+
+func (*OAuth2SigningKey) TableName() string {
+	return "oauth2_signing_key"
+}
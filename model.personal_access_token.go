@@ -0,0 +1,39 @@
+package main
+
+import "time"
+
+const personalAccessTokenPrefix = "pat_"
+
+type PersonalAccessToken struct {
+	BaseModel
+	Name       string     `json:"name" validate:"required,max=100"`
+	TokenHash  string     `json:"-" gorm:"unique_index"`
+	// Permissions the token is limited to, e.g. notes:read, or all of the user's if empty
+	Scope      string     `json:"scope" validate:"omitempty,permission_list"`
+	ExpiresAt  *time.Time `json:"expires_at" validate:"omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip"`
+	User       *User      `json:"-" gorm:"ForeignKey:UserId"`
+	UserId     uint       `json:"-"`
+}
+
+func (*PersonalAccessToken) TableName() string {
+	return "personal_access_token"
+}
+
+func (t *PersonalAccessToken) IsExpired() bool {
+	return t.ExpiresAt != nil && t.ExpiresAt.Before(time.Now())
+}
+
+// UsedWithin reports whether the token's last use was recorded less than interval ago
+func (t *PersonalAccessToken) UsedWithin(interval time.Duration) bool {
+	return t.LastUsedAt != nil && time.Since(*t.LastUsedAt) < interval
+}
+
+func isPersonalAccessToken(token string) bool {
+	return len(token) > len(personalAccessTokenPrefix) && token[:len(personalAccessTokenPrefix)] == personalAccessTokenPrefix
+}
+
+func (t *PersonalAccessToken) AuditSummary() map[string]interface{} {
+	return map[string]interface{}{"name": t.Name, "scope": t.Scope, "expires_at": t.ExpiresAt}
+}
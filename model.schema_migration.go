@@ -0,0 +1,26 @@
+package main
+
+import "time"
+
+// SchemaMigration records a migration that has been applied
+type SchemaMigration struct {
+	Version   string `gorm:"primary_key"`
+	Name      string
+	AppliedAt time.Time
+}
+
+func (*SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// SchemaMigrationLock is held by whoever is running migrations. There is only ever
+// one row, so a second insert fails while the lock is held.
+type SchemaMigrationLock struct {
+	ID       uint `gorm:"primary_key;auto_increment:false"`
+	Owner    string
+	LockedAt time.Time
+}
+
+func (*SchemaMigrationLock) TableName() string {
+	return "schema_migration_lock"
+}
@@ -4,9 +4,15 @@ import "github.com/jinzhu/gorm"
 
 type Tag struct {
 	BaseModel
-	Name string `json:"name" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	WorkspaceId uint   `json:"workspace_id" gorm:"not null;default:0;index"`
+	CreatedById uint   `json:"-" gorm:"column:created_by;not null;default:0;index"`
 }
 
 func (t *Tag) BeforeDelete(tx *gorm.DB) {
-	tx.Exec("DELETE FROM note_tags WHERE tag_id = ?", t.ID)
+	deleteNoteTags(tx, "tag_id", t.ID)
+}
+
+func (t *Tag) AuditSummary() map[string]interface{} {
+	return map[string]interface{}{"name": t.Name, "workspace_id": t.WorkspaceId}
 }
@@ -1,10 +1,31 @@
 package main
 
+import "time"
+
 type User struct {
 	BaseModel
-	Email     string `json:"email"`
-	Password  string `json:"-"`
-	Firstname string `json:"firstname"`
-	Lastname  string `json:"lastname"`
-	Scope     string `json:"scope"`
+	Email              string     `json:"email"`
+	Password           string     `json:"-"`
+	Firstname          string     `json:"firstname"`
+	Lastname           string     `json:"lastname"`
+	Role               string     `json:"role" gorm:"default:'user'"`
+	DisabledAt         *time.Time `json:"disabled_at"`
+	ForcePasswordReset bool       `json:"force_password_reset"`
+	TOTPSecret         string     `json:"-" gorm:"column:totp_secret"`
+	TOTPEnabled        bool       `json:"totp_enabled" gorm:"column:totp_enabled"`
+	// Time step of the last TOTP code used, which no code may be used again after
+	TOTPLastStep int64 `json:"-" gorm:"column:totp_last_step;not null;default:0"`
+}
+
+func (u *User) IsDisabled() bool {
+	return u.DisabledAt != nil
+}
+
+func (u *User) AuditSummary() map[string]interface{} {
+	return map[string]interface{}{
+		"email":                u.Email,
+		"role":                 u.Role,
+		"disabled":             u.IsDisabled(),
+		"force_password_reset": u.ForcePasswordReset,
+	}
 }
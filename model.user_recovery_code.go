@@ -0,0 +1,10 @@
+package main
+
+import "time"
+
+type UserRecoveryCode struct {
+	BaseModel
+	UserId   uint       `json:"-" gorm:"index"`
+	CodeHash string     `json:"-" gorm:"unique_index"`
+	UsedAt   *time.Time `json:"used_at"`
+}
@@ -0,0 +1,11 @@
+package main
+
+type Workspace struct {
+	BaseModel
+	Name        string `json:"name" validate:"required,max=100"`
+	CreatedById uint   `json:"-" gorm:"column:created_by"`
+}
+
+func (w *Workspace) AuditSummary() map[string]interface{} {
+	return map[string]interface{}{"name": w.Name}
+}
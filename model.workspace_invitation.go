@@ -0,0 +1,18 @@
+package main
+
+import "time"
+
+type WorkspaceInvitation struct {
+	BaseModel
+	WorkspaceId uint       `json:"workspace_id"`
+	Email       string     `json:"email" validate:"required,email"`
+	Role        string     `json:"role" validate:"required,oneof=owner editor viewer"`
+	TokenHash   string     `json:"-" gorm:"unique_index"`
+	InvitedById uint       `json:"-"`
+	Expires     time.Time  `json:"expires"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+}
+
+func (i *WorkspaceInvitation) AuditSummary() map[string]interface{} {
+	return map[string]interface{}{"workspace_id": i.WorkspaceId, "email": i.Email, "role": i.Role}
+}
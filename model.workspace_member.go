@@ -0,0 +1,24 @@
+package main
+
+type WorkspaceMember struct {
+	BaseModel
+	WorkspaceId uint   `json:"workspace_id" gorm:"unique_index:idx_workspace_member"`
+	User        *User  `json:"user" gorm:"ForeignKey:UserId"`
+	UserId      uint   `json:"-" gorm:"unique_index:idx_workspace_member"`
+	Role        string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+// Can reports whether the member's workspace role grants permission
+func (m *WorkspaceMember) Can(permission string) bool {
+	for _, p := range workspaceRolePermissions[m.Role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *WorkspaceMember) AuditSummary() map[string]interface{} {
+	return map[string]interface{}{"workspace_id": m.WorkspaceId, "user_id": m.UserId, "role": m.Role}
+}
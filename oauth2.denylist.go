@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/jinzhu/gorm"
+	"sync"
+	"time"
+)
+
+// TokenDenylist records self-contained access tokens that were revoked before they
+// expired. Lookups are served from memory, which is refreshed from the database
+// every syncInterval to pick up revocations made by other instances.
+type TokenDenylist struct {
+	db           *gorm.DB
+	syncInterval time.Duration
+	mu           sync.RWMutex
+	entries      map[string]time.Time
+	syncedAt     time.Time
+	lastId       uint
+}
+
+func NewTokenDenylist(db *gorm.DB, syncInterval time.Duration) *TokenDenylist {
+	return &TokenDenylist{
+		db:           db,
+		syncInterval: syncInterval,
+		entries:      map[string]time.Time{},
+	}
+}
+
+// Revoke adds a token to the denylist using db, which may be a transaction
+func (d *TokenDenylist) Revoke(db *gorm.DB, token string, expires time.Time) error {
+	hash := hashToken(token)
+	revoked := &OAuth2RevokedToken{TokenHash: hash, Expires: expires}
+
+	if err := db.Where(OAuth2RevokedToken{TokenHash: hash}).FirstOrCreate(revoked).Error; err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	d.entries[hash] = expires
+	d.mu.Unlock()
+
+	return nil
+}
+
+func (d *TokenDenylist) IsRevoked(token string) bool {
+	d.mu.RLock()
+	stale := time.Since(d.syncedAt) > d.syncInterval
+	d.mu.RUnlock()
+
+	if stale {
+		d.sync()
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	_, revoked := d.entries[hashToken(token)]
+
+	return revoked
+}
+
+func (d *TokenDenylist) sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var revoked []*OAuth2RevokedToken
+	if err := d.db.Where("id > ?", d.lastId).Order("id").Find(&revoked).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	for _, r := range revoked {
+		d.entries[r.TokenHash] = r.Expires
+		d.lastId = r.ID
+	}
+
+	for hash, expires := range d.entries {
+		if expires.Before(now) {
+			delete(d.entries, hash)
+		}
+	}
+
+	d.syncedAt = now
+
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
+}
@@ -7,61 +7,202 @@ import (
 	"errors"
 	"time"
 	"net/http"
+	"context"
+	"github.com/gin-gonic/gin"
 )
 
+var ErrRefreshTokenReused = errors.New("Refresh token has already been used")
+
+const (
+	AccessTokenOpaque = "opaque"
+	AccessTokenJWT    = "jwt"
+)
+
+type OAuth2Config struct {
+	// Lifetime of an access token in seconds
+	AccessExpiration int32 `yaml:"access_expiration" validate:"min=1"`
+	// Lifetime of a refresh token in seconds. Every refresh issues a new
+	// refresh token with a fresh lifetime.
+	RefreshExpiration int32 `yaml:"refresh_expiration" validate:"min=1"`
+	// Either AccessTokenOpaque or AccessTokenJWT
+	AccessTokenFormat string `yaml:"access_token_format" validate:"oneof=opaque jwt"`
+	// Algorithm used to sign JWTs, either SigningAlgorithmRS256 or SigningAlgorithmEdDSA
+	SigningAlgorithm string `yaml:"signing_algorithm" validate:"oneof=RS256 EdDSA"`
+	// Age in seconds after which a new signing key is generated
+	KeyRotation int32 `yaml:"key_rotation" validate:"min=1"`
+	// Value of the iss claim of signed tokens
+	Issuer string `yaml:"issuer" validate:"required,url"`
+}
+
+func NewOAuth2Config() *OAuth2Config {
+	return &OAuth2Config{
+		AccessExpiration:  3600,
+		RefreshExpiration: 60 * 60 * 24 * 31,
+		AccessTokenFormat: AccessTokenOpaque,
+		SigningAlgorithm:  SigningAlgorithmRS256,
+		KeyRotation:       60 * 60 * 24 * 7,
+		Issuer:            "http://localhost:8080",
+	}
+}
+
+// NewKeySet loads the signing keys for config from db, reloading them every
+// syncInterval. Retired keys are kept until every access token they signed has expired.
+func (config *OAuth2Config) NewKeySet(db *gorm.DB, syncInterval time.Duration) (*KeySet, error) {
+	return NewKeySet(
+		db,
+		config.SigningAlgorithm,
+		time.Duration(config.KeyRotation)*time.Second,
+		time.Duration(config.AccessExpiration)*time.Second,
+		syncInterval,
+	)
+}
+
 type GORMStorage struct {
-	db *gorm.DB
+	db       *gorm.DB
+	config   *OAuth2Config
+	denylist *TokenDenylist
+	metrics  *Metrics
+}
+
+func NewGORMStorage(db *gorm.DB, config *OAuth2Config, denylist *TokenDenylist, metrics *Metrics) *GORMStorage {
+	return &GORMStorage{db, config, denylist, metrics}
 }
 
-func NewOAuth2Server(db *gorm.DB) *osin.Server {
+// osinStorage adapts GORMStorage to osin, whose storage calls have no context, for a
+// single request. Its clients are authenticated by the request's client certificate.
+type osinStorage struct {
+	storage            *GORMStorage
+	ctx                context.Context
+	certificateSubject string
+}
+
+// osinClient lets osin authenticate a client of the request it was loaded for
+type osinClient struct {
+	*OAuth2Client
+	ctx                context.Context
+	certificateSubject string
+}
+
+func (c *osinClient) ClientSecretMatches(secret string) bool {
+	return c.Authenticate(c.ctx, secret, c.certificateSubject)
+}
+
+func NewOAuth2Server(db *gorm.DB, config *OAuth2Config, keys *KeySet, denylist *TokenDenylist, metrics *Metrics) *osin.Server {
 	conf := osin.NewServerConfig()
-	conf.AllowedAccessTypes = osin.AllowedAccessType{osin.PASSWORD, osin.REFRESH_TOKEN}
+	// The assertion grant completes logins that require a second factor
+	conf.AllowedAccessTypes = osin.AllowedAccessType{osin.PASSWORD, osin.REFRESH_TOKEN, osin.ASSERTION}
 	conf.ErrorStatusCode = http.StatusBadRequest
-	conf.AccessExpiration = 3600
+	conf.AccessExpiration = config.AccessExpiration
 	conf.AllowClientSecretInParams = true
+	// Refresh tokens are rotated by GORMStorage.SaveAccess rather than removed by osin,
+	// so that a used refresh token can be recognised if it is presented again
+	conf.RetainTokenAfterRefresh = true
+	conf.RedirectUriSeparator = " "
 
-	return osin.NewServer(conf, &GORMStorage{db})
+	server := osin.NewServer(conf, &osinStorage{NewGORMStorage(db, config, denylist, metrics), context.Background(), ""})
+
+	if config.AccessTokenFormat == AccessTokenJWT {
+		server.AccessTokenGen = NewJWTAccessTokenGen(keys, config.Issuer)
+	}
+
+	return server
 }
 
-func (s *GORMStorage) Clone() osin.Storage {
-	return s
+// oauth2Storage returns the storage server was created with
+func oauth2Storage(server *osin.Server) *GORMStorage {
+	return server.Storage.(*osinStorage).storage
 }
 
-func (s *GORMStorage) Close() {
+// newOAuth2Response starts a response whose storage calls are traced as part of the
+// request, and whose clients can be authenticated by the request's client certificate
+func newOAuth2Response(server *osin.Server, c *gin.Context) *osin.Response {
+	resp := server.NewResponse()
+
+	if s, ok := resp.Storage.(*osinStorage); ok {
+		resp.Storage = &osinStorage{s.storage, c.Request.Context(), clientCertificateSubject(c.Request.TLS)}
+	}
 
+	return resp
 }
 
-func (s *GORMStorage) GetClient(id string) (osin.Client, error) {
-	client := new(OAuth2Client)
+func (s *osinStorage) Clone() osin.Storage {
+	return s
+}
 
-	if err := s.db.First(client, id).Error; err != nil {
-		return nil, osin.ErrNotFound
+func (s *osinStorage) Close() {
+
+}
+
+func (s *osinStorage) GetClient(id string) (osin.Client, error) {
+	client, err := s.storage.GetClient(s.ctx, id)
+	if err != nil {
+		return nil, err
 	}
 
-	return client, nil
+	return &osinClient{client, s.ctx, s.certificateSubject}, nil
 }
 
-func (s *GORMStorage) SaveAuthorize(*osin.AuthorizeData) error {
+func (s *osinStorage) SaveAuthorize(*osin.AuthorizeData) error {
 	return errors.New("Not implemented")
 }
 
-func (s *GORMStorage) LoadAuthorize(code string) (*osin.AuthorizeData, error) {
+func (s *osinStorage) LoadAuthorize(code string) (*osin.AuthorizeData, error) {
 	return nil, errors.New("Not implemented")
 }
 
-func (s *GORMStorage) RemoveAuthorize(code string) error {
+func (s *osinStorage) RemoveAuthorize(code string) error {
 	return errors.New("Not implemented")
 }
 
-func (s *GORMStorage) SaveAccess(t *osin.AccessData) error {
-	c, err := s.GetClient(t.Client.GetId())
-	if err != nil {
-		return err
+func (s *osinStorage) SaveAccess(t *osin.AccessData) error {
+	return s.storage.SaveAccess(s.ctx, t)
+}
+
+func (s *osinStorage) LoadAccess(token string) (*osin.AccessData, error) {
+	return s.storage.LoadAccess(s.ctx, token)
+}
+
+func (s *osinStorage) RemoveAccess(token string) error {
+	return s.storage.RemoveAccess(s.ctx, token)
+}
+
+func (s *osinStorage) LoadRefresh(token string) (*osin.AccessData, error) {
+	return s.storage.LoadRefresh(s.ctx, token)
+}
+
+func (s *osinStorage) RemoveRefresh(token string) error {
+	return s.storage.RemoveRefresh(s.ctx, token)
+}
+
+// trace starts a span for a storage call, which is ended by calling the returned
+// function with the call's error
+func (s *GORMStorage) trace(ctx context.Context, name string) func(err *error) {
+	_, span := startSpan(ctx, "GORMStorage."+name)
+
+	return func(err *error) {
+		spanError(span, *err)
+		span.End()
 	}
+}
+
+func (s *GORMStorage) GetClient(ctx context.Context, id string) (client *OAuth2Client, err error) {
+	defer s.trace(ctx, "GetClient")(&err)
+
+	client = new(OAuth2Client)
 
-	client, clientOk := c.(*OAuth2Client)
-	if !clientOk {
-		return errors.New("Could not assert type *OAuth2Client")
+	if err := s.db.First(client, id).Error; err != nil {
+		return nil, osin.ErrNotFound
+	}
+
+	return client, nil
+}
+
+func (s *GORMStorage) SaveAccess(ctx context.Context, t *osin.AccessData) (err error) {
+	defer s.trace(ctx, "SaveAccess")(&err)
+
+	client, err := s.GetClient(ctx, t.Client.GetId())
+	if err != nil {
+		return err
 	}
 
 	user, userOk := t.UserData.(*User)
@@ -69,11 +210,23 @@ func (s *GORMStorage) SaveAccess(t *osin.AccessData) error {
 		return errors.New("Could not assert type User")
 	}
 
-	prev := new(OAuth2AccessToken)
-	s.db.Where("client_id = ? AND user_id = ?", client.GetId(), user.ID).Find(prev)
+	tx := s.db.Begin()
+
+	prev, err := s.rotateRefresh(tx, t.AccessData)
+	if err == ErrRefreshTokenReused {
+		tx.Rollback()
+
+		// The tokens issued by the request that rotated it first must not stay valid
+		if err := s.revokeRefresh(ctx, t.AccessData.RefreshToken); err != nil {
+			return err
+		}
 
-	if prev.AccessToken != "" {
-		t.AccessData, _ = s.LoadAccess(prev.AccessToken)
+		return ErrRefreshTokenReused
+	}
+
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
 
 	token := &OAuth2AccessToken{
@@ -86,8 +239,6 @@ func (s *GORMStorage) SaveAccess(t *osin.AccessData) error {
 		UserId:      user.ID,
 	}
 
-	tx := s.db.Begin()
-
 	if err := tx.Set("gorm:save_associations", false).Create(token).Error; err != nil {
 		tx.Rollback()
 		return err
@@ -96,12 +247,14 @@ func (s *GORMStorage) SaveAccess(t *osin.AccessData) error {
 	refreshToken := &OAuth2RefreshToken{
 		AccessTokenId: token.ID,
 		RefreshToken:  t.RefreshToken,
+		Family:        prev.Family,
+		SignedInAt:    prev.SignedInAt,
 		Client:        client,
 		ClientId:      client.ID,
-		Expires:       time.Now().AddDate(0, 0, 31),
+		Expires:       time.Now().Add(time.Duration(s.config.RefreshExpiration) * time.Second),
 		Scope:         t.Scope,
-		User:          t.UserData.(*User),
-		UserId:        t.UserData.(*User).ID,
+		User:          user,
+		UserId:        user.ID,
 	}
 
 	if err := tx.Set("gorm:save_associations", false).Create(refreshToken).Error; err != nil {
@@ -116,9 +269,62 @@ func (s *GORMStorage) SaveAccess(t *osin.AccessData) error {
 	return nil
 }
 
-func (s *GORMStorage) LoadAccess(token string) (*osin.AccessData, error) {
+// rotateRefresh marks the refresh token used by a refresh grant as used and removes
+// the access token it was issued with. It returns a refresh token carrying the family
+// and sign-in time the new tokens inherit.
+func (s *GORMStorage) rotateRefresh(tx *gorm.DB, prev *osin.AccessData) (*OAuth2RefreshToken, error) {
+	if prev == nil || prev.RefreshToken == "" {
+		return newRefreshFamily()
+	}
+
+	refreshToken := new(OAuth2RefreshToken)
+	if err := tx.Where("refresh_token = ?", prev.RefreshToken).Find(refreshToken).Error; err != nil {
+		return nil, err
+	}
+
+	// Only one request may rotate a refresh token. If another request got there
+	// first the token has been used twice.
+	res := tx.Model(&OAuth2RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", refreshToken.ID).
+		UpdateColumn("used_at", time.Now())
+
+	if res.Error != nil {
+		return nil, res.Error
+	}
+
+	if res.RowsAffected != 1 {
+		return nil, ErrRefreshTokenReused
+	}
+
+	if err := s.revokeAccess(tx, "id = ?", refreshToken.AccessTokenId); err != nil {
+		return nil, err
+	}
+
+	if refreshToken.Family == "" {
+		return newRefreshFamily()
+	}
+
+	if refreshToken.SignedInAt.IsZero() {
+		refreshToken.SignedInAt = refreshToken.CreatedAt
+	}
+
+	return refreshToken, nil
+}
+
+func newRefreshFamily() (*OAuth2RefreshToken, error) {
+	family, err := randomString(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuth2RefreshToken{Family: family, SignedInAt: time.Now()}, nil
+}
+
+func (s *GORMStorage) LoadAccess(ctx context.Context, token string) (data *osin.AccessData, err error) {
+	defer s.trace(ctx, "LoadAccess")(&err)
+
 	accessToken := new(OAuth2AccessToken)
-	if err := s.db.Where("access_token = ?", token).Preload("Client").Preload("User").Find(accessToken).Error; err != nil {
+	if err := s.db.Where("token_hash = ?", hashToken(token)).Preload("Client").Preload("User").Find(accessToken).Error; err != nil {
 		return nil, osin.ErrNotFound
 	}
 
@@ -146,32 +352,195 @@ func (s *GORMStorage) LoadAccess(token string) (*osin.AccessData, error) {
 	return t, nil
 }
 
-func (s *GORMStorage) RemoveAccess(token string) error {
-	if err := s.db.Where("access_token = ?", token).Delete(&OAuth2AccessToken{}).Error; err != nil {
+func (s *GORMStorage) RemoveAccess(ctx context.Context, token string) (err error) {
+	defer s.trace(ctx, "RemoveAccess")(&err)
+
+	if err := s.revokeAccess(s.db, "token_hash = ?", hashToken(token)); err != nil {
 		return err
 	}
 
+	s.metrics.Revoked(RevocationToken)
+
 	return nil
 }
 
-func (s *GORMStorage) LoadRefresh(token string) (*osin.AccessData, error) {
+// revokeAccess deletes the access tokens matching the condition. Self-contained tokens
+// are also added to the denylist, as deleting them does not stop them verifying.
+func (s *GORMStorage) revokeAccess(tx *gorm.DB, condition string, args ...interface{}) error {
+	if s.config.AccessTokenFormat == AccessTokenJWT {
+		var tokens []*OAuth2AccessToken
+		if err := tx.Where(condition, args...).Find(&tokens).Error; err != nil {
+			return err
+		}
+
+		for _, t := range tokens {
+			if err := s.denylist.Revoke(tx, t.AccessToken, t.Expires); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Where(condition, args...).Delete(&OAuth2AccessToken{}).Error
+}
+
+func (s *GORMStorage) LoadRefresh(ctx context.Context, token string) (data *osin.AccessData, err error) {
+	defer s.trace(ctx, "LoadRefresh")(&err)
+
 	refreshToken := new(OAuth2RefreshToken)
-	if err := s.db.Where("refresh_token = ?", token).Preload("AccessToken").Find(refreshToken).Error; err != nil {
+	err = s.db.Where("refresh_token = ?", token).
+		Preload("AccessToken").
+		Preload("Client").
+		Preload("User").
+		Find(refreshToken).Error
+
+	if err != nil {
 		return nil, osin.ErrNotFound
 	}
 
-	t, err := s.LoadAccess(refreshToken.AccessToken.AccessToken)
-	if err != nil {
+	if refreshToken.UsedAt != nil {
+		// The token has already been rotated, so either it or its successor has
+		// leaked. Revoke every token descended from the same login.
+		if err := s.RevokeFamily(ctx, refreshToken); err != nil {
+			return nil, err
+		}
+
+		return nil, ErrRefreshTokenReused
+	}
+
+	if refreshToken.Expires.Before(time.Now()) || refreshToken.Client == nil || refreshToken.User == nil {
 		return nil, osin.ErrNotFound
 	}
 
+	t := &osin.AccessData{
+		Client:       refreshToken.Client,
+		UserData:     refreshToken.User,
+		RedirectUri:  refreshToken.Client.RedirectURI,
+		CreatedAt:    refreshToken.CreatedAt,
+		Scope:        refreshToken.Scope,
+		RefreshToken: refreshToken.RefreshToken,
+	}
+
+	if refreshToken.AccessToken != nil {
+		t.AccessToken = refreshToken.AccessToken.AccessToken
+		t.ExpiresIn = int32(refreshToken.AccessToken.Expires.Sub(time.Now()).Seconds())
+	}
+
 	return t, nil
 }
 
-func (s *GORMStorage) RemoveRefresh(token string) error {
+func (s *GORMStorage) RemoveRefresh(ctx context.Context, token string) (err error) {
+	defer s.trace(ctx, "RemoveRefresh")(&err)
+
 	if err := s.db.Where("refresh_token = ?", token).Delete(&OAuth2RefreshToken{}).Error; err != nil {
 		return err
 	}
 
 	return nil
 }
+
+func (s *GORMStorage) revokeRefresh(ctx context.Context, token string) error {
+	refreshToken := new(OAuth2RefreshToken)
+	if err := s.db.Where("refresh_token = ?", token).Find(refreshToken).Error; err != nil {
+		return err
+	}
+
+	return s.RevokeFamily(ctx, refreshToken)
+}
+
+// RevokeFamily removes every access and refresh token that shares a family with the
+// given refresh token. Tokens issued before families were tracked are revoked alone.
+func (s *GORMStorage) RevokeFamily(ctx context.Context, refreshToken *OAuth2RefreshToken) (err error) {
+	defer s.trace(ctx, "RevokeFamily")(&err)
+
+	var refreshTokens []*OAuth2RefreshToken
+
+	query := s.db.Where("id = ?", refreshToken.ID)
+	if refreshToken.Family != "" {
+		query = s.db.Where("family = ?", refreshToken.Family)
+	}
+
+	if err := query.Find(&refreshTokens).Error; err != nil {
+		return err
+	}
+
+	var refreshIds, accessIds []uint
+	for _, t := range refreshTokens {
+		refreshIds = append(refreshIds, t.ID)
+		accessIds = append(accessIds, t.AccessTokenId)
+	}
+
+	if len(refreshIds) == 0 {
+		return nil
+	}
+
+	tx := s.db.Begin()
+
+	if err := s.revokeAccess(tx, "id IN (?)", accessIds); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Where("id IN (?)", refreshIds).Delete(&OAuth2RefreshToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	s.metrics.Revoked(RevocationSession)
+
+	return nil
+}
+
+// RevokeClient removes every access and refresh token issued to a client
+func (s *GORMStorage) RevokeClient(ctx context.Context, client *OAuth2Client) (err error) {
+	defer s.trace(ctx, "RevokeClient")(&err)
+
+	return s.revokeAll(RevocationClient, "client_id = ?", client.ID)
+}
+
+// RevokeUser removes every access and refresh token issued to a user
+func (s *GORMStorage) RevokeUser(ctx context.Context, user *User) (err error) {
+	defer s.trace(ctx, "RevokeUser")(&err)
+
+	return s.revokeAll(RevocationUser, "user_id = ?", user.ID)
+}
+
+// RevokeUserAccess removes the access tokens issued to a user but keeps their refresh
+// tokens, so clients pick up a change to the user, such as a new role, by refreshing
+func (s *GORMStorage) RevokeUserAccess(ctx context.Context, user *User) (err error) {
+	defer s.trace(ctx, "RevokeUserAccess")(&err)
+
+	tx := s.db.Begin()
+
+	if err := s.revokeAccess(tx, "user_id = ?", user.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+func (s *GORMStorage) revokeAll(kind string, condition string, args ...interface{}) error {
+	tx := s.db.Begin()
+
+	if err := s.revokeAccess(tx, condition, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Where(condition, args...).Delete(&OAuth2RefreshToken{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+
+	s.metrics.Revoked(kind)
+
+	return nil
+}
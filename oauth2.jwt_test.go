@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"time"
+)
+
+func newJWTTestApp(algorithm string) *App {
+	config := NewOAuth2Config()
+	config.AccessTokenFormat = AccessTokenJWT
+	config.SigningAlgorithm = algorithm
+
+	return newTestApp(app.Db(), config)
+}
+
+func requestPasswordToken(a *App) (*httptest.ResponseRecorder, string) {
+	w := requestToken(a, "1", "secret", url.Values{
+		"grant_type": {"password"},
+		"username":   {"test2@go-notes.com"},
+		"password":   {"password"},
+		"scope":      {"email"},
+	})
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &token)
+
+	return w, token.AccessToken
+}
+
+func TestJWTAccessTokenGen_IssueAndVerify(t *testing.T) {
+	for _, algorithm := range []string{SigningAlgorithmRS256, SigningAlgorithmEdDSA} {
+		a := newJWTTestApp(algorithm)
+
+		w, token := requestPasswordToken(a)
+		if w.Code != http.StatusCreated {
+			t.Errorf("%s: Expected status code '201', got '%d'", algorithm, w.Code)
+			continue
+		}
+
+		if !isJWT(token) {
+			t.Errorf("%s: Expected a JWT access token, got '%s'", algorithm, token)
+			continue
+		}
+
+		ad, err := a.OAuth2Server().AccessTokenGen.(*JWTAccessTokenGen).Verify(token)
+		if err != nil {
+			t.Errorf("%s: Could not verify token: '%s'", algorithm, err.Error())
+			continue
+		}
+
+		if user := ad.UserData.(*User); user.ID != 2 || user.Email != "test2@go-notes.com" || user.Role != RoleUser {
+			t.Errorf("%s: Expected user '2' with the user role, got '%d' with '%s'", algorithm, user.ID, user.Role)
+		}
+	}
+}
+
+func TestAuthMiddleware_JWTAccessToken(t *testing.T) {
+	a := newJWTTestApp(SigningAlgorithmRS256)
+	_, token := requestPasswordToken(a)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/notes", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	testHTTPResponse(t, a.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusOK
+	})
+
+	if err := a.OAuth2Server().Storage.RemoveAccess(token); err != nil {
+		t.Errorf("Could not revoke token: '%s'", err.Error())
+		return
+	}
+
+	testHTTPResponse(t, a.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusUnauthorized
+	})
+}
+
+func TestAuthMiddleware_JWTFromAnotherKeySetIsRejected(t *testing.T) {
+	key, err := generateSigningKey(SigningAlgorithmRS256)
+	if err != nil {
+		t.Fatalf("Could not generate signing key: '%s'", err.Error())
+	}
+
+	a := newJWTTestApp(SigningAlgorithmRS256)
+	claims := &AccessTokenClaims{RegisteredClaims: jwt.RegisteredClaims{
+		Issuer:    a.OAuth2Config().Issuer,
+		Subject:   "2",
+		IssuedAt:  jwt.NewNumericDate(time.Now()),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.ID
+	signed, _ := token.SignedString(key.Private)
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/notes", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", signed))
+
+	testHTTPResponse(t, a.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusUnauthorized
+	})
+}
+
+func TestAuthMiddleware_JWTFromAnotherInstanceIsAccepted(t *testing.T) {
+	_, token := requestPasswordToken(newJWTTestApp(SigningAlgorithmRS256))
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/notes", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	// Another instance, or the same one after a restart, loads the same keys
+	testHTTPResponse(t, newJWTTestApp(SigningAlgorithmRS256).Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusOK
+	})
+}
+
+func TestKeySet_Rotate(t *testing.T) {
+	keys, err := NewKeySet(app.Db(), SigningAlgorithmEdDSA, 0, 3600e9, time.Minute)
+	if err != nil {
+		t.Errorf("Could not create key set: '%s'", err.Error())
+		return
+	}
+
+	published := len(keys.JWKS().Keys)
+	first, _ := keys.Current()
+	second, _ := keys.Current()
+
+	if first.ID == second.ID {
+		t.Error("Expected a new signing key after rotation")
+		return
+	}
+
+	if keys.Key(first.ID) == nil {
+		t.Error("Expected retired key to be retained")
+		return
+	}
+
+	if n := len(keys.JWKS().Keys); n != published+2 {
+		t.Errorf("Expected '%d' published keys, got '%d'", published+2, n)
+	}
+}
+
+func TestKeySet_LoadsKeysRotatedByAnotherInstance(t *testing.T) {
+	keys, _ := NewKeySet(app.Db(), SigningAlgorithmRS256, time.Hour, time.Hour, time.Hour)
+	other, _ := NewKeySet(app.Db(), SigningAlgorithmRS256, time.Hour, time.Hour, time.Hour)
+
+	if err := other.Rotate(); err != nil {
+		t.Fatalf("Could not rotate keys: '%s'", err.Error())
+	}
+
+	rotated, _ := other.Current()
+	time.Sleep(unknownKeyReload)
+
+	if key := keys.Key(rotated.ID); key == nil || key.CreatedAt.Unix() != rotated.CreatedAt.Unix() {
+		t.Errorf("Expected key '%s' rotated by another instance to be found", rotated.ID)
+	}
+}
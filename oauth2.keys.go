@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"math/big"
+	"sync"
+	"time"
+)
+
+const (
+	SigningAlgorithmRS256 = "RS256"
+	SigningAlgorithmEdDSA = "EdDSA"
+)
+
+// How often keys may be reloaded to look for one a token names but the set lacks
+const unknownKeyReload = time.Second
+
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Private   crypto.Signer
+	CreatedAt time.Time
+}
+
+func (k *SigningKey) Public() crypto.PublicKey {
+	return k.Private.Public()
+}
+
+// KeySet holds the keys used to sign tokens. The newest key signs new tokens and is
+// replaced once it is older than the rotation interval. Retired keys are kept for
+// the retention period so that tokens they signed can still be verified.
+//
+// Keys are stored in the database, which every instance reloads them from every
+// syncInterval, so tokens stay valid across restarts and instances. Private keys are
+// stored unencrypted.
+type KeySet struct {
+	db           *gorm.DB
+	mu           sync.RWMutex
+	algorithm    string
+	rotation     time.Duration
+	retention    time.Duration
+	syncInterval time.Duration
+	// newest first
+	keys     []*SigningKey
+	syncedAt time.Time
+}
+
+func NewKeySet(db *gorm.DB, algorithm string, rotation time.Duration, retention time.Duration, syncInterval time.Duration) (*KeySet, error) {
+	if algorithm != SigningAlgorithmRS256 && algorithm != SigningAlgorithmEdDSA {
+		return nil, fmt.Errorf("Unsupported signing algorithm '%s'", algorithm)
+	}
+
+	k := &KeySet{
+		db:           db,
+		algorithm:    algorithm,
+		rotation:     rotation,
+		retention:    retention,
+		syncInterval: syncInterval,
+	}
+
+	if _, err := k.Current(); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+// Rotate stores a new key, which signs new tokens from then on
+func (k *KeySet) Rotate() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	return k.rotate()
+}
+
+func (k *KeySet) rotate() error {
+	key, err := generateSigningKey(k.algorithm)
+	if err != nil {
+		return err
+	}
+
+	private, err := x509.MarshalPKCS8PrivateKey(key.Private)
+	if err != nil {
+		return err
+	}
+
+	record := &OAuth2SigningKey{
+		Kid:        key.ID,
+		Algorithm:  key.Algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private})),
+	}
+
+	if err := k.db.Create(record).Error; err != nil {
+		return err
+	}
+
+	return k.load()
+}
+
+// load replaces the keys with the stored ones, deleting those retired for longer than
+// the retention period
+func (k *KeySet) load() error {
+	var records []*OAuth2SigningKey
+	if err := k.db.Order("id DESC").Find(&records).Error; err != nil {
+		return err
+	}
+
+	var keys []*SigningKey
+	for i, record := range records {
+		// A key stopped signing when its successor was created
+		if i > 0 && time.Since(records[i-1].CreatedAt) > k.retention {
+			if err := k.db.Where("id <= ?", record.ID).Delete(&OAuth2SigningKey{}).Error; err != nil {
+				return err
+			}
+
+			break
+		}
+
+		key, err := parseSigningKey(record)
+		if err != nil {
+			return err
+		}
+
+		keys = append(keys, key)
+	}
+
+	k.keys = keys
+	k.syncedAt = time.Now()
+
+	return nil
+}
+
+// sync reloads the keys if they were loaded longer than maxAge ago
+func (k *KeySet) sync(maxAge time.Duration) error {
+	k.mu.RLock()
+	stale := time.Since(k.syncedAt) > maxAge
+	k.mu.RUnlock()
+
+	if !stale {
+		return nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if time.Since(k.syncedAt) <= maxAge {
+		return nil
+	}
+
+	return k.load()
+}
+
+// current returns the newest key unless it is due to be rotated
+func (k *KeySet) current() *SigningKey {
+	if len(k.keys) == 0 {
+		return nil
+	}
+
+	key := k.keys[0]
+	if key.Algorithm != k.algorithm || time.Since(key.CreatedAt) >= k.rotation {
+		return nil
+	}
+
+	return key
+}
+
+// Current returns the key new tokens should be signed with, rotating it if it is due
+func (k *KeySet) Current() (*SigningKey, error) {
+	if err := k.sync(k.syncInterval); err != nil {
+		return nil, err
+	}
+
+	k.mu.RLock()
+	key := k.current()
+	k.mu.RUnlock()
+
+	if key != nil {
+		return key, nil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	// Another caller, or instance, may have rotated the key in the meantime
+	if err := k.load(); err != nil {
+		return nil, err
+	}
+
+	if key := k.current(); key != nil {
+		return key, nil
+	}
+
+	if err := k.rotate(); err != nil {
+		return nil, err
+	}
+
+	return k.keys[0], nil
+}
+
+func (k *KeySet) Key(id string) *SigningKey {
+	if key := k.find(id); key != nil {
+		return key
+	}
+
+	// The key may have been created by another instance since the last sync
+	if err := k.sync(unknownKeyReload); err != nil {
+		return nil
+	}
+
+	return k.find(id)
+}
+
+func (k *KeySet) find(id string) *SigningKey {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	for _, key := range k.keys {
+		if key.ID == id {
+			return key
+		}
+	}
+
+	return nil
+}
+
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []*JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys of the set in RFC 7517 format
+func (k *KeySet) JWKS() *JSONWebKeySet {
+	k.sync(k.syncInterval)
+
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := &JSONWebKeySet{Keys: []*JSONWebKey{}}
+
+	for _, key := range k.keys {
+		jwk := &JSONWebKey{Use: "sig", Alg: key.Algorithm, Kid: key.ID}
+
+		switch pub := key.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
+
+func generateSigningKey(algorithm string) (*SigningKey, error) {
+	var private crypto.Signer
+	var err error
+
+	switch algorithm {
+	case SigningAlgorithmRS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case SigningAlgorithmEdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		err = fmt.Errorf("Unsupported signing algorithm '%s'", algorithm)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := randomString(12)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{id, algorithm, private, time.Now()}, nil
+}
+
+func parseSigningKey(record *OAuth2SigningKey) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(record.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("Signing key '%s' is not PEM encoded", record.Kid)
+	}
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("Signing key '%s' cannot sign", record.Kid)
+	}
+
+	return &SigningKey{record.Kid, record.Algorithm, signer, record.CreatedAt}, nil
+}
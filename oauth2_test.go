@@ -16,9 +16,9 @@ func TestGORMStorage_GetClient(t *testing.T) {
 		return
 	}
 
-	client, clientOk := c.(*OAuth2Client)
+	client, clientOk := c.(*osinClient)
 	if !clientOk {
-		t.Errorf("Could not assert type *OAuth2Client")
+		t.Errorf("Could not assert type *osinClient")
 		return
 	}
 
@@ -116,7 +116,7 @@ func TestGORMStorage_RemoveAccess(t *testing.T) {
 	}
 
 	if err := app.Db().Create(token).Error; err != nil {
-		t.Errorf("Could not create access token: '%s'", err.Error)
+		t.Errorf("Could not create access token: '%s'", err.Error())
 		return
 	}
 
@@ -187,3 +187,60 @@ func TestGORMStorage_LoadRefresh(t *testing.T) {
 		return
 	}
 }
+
+func TestGORMStorage_SaveAccessRotatesRefreshToken(t *testing.T) {
+	s := app.OAuth2Server().Storage
+	prev := &OAuth2RefreshToken{
+		RefreshToken: uuid.NewV4().String(),
+		Family:       "rotate-family",
+		Expires:      time.Now().Add(time.Hour),
+		ClientId:     1,
+		UserId:       1,
+		Scope:        "email",
+	}
+
+	if err := app.Db().Create(prev).Error; err != nil {
+		t.Errorf("Could not create refresh token: '%s'", err.Error())
+		return
+	}
+
+	ad, err := s.LoadRefresh(prev.RefreshToken)
+	if err != nil {
+		t.Errorf("Could not load refresh token: '%s'", err.Error())
+		return
+	}
+
+	next := &osin.AccessData{
+		Client:       ad.Client,
+		AccessData:   ad,
+		UserData:     ad.UserData,
+		AccessToken:  uuid.NewV4().String(),
+		RefreshToken: uuid.NewV4().String(),
+		ExpiresIn:    3600,
+		Scope:        "email",
+		CreatedAt:    time.Now(),
+	}
+
+	if err := s.SaveAccess(next); err != nil {
+		t.Errorf("Unable to save access token: '%s'", err.Error())
+		return
+	}
+
+	saved := new(OAuth2RefreshToken)
+	app.Db().Where("refresh_token = ?", next.RefreshToken).Find(saved)
+
+	if saved.Family != "rotate-family" {
+		t.Errorf("Expected family 'rotate-family', got '%s'", saved.Family)
+		return
+	}
+
+	if _, err := s.LoadRefresh(prev.RefreshToken); err != ErrRefreshTokenReused {
+		t.Errorf("Expected error '%s', got '%v'", ErrRefreshTokenReused, err)
+		return
+	}
+
+	if _, err := s.LoadRefresh(next.RefreshToken); err != osin.ErrNotFound {
+		t.Errorf("Expected family to be revoked, got '%v'", err)
+		return
+	}
+}
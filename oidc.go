@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/golang-jwt/jwt/v4"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeOpenID  = "openid"
+	ScopeEmail   = "email"
+	ScopeProfile = "profile"
+)
+
+// UserInfoClaims are the standard OpenID Connect claims derived from a User. Which
+// claims are set depends on the scopes granted to the client.
+type UserInfoClaims struct {
+	Subject    string `json:"sub"`
+	Email      string `json:"email,omitempty"`
+	GivenName  string `json:"given_name,omitempty"`
+	FamilyName string `json:"family_name,omitempty"`
+}
+
+func NewUserInfoClaims(user *User, scope string) *UserInfoClaims {
+	claims := &UserInfoClaims{Subject: strconv.Itoa(int(user.ID))}
+
+	if hasScope(scope, ScopeEmail) {
+		claims.Email = user.Email
+	}
+
+	if hasScope(scope, ScopeProfile) {
+		claims.GivenName = user.Firstname
+		claims.FamilyName = user.Lastname
+	}
+
+	return claims
+}
+
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	AuthTime   *jwt.NumericDate `json:"auth_time,omitempty"`
+	Email      string           `json:"email,omitempty"`
+	GivenName  string           `json:"given_name,omitempty"`
+	FamilyName string           `json:"family_name,omitempty"`
+}
+
+// IDTokenIssuer signs OpenID Connect ID tokens with the same keys as JWT access tokens
+type IDTokenIssuer struct {
+	keys   *KeySet
+	config *OAuth2Config
+}
+
+func NewIDTokenIssuer(keys *KeySet, config *OAuth2Config) *IDTokenIssuer {
+	return &IDTokenIssuer{keys, config}
+}
+
+// Issue returns an ID token for user addressed to clientId. authTime is the time the
+// user entered their credentials, or the zero time if it is not known.
+func (i *IDTokenIssuer) Issue(user *User, clientId string, scope string, authTime time.Time) (string, error) {
+	now := time.Now()
+	info := NewUserInfoClaims(user, scope)
+
+	claims := &IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    i.config.Issuer,
+			Subject:   info.Subject,
+			Audience:  jwt.ClaimStrings{clientId},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Duration(i.config.AccessExpiration) * time.Second)),
+		},
+		Email:      info.Email,
+		GivenName:  info.GivenName,
+		FamilyName: info.FamilyName,
+	}
+
+	if !authTime.IsZero() {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
+
+	return signJWT(i.keys, claims)
+}
+
+func hasScope(scope string, want string) bool {
+	for _, s := range strings.Fields(scope) {
+		if s == want {
+			return true
+		}
+	}
+
+	return false
+}
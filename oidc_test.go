@@ -0,0 +1,107 @@
+package main
+
+import (
+	"testing"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"bytes"
+	"encoding/json"
+	"context"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+func newOIDCTestServer() (*App, *httptest.Server) {
+	var a *App
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a.Engine().ServeHTTP(w, r)
+	}))
+
+	config := NewOAuth2Config()
+	config.Issuer = srv.URL
+	a = newTestApp(app.Db(), config)
+
+	return a, srv
+}
+
+func TestOIDC_IDTokenVerifiesWithStandardClient(t *testing.T) {
+	_, srv := newOIDCTestServer()
+	defer srv.Close()
+
+	ctx := context.Background()
+	provider, err := oidc.NewProvider(ctx, srv.URL)
+	if err != nil {
+		t.Errorf("Could not discover provider: '%s'", err.Error())
+		return
+	}
+
+	params := url.Values{}
+	params.Add("grant_type", "password")
+	params.Add("username", "test2@go-notes.com")
+	params.Add("password", "password")
+	params.Add("client_id", "1")
+	params.Add("client_secret", "secret")
+	params.Add("scope", "openid email profile")
+
+	resp, err := http.Post(srv.URL+"/token", "application/x-www-form-urlencoded", bytes.NewBufferString(params.Encode()))
+	if err != nil {
+		t.Errorf("Could not request token: '%s'", err.Error())
+		return
+	}
+	defer resp.Body.Close()
+
+	token := struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}{}
+
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		t.Errorf("Unable to unmarshal json: '%s'", err.Error())
+		return
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: "1"}).Verify(ctx, token.IDToken)
+	if err != nil {
+		t.Errorf("Could not verify id token: '%s'", err.Error())
+		return
+	}
+
+	claims := new(UserInfoClaims)
+	idToken.Claims(claims)
+
+	if idToken.Subject != "2" || claims.Email != "test2@go-notes.com" || claims.GivenName != "Go2" || claims.FamilyName != "Notes2" {
+		t.Errorf("Unexpected id token claims '%+v'", claims)
+		return
+	}
+
+	info, err := provider.UserInfo(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token.AccessToken}))
+	if err != nil {
+		t.Errorf("Could not load user info: '%s'", err.Error())
+		return
+	}
+
+	if info.Subject != "2" || info.Email != "test2@go-notes.com" {
+		t.Errorf("Unexpected user info '%+v'", info)
+	}
+}
+
+func TestUserInfoHandler_RequiresOpenIDScope(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer access-token")
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		return w.Code == http.StatusForbidden
+	})
+}
+
+func TestAuthHandler_TokenWithoutOpenIDScopeHasNoIDToken(t *testing.T) {
+	w, _ := requestPasswordToken(app)
+
+	token := map[string]interface{}{}
+	json.Unmarshal(w.Body.Bytes(), &token)
+
+	if _, ok := token["id_token"]; ok {
+		t.Error("Expected no id token without the openid scope")
+	}
+}
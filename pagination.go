@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Pagination selects a page of a list by its number or, in cursor mode, by the id after
+// which it starts. Cursor mode stays fast however deep the page, and items inserted
+// while a client pages through are never skipped or repeated.
+type Pagination struct {
+	PerPage  int
+	Page     int
+	Cursored bool
+	After    uint
+	// Set by paginate: the number of items, outside of cursor mode, and the id to
+	// start the next page after, if there is one
+	Total int
+	Next  uint
+}
+
+type cursor struct {
+	After uint `json:"after"`
+}
+
+func encodeCursor(after uint) string {
+	contents, _ := json.Marshal(cursor{after})
+
+	return base64.RawURLEncoding.EncodeToString(contents)
+}
+
+func decodeCursor(s string) (uint, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	contents, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return 0, err
+	}
+
+	c := new(cursor)
+	if err := json.Unmarshal(contents, c); err != nil {
+		return 0, err
+	}
+
+	return c.After, nil
+}
+
+// readPagination reads the page, per_page and cursor query parameters, responding
+// with a validation error if one is invalid
+func readPagination(c *gin.Context, config PaginationConfig, responseHandler ResponseHandler) (*Pagination, bool) {
+	p := &Pagination{PerPage: config.DefaultPerPage, Page: 1}
+
+	if perPage, ok := c.GetQuery("per_page"); ok {
+		n, err := strconv.Atoi(perPage)
+		if err != nil || n < 1 || n > config.MaxPerPage {
+			responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "The per_page parameter must be a number from 1 to {0}", config.MaxPerPage)
+			return nil, false
+		}
+
+		p.PerPage = n
+	}
+
+	if s, ok := c.GetQuery("cursor"); ok {
+		after, err := decodeCursor(s)
+		if err != nil {
+			responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "The cursor parameter is invalid")
+			return nil, false
+		}
+
+		p.Cursored = true
+		p.After = after
+
+		return p, true
+	}
+
+	if page, ok := c.GetQuery("page"); ok {
+		n, err := strconv.Atoi(page)
+		if err != nil || n < 1 {
+			responseHandler.Error(c, ValidationError, http.StatusUnprocessableEntity, "The page parameter must be a positive number")
+			return nil, false
+		}
+
+		p.Page = n
+	}
+
+	return p, true
+}
+
+// paginate finds the page of query selected by p into out, a pointer to a slice of
+// models, in order of id
+func paginate(query *gorm.DB, p *Pagination, out interface{}) error {
+	if p.Cursored {
+		// One more than a page is found to tell whether there is a next page
+		if err := query.Where("id > ?", p.After).Order("id").Limit(p.PerPage + 1).Find(out).Error; err != nil {
+			return err
+		}
+
+		items := reflect.ValueOf(out).Elem()
+		if items.Len() > p.PerPage {
+			items.Set(items.Slice(0, p.PerPage))
+			p.Next = uint(reflect.Indirect(items.Index(p.PerPage - 1)).FieldByName("ID").Uint())
+		}
+
+		return nil
+	}
+
+	if err := query.Model(out).Count(&p.Total).Error; err != nil {
+		return err
+	}
+
+	// Pages past the last are empty, and their offset could overflow
+	if p.Page > p.PageCount() {
+		items := reflect.ValueOf(out).Elem()
+		items.Set(reflect.MakeSlice(items.Type(), 0, 0))
+
+		return nil
+	}
+
+	return query.Order("id").Limit(p.PerPage).Offset((p.Page - 1) * p.PerPage).Find(out).Error
+}
+
+// PageCount returns the number of pages, outside of cursor mode
+func (p *Pagination) PageCount() int {
+	return (p.Total + p.PerPage - 1) / p.PerPage
+}
+
+func (p *Pagination) Meta() map[string]interface{} {
+	if p.Cursored {
+		meta := map[string]interface{}{"per_page": p.PerPage}
+		if p.Next != 0 {
+			meta["next_cursor"] = encodeCursor(p.Next)
+		}
+
+		return meta
+	}
+
+	return map[string]interface{}{
+		"page":       p.Page,
+		"per_page":   p.PerPage,
+		"total":      p.Total,
+		"page_count": p.PageCount(),
+	}
+}
+
+// Links returns an RFC 8288 Link header value for the pages around p of the list at u
+func (p *Pagination) Links(u *url.URL) string {
+	link := func(rel string, param string, value string) string {
+		query := u.Query()
+		query.Del("page")
+		query.Del("cursor")
+		query.Set("per_page", strconv.Itoa(p.PerPage))
+		query.Set(param, value)
+
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, u.Path, query.Encode(), rel)
+	}
+
+	var links []string
+
+	if p.Cursored {
+		links = append(links, link("first", "cursor", ""))
+		if p.Next != 0 {
+			links = append(links, link("next", "cursor", encodeCursor(p.Next)))
+		}
+
+		return strings.Join(links, ", ")
+	}
+
+	last := p.PageCount()
+	if last < 1 {
+		last = 1
+	}
+
+	links = append(links, link("first", "page", "1"))
+	if p.Page > 1 {
+		links = append(links, link("prev", "page", strconv.Itoa(p.Page-1)))
+	}
+	if p.Page < last {
+		links = append(links, link("next", "page", strconv.Itoa(p.Page+1)))
+	}
+	links = append(links, link("last", "page", strconv.Itoa(last)))
+
+	return strings.Join(links, ", ")
+}
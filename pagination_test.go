@@ -0,0 +1,139 @@
+package main
+
+import (
+	"testing"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+type testPage struct {
+	Code  int
+	Data  []*BaseModel           `json:"data"`
+	Meta  map[string]interface{} `json:"meta"`
+	Links string
+}
+
+func getTestPage(t *testing.T, path string) *testPage {
+	req, _ := http.NewRequest(http.MethodGet, path, nil)
+	req.Header.Set("Authorization", "Bearer access-token")
+
+	w := httptest.NewRecorder()
+	app.Engine().ServeHTTP(w, req)
+
+	page := &testPage{Code: w.Code, Links: w.Header().Get("Link")}
+	if w.Code == http.StatusOK {
+		if err := json.Unmarshal(w.Body.Bytes(), page); err != nil {
+			t.Fatalf("Failed to unmarshal json: '%s'", err.Error())
+		}
+	}
+
+	return page
+}
+
+func TestPagination_PageMode(t *testing.T) {
+	var total int
+	app.Db().Model(&Note{}).Where("created_by = ? AND workspace_id = 0", 1).Count(&total)
+
+	page := getTestPage(t, "/v1/notes?page=2&per_page=3")
+	if page.Code != http.StatusOK || len(page.Data) != 3 {
+		t.Fatalf("Expected 3 notes, got '%d' with status '%d'", len(page.Data), page.Code)
+	}
+
+	pageCount := (total + 2) / 3
+	if page.Meta["total"] != float64(total) || page.Meta["page_count"] != float64(pageCount) || page.Meta["page"] != float64(2) || page.Meta["per_page"] != float64(3) {
+		t.Errorf("Expected meta for page 2 of %d, got '%v'", pageCount, page.Meta)
+	}
+
+	for _, link := range []string{
+		`</v1/notes?page=1&per_page=3>; rel="first"`,
+		`</v1/notes?page=1&per_page=3>; rel="prev"`,
+		`</v1/notes?page=3&per_page=3>; rel="next"`,
+		`rel="last"`,
+	} {
+		if !strings.Contains(page.Links, link) {
+			t.Errorf("Expected Link header to contain '%s', got '%s'", link, page.Links)
+		}
+	}
+
+	if page := getTestPage(t, "/v1/tags?per_page=1"); page.Code != http.StatusOK || len(page.Data) != 1 || page.Meta["per_page"] != float64(1) {
+		t.Errorf("Expected a page of 1 tag, got '%d' with status '%d'", len(page.Data), page.Code)
+	}
+}
+
+func TestPagination_PastLastPage(t *testing.T) {
+	// The offset of such a page would overflow
+	page := getTestPage(t, "/v1/notes?page=9223372036854775807&per_page=100")
+	if page.Code != http.StatusOK || page.Data == nil || len(page.Data) != 0 {
+		t.Fatalf("Expected an empty page, got '%d' notes with status '%d'", len(page.Data), page.Code)
+	}
+
+	if !strings.Contains(page.Links, `rel="first"`) || strings.Contains(page.Links, `rel="next"`) {
+		t.Errorf("Expected no next link past the last page, got '%s'", page.Links)
+	}
+}
+
+func TestPagination_RejectsInvalidParameters(t *testing.T) {
+	for _, path := range []string{
+		"/v1/notes?page=abc",
+		"/v1/notes?page=0",
+		"/v1/notes?per_page=0",
+		"/v1/notes?per_page=101",
+		"/v1/tags?cursor=not-a-cursor",
+	} {
+		if page := getTestPage(t, path); page.Code != http.StatusUnprocessableEntity {
+			t.Errorf("Expected status code 422 for '%s', got '%d'", path, page.Code)
+		}
+	}
+}
+
+func TestPagination_CursorMode(t *testing.T) {
+	var total int
+	app.Db().Model(&Note{}).Where("created_by = ? AND workspace_id = 0", 1).Count(&total)
+
+	seen := map[uint]bool{}
+	var last uint
+	inserted := false
+
+	for path := "/v1/notes?per_page=4&cursor="; path != ""; {
+		page := getTestPage(t, path)
+		if page.Code != http.StatusOK {
+			t.Fatalf("Expected status code 200, got '%d'", page.Code)
+		}
+
+		if _, ok := page.Meta["total"]; ok {
+			t.Errorf("Expected no total in cursor mode")
+		}
+
+		for _, note := range page.Data {
+			if seen[note.ID] || note.ID <= last {
+				t.Errorf("Expected notes in order of id without repeats, got '%d' after '%d'", note.ID, last)
+			}
+
+			seen[note.ID] = true
+			last = note.ID
+		}
+
+		// A note added while paging is found on a later page
+		if !inserted {
+			note := &Note{Title: "Inserted while paging", CreatedById: 1}
+			app.Db().Create(note)
+			defer app.Db().Delete(note)
+			inserted = true
+		}
+
+		path = ""
+		if next, ok := page.Meta["next_cursor"].(string); ok {
+			path = "/v1/notes?per_page=4&cursor=" + next
+
+			if !strings.Contains(page.Links, `cursor=`+next) {
+				t.Errorf("Expected a next link with cursor '%s', got '%s'", next, page.Links)
+			}
+		}
+	}
+
+	if len(seen) != total+1 {
+		t.Errorf("Expected %d notes, got '%d'", total+1, len(seen))
+	}
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+)
+
+// randomString returns a URL safe string encoding n random bytes
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
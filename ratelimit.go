@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimitStoreMemory = "memory"
+	RateLimitStoreRedis  = "redis"
+)
+
+// RateLimit is a token bucket holding up to Requests requests, refilled at Requests
+// every Period
+type RateLimit struct {
+	Requests int           `yaml:"requests" validate:"min=1"`
+	Period   time.Duration `yaml:"period" validate:"min=1"`
+}
+
+// interval returns how long the bucket takes to refill one request
+func (l RateLimit) interval() float64 {
+	return float64(l.Period) / float64(l.Requests)
+}
+
+// take refills a bucket holding tokens for elapsed, then takes a request from it if
+// one is left
+func (l RateLimit) take(tokens float64, elapsed time.Duration) (float64, bool) {
+	tokens = math.Min(float64(l.Requests), tokens+math.Max(0, float64(elapsed))/l.interval())
+
+	if tokens < 1 {
+		return tokens, false
+	}
+
+	return tokens - 1, true
+}
+
+func (l RateLimit) result(tokens float64, allowed bool) *RateLimitResult {
+	result := &RateLimitResult{
+		Allowed:   allowed,
+		Limit:     l.Requests,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     time.Duration((float64(l.Requests) - tokens) * l.interval()),
+	}
+
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) * l.interval())
+	}
+
+	return result
+}
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// How long until the bucket is full again
+	Reset time.Duration
+	// How long until another request is allowed, if this one was not
+	RetryAfter time.Duration
+}
+
+type RateLimitStore interface {
+	// Take takes a request from the bucket for key, refilled under limit up to now
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (*RateLimitResult, error)
+	Close() error
+}
+
+type memoryBucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+// MemoryRateLimitStore keeps buckets in the process, so each instance has its own
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	sweepAt int
+}
+
+// memoryRateLimitSweepSize is how many buckets the memory store holds before it sweeps
+// out the full ones
+const memoryRateLimitSweepSize = 100000
+
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}, sweepAt: memoryRateLimitSweepSize}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (*RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Stop the map growing without bound under a spray of addresses. A full bucket is
+	// the same as none. The next sweep waits until the map has doubled, so a map of
+	// buckets that are all in use is not swept on every request.
+	if len(s.buckets) > s.sweepAt {
+		for k, b := range s.buckets {
+			if !b.full.After(now) {
+				delete(s.buckets, k)
+			}
+		}
+
+		s.sweepAt = int(math.Max(memoryRateLimitSweepSize, float64(2*len(s.buckets))))
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(limit.Requests), updated: now}
+		s.buckets[key] = b
+	}
+
+	tokens, allowed := limit.take(b.tokens, now.Sub(b.updated))
+	result := limit.result(tokens, allowed)
+
+	b.tokens = tokens
+	b.updated = now
+	b.full = now.Add(result.Reset)
+
+	return result, nil
+}
+
+func (s *MemoryRateLimitStore) Close() error {
+	return nil
+}
+
+// The same refill as RateLimit.take, run atomically in Redis. Numbers are returned as
+// strings, as Redis truncates Lua numbers to integers.
+var takeScript = redis.NewScript(`
+local requests = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1]) or requests
+local updated = tonumber(bucket[2]) or now
+
+tokens = math.min(requests, tokens + math.max(0, now - updated) / interval)
+
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((requests - tokens) * interval) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// RedisRateLimitStore keeps buckets in Redis, so they are shared between instances.
+// Instances' clocks are assumed to be in sync.
+type RedisRateLimitStore struct {
+	client *redis.Client
+}
+
+func NewRedisRateLimitStore(client *redis.Client) RateLimitStore {
+	return &RedisRateLimitStore{client}
+}
+
+func (s *RedisRateLimitStore) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (*RateLimitResult, error) {
+	interval := limit.interval() / float64(time.Millisecond)
+
+	reply, err := takeScript.Run(ctx, s.client, []string{key}, limit.Requests, interval, now.UnixMilli()).Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(reply) != 2 {
+		return nil, errors.New("Unexpected reply from the rate limit script")
+	}
+
+	allowed, _ := reply[0].(int64)
+	remaining, _ := reply[1].(string)
+
+	tokens, err := strconv.ParseFloat(remaining, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return limit.result(tokens, allowed == 1), nil
+}
+
+func (s *RedisRateLimitStore) Close() error {
+	return s.client.Close()
+}
+
+// RateLimiter takes requests from separate budgets for reads, writes and token
+// requests
+type RateLimiter struct {
+	config RateLimitConfig
+	store  RateLimitStore
+	now    func() time.Time
+}
+
+func NewRateLimiter(config RateLimitConfig) (*RateLimiter, error) {
+	store := NewMemoryRateLimitStore()
+
+	if config.Store == RateLimitStoreRedis {
+		options, err := redis.ParseURL(config.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+
+		store = NewRedisRateLimitStore(redis.NewClient(options))
+	}
+
+	return &RateLimiter{config, store, time.Now}, nil
+}
+
+func (l *RateLimiter) Enabled() bool {
+	return l.config.Enabled
+}
+
+// Take takes a request by key from the named budget, one of read, write or token
+func (l *RateLimiter) Take(ctx context.Context, budget string, key string) (*RateLimitResult, error) {
+	limit := l.config.Write
+	switch budget {
+	case "read":
+		limit = l.config.Read
+	case "token":
+		limit = l.config.Token
+	}
+
+	return l.store.Take(ctx, "ratelimit:"+budget+":"+key, limit, l.now())
+}
+
+func (l *RateLimiter) Close() error {
+	return l.store.Close()
+}
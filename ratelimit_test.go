@@ -0,0 +1,187 @@
+package main
+
+import (
+	"testing"
+	"context"
+	"encoding/json"
+	"github.com/alicebob/miniredis/v2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+)
+
+// withRateLimit turns rate limits on for the test app with the given budgets and
+// fresh buckets, and returns a function that turns them off again
+func withRateLimit(read RateLimit, write RateLimit, token RateLimit) func() {
+	limiter := app.RateLimiter()
+	config, store := limiter.config, limiter.store
+
+	limiter.config.Enabled = true
+	limiter.config.Read, limiter.config.Write, limiter.config.Token = read, write, token
+	limiter.store = NewMemoryRateLimitStore()
+
+	return func() {
+		limiter.config, limiter.store = config, store
+	}
+}
+
+func testRateLimitStore(t *testing.T, store RateLimitStore) {
+	limit := RateLimit{Requests: 2, Period: time.Second}
+	now := time.Unix(1700000000, 0)
+
+	take := func(key string, at time.Time) *RateLimitResult {
+		result, err := store.Take(context.Background(), key, limit, at)
+		if err != nil {
+			t.Fatalf("Could not take from bucket: '%s'", err.Error())
+		}
+
+		return result
+	}
+
+	if result := take("a", now); !result.Allowed || result.Limit != 2 || result.Remaining != 1 {
+		t.Errorf("Expected the first request to leave 1 of 2, got %+v", result)
+	}
+
+	if result := take("a", now); !result.Allowed || result.Remaining != 0 || result.Reset != time.Second {
+		t.Errorf("Expected the second request to empty the bucket until it refills in 1s, got %+v", result)
+	}
+
+	if result := take("a", now); result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected the third request to wait 500ms, got %+v", result)
+	}
+
+	if result := take("b", now); !result.Allowed {
+		t.Errorf("Expected another key to have its own bucket")
+	}
+
+	if result := take("a", now.Add(500*time.Millisecond)); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("Expected a request to be allowed once refilled, got %+v", result)
+	}
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	testRateLimitStore(t, NewMemoryRateLimitStore())
+}
+
+func TestMemoryRateLimitStore_SweepsFullBuckets(t *testing.T) {
+	store := NewMemoryRateLimitStore().(*MemoryRateLimitStore)
+	store.sweepAt = 2
+	limit := RateLimit{Requests: 2, Period: time.Second}
+	now := time.Unix(1700000000, 0)
+
+	for _, key := range []string{"a", "b", "c"} {
+		store.Take(context.Background(), key, limit, now)
+	}
+
+	store.Take(context.Background(), "d", limit, now.Add(time.Second))
+
+	if len(store.buckets) != 1 {
+		t.Errorf("Expected the full buckets to be swept, got %d buckets", len(store.buckets))
+		return
+	}
+
+	if store.sweepAt != memoryRateLimitSweepSize {
+		t.Errorf("Expected the next sweep at %d buckets, got %d", memoryRateLimitSweepSize, store.sweepAt)
+		return
+	}
+}
+
+func TestRedisRateLimitStore(t *testing.T) {
+	server := miniredis.RunT(t)
+
+	limiter, err := NewRateLimiter(RateLimitConfig{Store: RateLimitStoreRedis, RedisURL: "redis://" + server.Addr() + "/0"})
+	if err != nil {
+		t.Fatalf("Could not create rate limiter: '%s'", err.Error())
+	}
+	defer limiter.Close()
+
+	testRateLimitStore(t, limiter.store)
+
+	if ttl := server.TTL("a"); ttl <= 0 || ttl > 2*time.Second {
+		t.Errorf("Expected the bucket to expire once it would be full, got '%s'", ttl)
+	}
+}
+
+func TestRateLimitMiddleware_LimitsReadsAndWritesByUser(t *testing.T) {
+	defer withRateLimit(RateLimit{2, time.Minute}, RateLimit{1, time.Minute}, RateLimit{1, time.Minute})()
+
+	request := func(method string, path string, remoteAddr string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer access-token")
+		req.RemoteAddr = remoteAddr
+
+		w := httptest.NewRecorder()
+		app.Engine().ServeHTTP(w, req)
+
+		return w
+	}
+
+	for i, remaining := range []string{"1", "0"} {
+		w := request(http.MethodGet, "/v1/notes", "192.0.2.1:1234")
+		if w.Code != http.StatusOK || w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != remaining {
+			t.Errorf("Expected read %d to be allowed with %s remaining, got '%d' %v", i+1, remaining, w.Code, w.Header())
+		}
+	}
+
+	// The limit follows the user, not the address
+	w := request(http.MethodGet, "/v1/tags", "192.0.2.2:1234")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected a third read to be limited, got '%d'", w.Code)
+	}
+
+	if w.Header().Get("Retry-After") != "30" || w.Header().Get("RateLimit-Reset") != "60" {
+		t.Errorf("Expected to retry in 30s and be reset in 60s, got %v", w.Header())
+	}
+
+	data := struct {
+		Errors []*ErrorObject `json:"errors"`
+	}{}
+	json.Unmarshal(w.Body.Bytes(), &data)
+	if len(data.Errors) != 1 || data.Errors[0].Title != TooManyRequests || data.Errors[0].Status != http.StatusTooManyRequests {
+		t.Errorf("Expected an error object, got '%s'", w.Body.String())
+	}
+
+	if w := request(http.MethodDelete, "/v1/notes/999", "192.0.2.1:1234"); w.Code == http.StatusTooManyRequests {
+		t.Errorf("Expected writes to have their own budget")
+	}
+
+	if w := request(http.MethodDelete, "/v1/notes/999", "192.0.2.1:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected a second write to be limited, got '%d'", w.Code)
+	}
+}
+
+func TestRateLimitMiddleware_LimitsTokenRequestsByAddressAndClient(t *testing.T) {
+	defer withRateLimit(RateLimit{1, time.Minute}, RateLimit{1, time.Minute}, RateLimit{1, time.Minute})()
+
+	token := func(clientSecret string, remoteAddr string) int {
+		params := url.Values{
+			"grant_type": {"password"},
+			"username":   {"ratelimit@go-notes.com"},
+			"password":   {"password"},
+		}
+
+		w := requestToken(app, "1", clientSecret, params, func(req *http.Request) {
+			req.RemoteAddr = remoteAddr
+		})
+
+		return w.Code
+	}
+
+	if code := token("wrong", "192.0.2.1:1234"); code == http.StatusTooManyRequests {
+		t.Errorf("Expected the first token request from an address to be allowed")
+	}
+
+	if code := token("wrong", "192.0.2.1:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a second token request from the address to be limited, got '%d'", code)
+	}
+
+	// Requests that fail to authenticate the client are not charged to it
+	if code := token("secret", "192.0.2.2:1234"); code == http.StatusTooManyRequests {
+		t.Errorf("Expected the first authenticated token request for the client to be allowed")
+	}
+
+	if code := token("secret", "192.0.2.3:1234"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a second authenticated token request for the client to be limited, got '%d'", code)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// AuditFilter narrows a search of the audit log. Zero values match everything, and an
+// action ending in * matches every action with that prefix.
+type AuditFilter struct {
+	Action  string
+	ActorId *uint
+	Target  string
+	From    time.Time
+	To      time.Time
+	// Restricts the search to events a user made, or that were made to their account
+	UserId *uint
+}
+
+type AuditEventRepository interface {
+	FindAll(ctx context.Context, filter AuditFilter, limit int, offset int) ([]*AuditEvent, error)
+}
+
+type ORMAuditEventRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditEventRepository(db *gorm.DB) AuditEventRepository {
+	return &ORMAuditEventRepository{db}
+}
+
+func (r *ORMAuditEventRepository) FindAll(ctx context.Context, filter AuditFilter, limit int, offset int) ([]*AuditEvent, error) {
+	_, span := startSpan(ctx, "AuditEventRepository.FindAll")
+	defer span.End()
+
+	var events []*AuditEvent
+
+	query := r.db.Order("id desc")
+
+	if strings.HasSuffix(filter.Action, "*") {
+		query = query.Where("action LIKE ?", strings.TrimSuffix(filter.Action, "*")+"%")
+	} else if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+
+	if filter.ActorId != nil {
+		query = query.Where("actor_id = ?", *filter.ActorId)
+	}
+
+	if filter.Target != "" {
+		query = query.Where("target = ?", filter.Target)
+	}
+
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From.UTC())
+	}
+
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To.UTC())
+	}
+
+	if filter.UserId != nil {
+		query = query.Where("actor_id = ? OR target = ?", *filter.UserId, auditTarget("user", *filter.UserId))
+	}
+
+	if err := query.Limit(limit).Offset(offset).Find(&events).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return events, nil
+}
@@ -1,121 +1,153 @@
 package main
 
 import (
+	"context"
 	"github.com/jinzhu/gorm"
 )
 
+// NoteRepository only sees the notes of one workspace. NewNoteRepository returns one
+// for the personal workspace, InWorkspace one for another. Each call is traced as part
+// of ctx.
 type NoteRepository interface {
-	FindById(id int) (*Note, error)
-	FindAll(limit int, offset int) ([]*Note, error)
-	FindByUserId(user int, limit int, offset int) ([]*Note, error)
-	Create(n *Note) (*Note, error)
-	Update(id int, n *Note) (*Note, error)
-	Delete(n *Note) error
+	InWorkspace(workspace uint) NoteRepository
+	FindById(ctx context.Context, id int) (*Note, error)
+	FindAll(ctx context.Context, p *Pagination) ([]*Note, error)
+	FindByUserId(ctx context.Context, user int, p *Pagination) ([]*Note, error)
+	Create(ctx context.Context, n *Note) (*Note, error)
+	Update(ctx context.Context, id int, n *Note) (*Note, error)
+	Delete(ctx context.Context, n *Note) error
 }
 
 type ORMNoteRepository struct {
-	db *gorm.DB
+	db          *gorm.DB
+	workspaceId uint
 }
 
 func NewNoteRepository(db *gorm.DB) NoteRepository {
-	return &ORMNoteRepository{db}
+	return &ORMNoteRepository{db, 0}
 }
 
-func (r *ORMNoteRepository) FindById(id int) (*Note, error) {
+func (r *ORMNoteRepository) InWorkspace(workspace uint) NoteRepository {
+	return &ORMNoteRepository{r.db, workspace}
+}
+
+func (r *ORMNoteRepository) scoped() *gorm.DB {
+	return r.db.Where("workspace_id = ?", r.workspaceId)
+}
+
+func (r *ORMNoteRepository) FindById(ctx context.Context, id int) (*Note, error) {
+	_, span := startSpan(ctx, "NoteRepository.FindById")
+	defer span.End()
+
 	note := new(Note)
 
-	if err := r.db.Preload("CreatedBy").Preload("Tags").First(note, id).Error; err != nil {
-		return nil, err
+	if err := r.scoped().Preload("CreatedBy").Preload("Tags").First(note, id).Error; err != nil {
+		return nil, spanError(span, err)
 	}
 
 	return note, nil
 }
 
-func (r *ORMNoteRepository) FindAll(limit int, offset int) ([]*Note, error) {
+func (r *ORMNoteRepository) FindAll(ctx context.Context, p *Pagination) ([]*Note, error) {
+	_, span := startSpan(ctx, "NoteRepository.FindAll")
+	defer span.End()
+
 	var notes []*Note
 
-	err := r.db.Preload("CreatedBy").
-		Preload("Tags").
-		Limit(limit).
-		Offset(offset).
-		Find(&notes).Error
+	err := paginate(r.scoped().Preload("CreatedBy").Preload("Tags"), p, &notes)
 
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
 	return notes, nil
 }
 
-func (r *ORMNoteRepository) FindByUserId(user int, limit int, offset int) ([]*Note, error) {
+func (r *ORMNoteRepository) FindByUserId(ctx context.Context, user int, p *Pagination) ([]*Note, error) {
+	_, span := startSpan(ctx, "NoteRepository.FindByUserId")
+	defer span.End()
+
 	var notes []*Note
 
-	err := r.db.Where("created_by = ?", user).
-		Preload("CreatedBy").
-		Preload("Tags").
-		Limit(limit).
-		Offset(offset).
-		Find(&notes).Error
+	err := paginate(r.scoped().Where("created_by = ?", user).Preload("CreatedBy").Preload("Tags"), p, &notes)
 
 	if err != nil {
-		return nil, err
+		return nil, spanError(span, err)
 	}
 
 	return notes, nil
 }
 
-func (r *ORMNoteRepository) Create(n *Note) (*Note, error) {
+func (r *ORMNoteRepository) Create(ctx context.Context, n *Note) (*Note, error) {
+	ctx, span := startSpan(ctx, "NoteRepository.Create")
+	defer span.End()
+
 	note := &Note{
 		Title:       n.Title,
 		Text:        n.Text,
 		CreatedById: n.CreatedById,
+		WorkspaceId: r.workspaceId,
 	}
 
 	if err := r.db.Create(note).Error; err != nil {
-		return n, err
+		return n, spanError(span, err)
 	}
 
 	note.Tags = append(note.Tags, n.Tags...)
-	r.SaveTags(note)
+	r.SaveTags(ctx, note)
 
 	return note, nil
 }
 
-func (r *ORMNoteRepository) Update(id int, n *Note) (*Note, error) {
-	note, _ := r.FindById(id)
+func (r *ORMNoteRepository) Update(ctx context.Context, id int, n *Note) (*Note, error) {
+	ctx, span := startSpan(ctx, "NoteRepository.Update")
+	defer span.End()
+
+	note, err := r.FindById(ctx, id)
+	if err != nil {
+		return n, spanError(span, err)
+	}
 
 	if err := r.db.Model(note).UpdateColumns(&Note{Title: n.Title, Text: n.Text}).Error; err != nil {
-		return n, err
+		return n, spanError(span, err)
 	}
 
 	note.Tags = nil
 	note.Tags = append(note.Tags, n.Tags...)
-	r.SaveTags(note)
+	r.SaveTags(ctx, note)
 
 	return note, nil
 }
 
-func (r *ORMNoteRepository) SaveTags(n *Note) {
+func (r *ORMNoteRepository) SaveTags(ctx context.Context, n *Note) {
+	_, span := startSpan(ctx, "NoteRepository.SaveTags")
+	defer span.End()
+
 	var tags []*Tag
 
 	for _, tag := range n.Tags {
 		t := new(Tag)
 
-		if err := r.db.Where("name = ?", tag.Name).Find(t).Error; err == nil {
+		if err := scopeTags(r.db, r.workspaceId, n.CreatedById).Where("name = ?", tag.Name).Find(t).Error; err == nil {
 			tags = append(tags, t)
 			continue
 		}
 
 		t.Name = tag.Name
+		t.WorkspaceId = r.workspaceId
+		t.CreatedById = n.CreatedById
 		tags = append(tags, t)
 	}
 
-	r.db.Model(n).Association("Tags").Replace(&tags)
+	spanError(span, r.db.Model(n).Association("Tags").Replace(&tags).Error)
 }
 
-func (r *ORMNoteRepository) Delete(n *Note) error {
-	if err := r.db.Delete(n).Error; err != nil {
-		return err
+func (r *ORMNoteRepository) Delete(ctx context.Context, n *Note) error {
+	_, span := startSpan(ctx, "NoteRepository.Delete")
+	defer span.End()
+
+	if err := r.scoped().Delete(n).Error; err != nil {
+		return spanError(span, err)
 	}
 
 	return nil
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type OAuth2ClientRepository interface {
+	FindById(ctx context.Context, id int) (*OAuth2Client, error)
+	FindAll(ctx context.Context) ([]*OAuth2Client, error)
+	Create(ctx context.Context, c *OAuth2Client) (*OAuth2Client, string, error)
+	Update(ctx context.Context, id int, c *OAuth2Client) (*OAuth2Client, error)
+	RotateSecret(ctx context.Context, c *OAuth2Client) (string, error)
+	Delete(ctx context.Context, c *OAuth2Client) error
+}
+
+type ORMOAuth2ClientRepository struct {
+	db *gorm.DB
+}
+
+func NewOAuth2ClientRepository(db *gorm.DB) OAuth2ClientRepository {
+	return &ORMOAuth2ClientRepository{db}
+}
+
+func (r *ORMOAuth2ClientRepository) FindById(ctx context.Context, id int) (*OAuth2Client, error) {
+	_, span := startSpan(ctx, "OAuth2ClientRepository.FindById")
+	defer span.End()
+
+	client := new(OAuth2Client)
+
+	if err := r.db.First(client, id).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return client, nil
+}
+
+func (r *ORMOAuth2ClientRepository) FindAll(ctx context.Context) ([]*OAuth2Client, error) {
+	_, span := startSpan(ctx, "OAuth2ClientRepository.FindAll")
+	defer span.End()
+
+	var clients []*OAuth2Client
+
+	if err := r.db.Order("id").Find(&clients).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return clients, nil
+}
+
+// Create stores a new client and returns it along with its secret. Only a bcrypt hash
+// of the secret is stored, so it cannot be retrieved again.
+func (r *ORMOAuth2ClientRepository) Create(ctx context.Context, c *OAuth2Client) (*OAuth2Client, string, error) {
+	_, span := startSpan(ctx, "OAuth2ClientRepository.Create")
+	defer span.End()
+
+	secret, hash, err := newClientSecret()
+	if err != nil {
+		return c, "", spanError(span, err)
+	}
+
+	client := &OAuth2Client{
+		Name:                   c.Name,
+		Secret:                 hash,
+		Extra:                  c.Extra,
+		RedirectURI:            c.RedirectURI,
+		AllowedGrants:          c.AllowedGrants,
+		AllowedScopes:          c.AllowedScopes,
+		TLSClientAuthSubjectDN: c.TLSClientAuthSubjectDN,
+	}
+
+	if err := r.db.Create(client).Error; err != nil {
+		return c, "", spanError(span, err)
+	}
+
+	return client, secret, nil
+}
+
+func (r *ORMOAuth2ClientRepository) Update(ctx context.Context, id int, c *OAuth2Client) (*OAuth2Client, error) {
+	ctx, span := startSpan(ctx, "OAuth2ClientRepository.Update")
+	defer span.End()
+
+	client, err := r.FindById(ctx, id)
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	err = r.db.Model(client).Updates(map[string]interface{}{
+		"name":                       c.Name,
+		"extra":                      c.Extra,
+		"redirect_uri":               c.RedirectURI,
+		"allowed_grants":             c.AllowedGrants,
+		"allowed_scopes":             c.AllowedScopes,
+		"tls_client_auth_subject_dn": c.TLSClientAuthSubjectDN,
+	}).Error
+
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return client, nil
+}
+
+func (r *ORMOAuth2ClientRepository) RotateSecret(ctx context.Context, c *OAuth2Client) (string, error) {
+	_, span := startSpan(ctx, "OAuth2ClientRepository.RotateSecret")
+	defer span.End()
+
+	secret, hash, err := newClientSecret()
+	if err != nil {
+		return "", spanError(span, err)
+	}
+
+	if err := r.db.Model(c).UpdateColumn("secret", hash).Error; err != nil {
+		return "", spanError(span, err)
+	}
+
+	return secret, nil
+}
+
+func (r *ORMOAuth2ClientRepository) Delete(ctx context.Context, c *OAuth2Client) error {
+	_, span := startSpan(ctx, "OAuth2ClientRepository.Delete")
+	defer span.End()
+
+	if err := r.db.Delete(c).Error; err != nil {
+		return spanError(span, err)
+	}
+
+	return nil
+}
+
+func newClientSecret() (string, string, error) {
+	secret, err := randomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+
+	return secret, string(hash), nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type PersonalAccessTokenRepository interface {
+	FindById(ctx context.Context, id int) (*PersonalAccessToken, error)
+	FindByToken(ctx context.Context, token string) (*PersonalAccessToken, error)
+	FindByUserId(ctx context.Context, user int) ([]*PersonalAccessToken, error)
+	Create(ctx context.Context, t *PersonalAccessToken) (*PersonalAccessToken, string, error)
+	Touch(ctx context.Context, t *PersonalAccessToken, ip string) error
+	Delete(ctx context.Context, t *PersonalAccessToken) error
+}
+
+type ORMPersonalAccessTokenRepository struct {
+	db *gorm.DB
+}
+
+func NewPersonalAccessTokenRepository(db *gorm.DB) PersonalAccessTokenRepository {
+	return &ORMPersonalAccessTokenRepository{db}
+}
+
+func (r *ORMPersonalAccessTokenRepository) FindById(ctx context.Context, id int) (*PersonalAccessToken, error) {
+	_, span := startSpan(ctx, "PersonalAccessTokenRepository.FindById")
+	defer span.End()
+
+	token := new(PersonalAccessToken)
+
+	if err := r.db.First(token, id).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return token, nil
+}
+
+func (r *ORMPersonalAccessTokenRepository) FindByToken(ctx context.Context, token string) (*PersonalAccessToken, error) {
+	_, span := startSpan(ctx, "PersonalAccessTokenRepository.FindByToken")
+	defer span.End()
+
+	t := new(PersonalAccessToken)
+
+	if err := r.db.Where("token_hash = ?", hashToken(token)).Preload("User").Find(t).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return t, nil
+}
+
+func (r *ORMPersonalAccessTokenRepository) FindByUserId(ctx context.Context, user int) ([]*PersonalAccessToken, error) {
+	_, span := startSpan(ctx, "PersonalAccessTokenRepository.FindByUserId")
+	defer span.End()
+
+	var tokens []*PersonalAccessToken
+
+	if err := r.db.Where("user_id = ?", user).Order("id").Find(&tokens).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return tokens, nil
+}
+
+// Create stores a new token and returns it along with its secret value. Only a hash of
+// the secret is stored, so it cannot be retrieved again.
+func (r *ORMPersonalAccessTokenRepository) Create(ctx context.Context, t *PersonalAccessToken) (*PersonalAccessToken, string, error) {
+	_, span := startSpan(ctx, "PersonalAccessTokenRepository.Create")
+	defer span.End()
+
+	secret, err := randomString(32)
+	if err != nil {
+		return t, "", spanError(span, err)
+	}
+
+	secret = personalAccessTokenPrefix + secret
+
+	token := &PersonalAccessToken{
+		Name:      t.Name,
+		TokenHash: hashToken(secret),
+		Scope:     t.Scope,
+		ExpiresAt: t.ExpiresAt,
+		UserId:    t.UserId,
+	}
+
+	if err := r.db.Create(token).Error; err != nil {
+		return t, "", spanError(span, err)
+	}
+
+	return token, secret, nil
+}
+
+func (r *ORMPersonalAccessTokenRepository) Touch(ctx context.Context, t *PersonalAccessToken, ip string) error {
+	_, span := startSpan(ctx, "PersonalAccessTokenRepository.Touch")
+	defer span.End()
+
+	now := time.Now()
+
+	return spanError(span, r.db.Model(t).UpdateColumns(&PersonalAccessToken{LastUsedAt: &now, LastUsedIP: ip}).Error)
+}
+
+func (r *ORMPersonalAccessTokenRepository) Delete(ctx context.Context, t *PersonalAccessToken) error {
+	_, span := startSpan(ctx, "PersonalAccessTokenRepository.Delete")
+	defer span.End()
+
+	if err := r.db.Delete(t).Error; err != nil {
+		return spanError(span, err)
+	}
+
+	return nil
+}
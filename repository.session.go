@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+// SessionRepository finds the refresh tokens that back a user's sessions. Only the
+// latest, unused refresh token of each family is a session.
+type SessionRepository interface {
+	FindById(ctx context.Context, id int) (*OAuth2RefreshToken, error)
+	FindByUserId(ctx context.Context, user int) ([]*OAuth2RefreshToken, error)
+}
+
+type ORMSessionRepository struct {
+	db *gorm.DB
+}
+
+func NewSessionRepository(db *gorm.DB) SessionRepository {
+	return &ORMSessionRepository{db}
+}
+
+func (r *ORMSessionRepository) active() *gorm.DB {
+	return r.db.Where("used_at IS NULL AND expires > ?", time.Now()).
+		Preload("AccessToken").
+		Preload("Client")
+}
+
+func (r *ORMSessionRepository) FindById(ctx context.Context, id int) (*OAuth2RefreshToken, error) {
+	_, span := startSpan(ctx, "SessionRepository.FindById")
+	defer span.End()
+
+	t := new(OAuth2RefreshToken)
+
+	if err := r.active().First(t, id).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return t, nil
+}
+
+func (r *ORMSessionRepository) FindByUserId(ctx context.Context, user int) ([]*OAuth2RefreshToken, error) {
+	_, span := startSpan(ctx, "SessionRepository.FindByUserId")
+	defer span.End()
+
+	var tokens []*OAuth2RefreshToken
+
+	if err := r.active().Where("user_id = ?", user).Order("id").Find(&tokens).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return tokens, nil
+}
@@ -1,77 +1,123 @@
 package main
 
-import "github.com/jinzhu/gorm"
+import (
+	"context"
+	"github.com/jinzhu/gorm"
+)
 
+// TagRepository only sees the tags of one workspace, like NoteRepository. Tags in
+// the personal workspace (0) are only seen by their owner.
 type TagRepository interface {
-	FindById(id int) (*Tag, error)
-	FindByName(name string) (*Tag, error)
-	FindAll(limit int, offset int) ([]*Tag, error)
-	Create(t *Tag) (*Tag, error)
-	Update(id int, t *Tag) (*Tag, error)
-	Delete(t *Tag) error
+	InWorkspace(workspace uint, owner uint) TagRepository
+	FindById(ctx context.Context, id int) (*Tag, error)
+	FindByName(ctx context.Context, name string) (*Tag, error)
+	FindAll(ctx context.Context, p *Pagination) ([]*Tag, error)
+	Create(ctx context.Context, t *Tag) (*Tag, error)
+	Update(ctx context.Context, id int, t *Tag) (*Tag, error)
+	Delete(ctx context.Context, t *Tag) error
 }
 
 type ORMTagRepository struct {
-	db *gorm.DB
+	db          *gorm.DB
+	workspaceId uint
+	ownerId     uint
 }
 
 func NewTagRepository(db *gorm.DB) TagRepository {
-	return &ORMTagRepository{db}
+	return &ORMTagRepository{db, 0, 0}
 }
 
-func (r *ORMTagRepository) FindById(id int) (*Tag, error) {
+func (r *ORMTagRepository) InWorkspace(workspace uint, owner uint) TagRepository {
+	return &ORMTagRepository{r.db, workspace, owner}
+}
+
+func (r *ORMTagRepository) scoped() *gorm.DB {
+	return scopeTags(r.db, r.workspaceId, r.ownerId)
+}
+
+func scopeTags(db *gorm.DB, workspace uint, owner uint) *gorm.DB {
+	db = db.Where("workspace_id = ?", workspace)
+	if workspace == 0 {
+		db = db.Where("created_by = ?", owner)
+	}
+
+	return db
+}
+
+func (r *ORMTagRepository) FindById(ctx context.Context, id int) (*Tag, error) {
+	_, span := startSpan(ctx, "TagRepository.FindById")
+	defer span.End()
+
 	tag := new(Tag)
 
-	if err := r.db.First(tag, id).Error; err != nil {
-		return nil, err
+	if err := r.scoped().First(tag, id).Error; err != nil {
+		return nil, spanError(span, err)
 	}
 
 	return tag, nil
 }
 
-func (r *ORMTagRepository) FindByName(name string) (*Tag, error) {
+func (r *ORMTagRepository) FindByName(ctx context.Context, name string) (*Tag, error) {
+	_, span := startSpan(ctx, "TagRepository.FindByName")
+	defer span.End()
+
 	tag := new(Tag)
 
-	if err := r.db.Where("name = ?", name).Find(tag).Error; err != nil {
-		return nil, err
+	if err := r.scoped().Where("name = ?", name).Find(tag).Error; err != nil {
+		return nil, spanError(span, err)
 	}
 
 	return tag, nil
 }
 
-func (r *ORMTagRepository) FindAll(limit int, offset int) ([]*Tag, error) {
+func (r *ORMTagRepository) FindAll(ctx context.Context, p *Pagination) ([]*Tag, error) {
+	_, span := startSpan(ctx, "TagRepository.FindAll")
+	defer span.End()
+
 	var tags []*Tag
 
-	if err := r.db.Limit(limit).Offset(offset).Find(&tags).Error; err != nil {
-		return nil, err
+	if err := paginate(r.scoped(), p, &tags); err != nil {
+		return nil, spanError(span, err)
 	}
 
 	return tags, nil
 }
 
-func (r *ORMTagRepository) Create(t *Tag) (*Tag, error) {
-	tag := &Tag{Name: t.Name}
+func (r *ORMTagRepository) Create(ctx context.Context, t *Tag) (*Tag, error) {
+	_, span := startSpan(ctx, "TagRepository.Create")
+	defer span.End()
+
+	tag := &Tag{Name: t.Name, WorkspaceId: r.workspaceId, CreatedById: r.ownerId}
 
 	if err := r.db.Create(tag).Error; err != nil {
-		return t, err
+		return t, spanError(span, err)
 	}
 
 	return tag, nil
 }
 
-func (r *ORMTagRepository) Update(id int, t *Tag) (*Tag, error) {
-	tag, _ := r.FindById(id)
+func (r *ORMTagRepository) Update(ctx context.Context, id int, t *Tag) (*Tag, error) {
+	ctx, span := startSpan(ctx, "TagRepository.Update")
+	defer span.End()
+
+	tag, err := r.FindById(ctx, id)
+	if err != nil {
+		return t, spanError(span, err)
+	}
 
 	if err := r.db.Model(tag).UpdateColumns(&Tag{Name: t.Name}).Error; err != nil {
-		return t, err
+		return t, spanError(span, err)
 	}
 
 	return tag, nil
 }
 
-func (r *ORMTagRepository) Delete(t *Tag) error {
-	if err := r.db.Delete(t).Error; err != nil {
-		return err
+func (r *ORMTagRepository) Delete(ctx context.Context, t *Tag) error {
+	_, span := startSpan(ctx, "TagRepository.Delete")
+	defer span.End()
+
+	if err := r.scoped().Delete(t).Error; err != nil {
+		return spanError(span, err)
 	}
 
 	return nil
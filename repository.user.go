@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+var ErrLastWorkspaceOwner = errors.New("The user is the last owner of a workspace, which must be given another owner or deleted first")
+
+type UserRepository interface {
+	FindById(ctx context.Context, id int) (*User, error)
+	FindByEmail(ctx context.Context, email string) (*User, error)
+	FindAll(ctx context.Context, p *Pagination) ([]*User, error)
+	SetRole(ctx context.Context, u *User, role string) error
+	Disable(ctx context.Context, u *User) error
+	Enable(ctx context.Context, u *User) error
+	ForcePasswordReset(ctx context.Context, u *User) error
+	IsLastWorkspaceOwner(ctx context.Context, u *User) (bool, error)
+	Delete(ctx context.Context, u *User) error
+}
+
+type ORMUserRepository struct {
+	db *gorm.DB
+}
+
+func NewUserRepository(db *gorm.DB) UserRepository {
+	return &ORMUserRepository{db}
+}
+
+func (r *ORMUserRepository) FindById(ctx context.Context, id int) (*User, error) {
+	_, span := startSpan(ctx, "UserRepository.FindById")
+	defer span.End()
+
+	user := new(User)
+
+	if err := r.db.First(user, id).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return user, nil
+}
+
+func (r *ORMUserRepository) FindByEmail(ctx context.Context, email string) (*User, error) {
+	_, span := startSpan(ctx, "UserRepository.FindByEmail")
+	defer span.End()
+
+	user := new(User)
+
+	if err := r.db.Where("email = ?", email).First(user).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return user, nil
+}
+
+func (r *ORMUserRepository) FindAll(ctx context.Context, p *Pagination) ([]*User, error) {
+	_, span := startSpan(ctx, "UserRepository.FindAll")
+	defer span.End()
+
+	var users []*User
+
+	if err := paginate(r.db, p, &users); err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return users, nil
+}
+
+func (r *ORMUserRepository) SetRole(ctx context.Context, u *User, role string) error {
+	_, span := startSpan(ctx, "UserRepository.SetRole")
+	defer span.End()
+
+	return spanError(span, r.db.Model(u).UpdateColumn("role", role).Error)
+}
+
+func (r *ORMUserRepository) Disable(ctx context.Context, u *User) error {
+	_, span := startSpan(ctx, "UserRepository.Disable")
+	defer span.End()
+
+	now := time.Now()
+
+	return spanError(span, r.db.Model(u).UpdateColumn("disabled_at", &now).Error)
+}
+
+func (r *ORMUserRepository) Enable(ctx context.Context, u *User) error {
+	_, span := startSpan(ctx, "UserRepository.Enable")
+	defer span.End()
+
+	return spanError(span, r.db.Model(u).UpdateColumn("disabled_at", gorm.Expr("NULL")).Error)
+}
+
+func (r *ORMUserRepository) ForcePasswordReset(ctx context.Context, u *User) error {
+	_, span := startSpan(ctx, "UserRepository.ForcePasswordReset")
+	defer span.End()
+
+	return spanError(span, r.db.Model(u).UpdateColumn("force_password_reset", true).Error)
+}
+
+// IsLastWorkspaceOwner reports whether a workspace would be left without an owner if
+// the user were deleted
+func (r *ORMUserRepository) IsLastWorkspaceOwner(ctx context.Context, u *User) (bool, error) {
+	_, span := startSpan(ctx, "UserRepository.IsLastWorkspaceOwner")
+	defer span.End()
+
+	last, err := isLastWorkspaceOwner(r.db, u)
+
+	return last, spanError(span, err)
+}
+
+func isLastWorkspaceOwner(db *gorm.DB, u *User) (bool, error) {
+	var owned []uint
+	err := db.Model(&WorkspaceMember{}).Where("user_id = ? AND role = ?", u.ID, WorkspaceRoleOwner).Pluck("workspace_id", &owned).Error
+	if err != nil || len(owned) == 0 {
+		return false, err
+	}
+
+	var shared []uint
+	err = db.Model(&WorkspaceMember{}).
+		Where("workspace_id IN (?) AND role = ? AND user_id <> ?", owned, WorkspaceRoleOwner, u.ID).
+		Pluck("DISTINCT workspace_id", &shared).Error
+
+	return len(shared) < len(owned), err
+}
+
+// Delete removes the user along with their personal notes and everything else they
+// own. Notes they wrote in shared workspaces stay with the workspace. The user cannot
+// be deleted while they are the last owner of a workspace. Tokens are left to
+// GORMStorage.RevokeUser, which also denylists self-contained tokens.
+func (r *ORMUserRepository) Delete(ctx context.Context, u *User) error {
+	_, span := startSpan(ctx, "UserRepository.Delete")
+	defer span.End()
+
+	tx := r.db.Begin()
+
+	last, err := isLastWorkspaceOwner(tx, u)
+	if err != nil {
+		tx.Rollback()
+		return spanError(span, err)
+	}
+
+	if last {
+		tx.Rollback()
+		return ErrLastWorkspaceOwner
+	}
+
+	notes := tx.Model(&Note{}).Select("id").Where("created_by = ? AND workspace_id = 0", u.ID).QueryExpr()
+
+	if err := deleteNoteTags(tx, "note_id", notes); err != nil {
+		tx.Rollback()
+		return spanError(span, err)
+	}
+
+	if err := tx.Where("created_by = ? AND workspace_id = 0", u.ID).Delete(&Note{}).Error; err != nil {
+		tx.Rollback()
+		return spanError(span, err)
+	}
+
+	for _, model := range []interface{}{&PersonalAccessToken{}, &UserRecoveryCode{}, &MFAChallenge{}, &WorkspaceMember{}} {
+		if err := tx.Where("user_id = ?", u.ID).Delete(model).Error; err != nil {
+			tx.Rollback()
+			return spanError(span, err)
+		}
+	}
+
+	if err := tx.Delete(u).Error; err != nil {
+		tx.Rollback()
+		return spanError(span, err)
+	}
+
+	return spanError(span, tx.Commit().Error)
+}
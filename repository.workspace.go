@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+const workspaceInvitationLifetime = 7 * 24 * time.Hour
+
+var ErrInvitationInvalid = errors.New("Invitation is invalid or has expired")
+
+type WorkspaceRepository interface {
+	FindById(ctx context.Context, id int) (*Workspace, error)
+	FindByUserId(ctx context.Context, user int) ([]*Workspace, error)
+	Create(ctx context.Context, w *Workspace) (*Workspace, error)
+	Update(ctx context.Context, id int, w *Workspace) (*Workspace, error)
+	Delete(ctx context.Context, w *Workspace) error
+	FindMember(ctx context.Context, workspace uint, user uint) (*WorkspaceMember, error)
+	FindMembers(ctx context.Context, workspace uint) ([]*WorkspaceMember, error)
+	SetMemberRole(ctx context.Context, m *WorkspaceMember, role string) error
+	RemoveMember(ctx context.Context, m *WorkspaceMember) error
+	CreateInvitation(ctx context.Context, i *WorkspaceInvitation) (*WorkspaceInvitation, string, error)
+	AcceptInvitation(ctx context.Context, token string, user *User) (*WorkspaceMember, error)
+}
+
+type ORMWorkspaceRepository struct {
+	db *gorm.DB
+}
+
+func NewWorkspaceRepository(db *gorm.DB) WorkspaceRepository {
+	return &ORMWorkspaceRepository{db}
+}
+
+func (r *ORMWorkspaceRepository) FindById(ctx context.Context, id int) (*Workspace, error) {
+	_, span := startSpan(ctx, "WorkspaceRepository.FindById")
+	defer span.End()
+
+	workspace := new(Workspace)
+
+	if err := r.db.First(workspace, id).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return workspace, nil
+}
+
+func (r *ORMWorkspaceRepository) FindByUserId(ctx context.Context, user int) ([]*Workspace, error) {
+	_, span := startSpan(ctx, "WorkspaceRepository.FindByUserId")
+	defer span.End()
+
+	var workspaces []*Workspace
+
+	members := r.db.Model(&WorkspaceMember{}).Select("workspace_id").Where("user_id = ?", user).QueryExpr()
+
+	if err := r.db.Where("id IN (?)", members).Order("id").Find(&workspaces).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return workspaces, nil
+}
+
+// Create stores a new workspace with its creator as the owner
+func (r *ORMWorkspaceRepository) Create(ctx context.Context, w *Workspace) (*Workspace, error) {
+	_, span := startSpan(ctx, "WorkspaceRepository.Create")
+	defer span.End()
+
+	workspace := &Workspace{Name: w.Name, CreatedById: w.CreatedById}
+
+	tx := r.db.Begin()
+
+	if err := tx.Create(workspace).Error; err != nil {
+		tx.Rollback()
+		return w, spanError(span, err)
+	}
+
+	owner := &WorkspaceMember{WorkspaceId: workspace.ID, UserId: w.CreatedById, Role: WorkspaceRoleOwner}
+	if err := tx.Create(owner).Error; err != nil {
+		tx.Rollback()
+		return w, spanError(span, err)
+	}
+
+	return workspace, spanError(span, tx.Commit().Error)
+}
+
+func (r *ORMWorkspaceRepository) Update(ctx context.Context, id int, w *Workspace) (*Workspace, error) {
+	ctx, span := startSpan(ctx, "WorkspaceRepository.Update")
+	defer span.End()
+
+	workspace, err := r.FindById(ctx, id)
+	if err != nil {
+		return w, spanError(span, err)
+	}
+
+	if err := r.db.Model(workspace).UpdateColumns(&Workspace{Name: w.Name}).Error; err != nil {
+		return w, spanError(span, err)
+	}
+
+	return workspace, nil
+}
+
+// Delete removes the workspace along with its notes, tags, members and invitations
+func (r *ORMWorkspaceRepository) Delete(ctx context.Context, w *Workspace) error {
+	_, span := startSpan(ctx, "WorkspaceRepository.Delete")
+	defer span.End()
+
+	tx := r.db.Begin()
+
+	notes := tx.Model(&Note{}).Select("id").Where("workspace_id = ?", w.ID).QueryExpr()
+
+	if err := deleteNoteTags(tx, "note_id", notes); err != nil {
+		tx.Rollback()
+		return spanError(span, err)
+	}
+
+	for _, model := range []interface{}{&Note{}, &Tag{}, &WorkspaceMember{}, &WorkspaceInvitation{}} {
+		if err := tx.Where("workspace_id = ?", w.ID).Delete(model).Error; err != nil {
+			tx.Rollback()
+			return spanError(span, err)
+		}
+	}
+
+	if err := tx.Delete(w).Error; err != nil {
+		tx.Rollback()
+		return spanError(span, err)
+	}
+
+	return spanError(span, tx.Commit().Error)
+}
+
+func (r *ORMWorkspaceRepository) FindMember(ctx context.Context, workspace uint, user uint) (*WorkspaceMember, error) {
+	_, span := startSpan(ctx, "WorkspaceRepository.FindMember")
+	defer span.End()
+
+	member := new(WorkspaceMember)
+
+	err := r.db.Where("workspace_id = ? AND user_id = ?", workspace, user).
+		Preload("User").
+		Find(member).Error
+
+	if err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return member, nil
+}
+
+func (r *ORMWorkspaceRepository) FindMembers(ctx context.Context, workspace uint) ([]*WorkspaceMember, error) {
+	_, span := startSpan(ctx, "WorkspaceRepository.FindMembers")
+	defer span.End()
+
+	var members []*WorkspaceMember
+
+	if err := r.db.Where("workspace_id = ?", workspace).Preload("User").Order("id").Find(&members).Error; err != nil {
+		return nil, spanError(span, err)
+	}
+
+	return members, nil
+}
+
+func (r *ORMWorkspaceRepository) SetMemberRole(ctx context.Context, m *WorkspaceMember, role string) error {
+	_, span := startSpan(ctx, "WorkspaceRepository.SetMemberRole")
+	defer span.End()
+
+	return spanError(span, r.db.Model(m).UpdateColumn("role", role).Error)
+}
+
+func (r *ORMWorkspaceRepository) RemoveMember(ctx context.Context, m *WorkspaceMember) error {
+	_, span := startSpan(ctx, "WorkspaceRepository.RemoveMember")
+	defer span.End()
+
+	return spanError(span, r.db.Delete(m).Error)
+}
+
+// CreateInvitation stores an invitation and returns it along with its token. Only a
+// hash of the token is stored.
+func (r *ORMWorkspaceRepository) CreateInvitation(ctx context.Context, i *WorkspaceInvitation) (*WorkspaceInvitation, string, error) {
+	_, span := startSpan(ctx, "WorkspaceRepository.CreateInvitation")
+	defer span.End()
+
+	token, err := randomString(32)
+	if err != nil {
+		return i, "", spanError(span, err)
+	}
+
+	invitation := &WorkspaceInvitation{
+		WorkspaceId: i.WorkspaceId,
+		Email:       strings.ToLower(i.Email),
+		Role:        i.Role,
+		TokenHash:   hashToken(token),
+		InvitedById: i.InvitedById,
+		Expires:     time.Now().Add(workspaceInvitationLifetime),
+	}
+
+	if err := r.db.Create(invitation).Error; err != nil {
+		return i, "", spanError(span, err)
+	}
+
+	return invitation, token, nil
+}
+
+// AcceptInvitation adds the user to the workspace they were invited to. The invitation
+// must have been sent to the user's email address.
+func (r *ORMWorkspaceRepository) AcceptInvitation(ctx context.Context, token string, user *User) (*WorkspaceMember, error) {
+	_, span := startSpan(ctx, "WorkspaceRepository.AcceptInvitation")
+	defer span.End()
+
+	invitation := new(WorkspaceInvitation)
+
+	err := r.db.Where("token_hash = ? AND accepted_at IS NULL AND expires > ?", hashToken(token), time.Now()).
+		Find(invitation).Error
+
+	if err != nil || invitation.Email != strings.ToLower(user.Email) {
+		return nil, ErrInvitationInvalid
+	}
+
+	tx := r.db.Begin()
+
+	// Mark the invitation accepted first, so it cannot be used by two requests
+	res := tx.Model(invitation).Where("accepted_at IS NULL").UpdateColumn("accepted_at", time.Now())
+	if res.Error != nil {
+		tx.Rollback()
+		return nil, spanError(span, res.Error)
+	}
+
+	if res.RowsAffected != 1 {
+		tx.Rollback()
+		return nil, ErrInvitationInvalid
+	}
+
+	member := &WorkspaceMember{WorkspaceId: invitation.WorkspaceId, UserId: user.ID}
+	if err := tx.Where(member).FirstOrInit(member).Error; err != nil {
+		tx.Rollback()
+		return nil, spanError(span, err)
+	}
+
+	// Existing members keep their role
+	if member.ID == 0 {
+		member.Role = invitation.Role
+
+		if err := tx.Create(member).Error; err != nil {
+			tx.Rollback()
+			return nil, spanError(span, err)
+		}
+	}
+
+	return member, spanError(span, tx.Commit().Error)
+}
@@ -4,10 +4,15 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/RangelReale/osin"
 	"errors"
+	"log/slog"
 )
 
 type RequestHandler interface {
+	GetToken(c *gin.Context) (*osin.AccessData, error)
 	GetUser(c *gin.Context) (*User, error)
+	GetWorkspaceId(c *gin.Context) uint
+	GetRequestId(c *gin.Context) string
+	GetLogger(c *gin.Context) *slog.Logger
 }
 
 type APIRequestHandler struct{}
@@ -16,7 +21,7 @@ func NewRequestHandler() RequestHandler {
 	return &APIRequestHandler{}
 }
 
-func (h *APIRequestHandler) GetUser(c *gin.Context) (*User, error) {
+func (h *APIRequestHandler) GetToken(c *gin.Context) (*osin.AccessData, error) {
 	var isToken bool
 	var token *osin.AccessData
 
@@ -29,6 +34,15 @@ func (h *APIRequestHandler) GetUser(c *gin.Context) (*User, error) {
 		return nil, errors.New("Could not assert token is *osin.AccessData")
 	}
 
+	return token, nil
+}
+
+func (h *APIRequestHandler) GetUser(c *gin.Context) (*User, error) {
+	token, err := h.GetToken(c)
+	if err != nil {
+		return nil, err
+	}
+
 	var isUser bool
 	var user *User
 	if user, isUser = token.UserData.(*User); !isUser {
@@ -37,3 +51,28 @@ func (h *APIRequestHandler) GetUser(c *gin.Context) (*User, error) {
 
 	return user, nil
 }
+
+// GetWorkspaceId returns the workspace selected by NewWorkspaceMiddleware, or 0 for
+// the user's personal workspace
+func (h *APIRequestHandler) GetWorkspaceId(c *gin.Context) uint {
+	if m, ok := c.Get("workspace_member"); ok {
+		return m.(*WorkspaceMember).WorkspaceId
+	}
+
+	return 0
+}
+
+// GetRequestId returns the ID given to the request by NewLoggerMiddleware
+func (h *APIRequestHandler) GetRequestId(c *gin.Context) string {
+	return c.GetString("request_id")
+}
+
+// GetLogger returns a logger that adds the request ID to every line, or the default
+// logger outside of a request
+func (h *APIRequestHandler) GetLogger(c *gin.Context) *slog.Logger {
+	if logger, ok := c.Get("logger"); ok {
+		return logger.(*slog.Logger)
+	}
+
+	return slog.Default()
+}
@@ -1,16 +1,72 @@
 package main
 
 const (
-	InternalServerError = "Internal Server Error"
-	MalformedJson       = "Malformed JSON"
-	NotFound            = "Not Found"
-	ValidationError     = "Validation Error"
-	AuthenticationError = "Authentication Error"
-	Unauthorised        = "Unauthorised"
+	InternalServerError   = "Internal Server Error"
+	MalformedJson         = "Malformed JSON"
+	MalformedRequest      = "Malformed Request"
+	NotFound              = "Not Found"
+	ValidationError       = "Validation Error"
+	Conflict              = "Conflict"
+	AuthenticationError   = "Authentication Error"
+	Unauthorised          = "Unauthorised"
+	Forbidden             = "Forbidden"
+	MFARequired           = "mfa_required"
+	TooManyRequests       = "Too Many Requests"
+	TooManyLoginAttempts  = "Too Many Login Attempts"
+	RequestTooLarge       = "Request Too Large"
+	PasswordResetRequired = "password_reset_required"
 )
 
+// Error types are documented under a heading named after their code
+const ErrorTypeBase = "https://github.com/dannym87/go-notes-app/blob/master/ERRORS.md#"
+
+// errorCodes are the stable, machine-readable codes of the titles above. Clients
+// should match on these, as titles may be reworded. Errors from osin are already
+// codes, e.g. invalid_grant, and are used as they are.
+var errorCodes = map[string]string{
+	InternalServerError:  "internal_error",
+	MalformedJson:        "malformed_json",
+	MalformedRequest:     "malformed_request",
+	NotFound:             "not_found",
+	ValidationError:      "validation_failed",
+	Conflict:             "conflict",
+	AuthenticationError:  "invalid_credentials",
+	Unauthorised:         "unauthorised",
+	Forbidden:            "forbidden",
+	TooManyRequests:      "rate_limit_exceeded",
+	TooManyLoginAttempts: "login_throttled",
+	RequestTooLarge:      "request_too_large",
+}
+
+func errorCode(title string) string {
+	if code, ok := errorCodes[title]; ok {
+		return code
+	}
+
+	return title
+}
+
+// ErrorObject is an entry of the errors envelope and, with application/problem+json,
+// an RFC 7807 problem details object
 type ErrorObject struct {
+	Type   string `json:"type"`
 	Title  string `json:"title"`
+	Code   string `json:"code"`
 	Detail string `json:"detail"`
 	Status int    `json:"status"`
+	// Path of the request that failed
+	Instance  string `json:"instance,omitempty"`
+	RequestId string `json:"request_id,omitempty"`
+	// JSON pointer to the request field that failed validation
+	Pointer string                 `json:"pointer,omitempty"`
+	Meta    map[string]interface{} `json:"meta,omitempty"`
+	// Values for the placeholders in Detail
+	params []interface{}
+}
+
+// Problem describes the first of a response's errors as an RFC 7807 problem, and lists
+// them all if there is more than one
+type Problem struct {
+	*ErrorObject
+	Errors []*ErrorObject `json:"errors,omitempty"`
 }
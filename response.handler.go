@@ -4,19 +4,24 @@ import (
 	"github.com/gin-gonic/gin"
 	"net/http"
 	"gopkg.in/go-playground/validator.v9"
-	"fmt"
+	"regexp"
+	"strings"
 )
 
-const fieldErrMsg = "Field validation for '%s' failed on the '%s' tag [Key: '%s']"
+const fieldErrMsg = "Field validation for '{0}' failed on the '{1}' tag"
+
+const MIMEProblemJSON = "application/problem+json"
 
 type ResponseHandler interface {
 	JSON(c *gin.Context, status int, model interface{})
+	JSONPage(c *gin.Context, model interface{}, p *Pagination)
 	Errors(c *gin.Context, status int, errorObjects []*ErrorObject)
-	Error(c *gin.Context, title string, status int, detail string)
+	Error(c *gin.Context, title string, status int, detail string, params ...interface{})
 	ValidationErrors(c *gin.Context, errors error)
 	InternalServerError(c *gin.Context)
 	NotFound(c *gin.Context)
 	MalformedJSON(c *gin.Context)
+	MalformedRequest(c *gin.Context)
 	NoRoute(c *gin.Context)
 	Unauthorised(c *gin.Context)
 }
@@ -33,15 +38,59 @@ func (*APIResponseHandler) JSON(c *gin.Context, status int, model interface{}) {
 	})
 }
 
-func (*APIResponseHandler) Errors(c *gin.Context, status int, errorObjects []*ErrorObject) {
-	c.JSON(status, gin.H{
-		"errors": errorObjects,
+// JSONPage responds with a page of a list, its pagination in meta and links to the
+// pages around it in the Link header
+func (*APIResponseHandler) JSONPage(c *gin.Context, model interface{}, p *Pagination) {
+	c.Header("Link", p.Links(c.Request.URL))
+	c.JSON(http.StatusOK, gin.H{
+		"data": model,
+		"meta": p.Meta(),
 	})
 }
 
-func (r *APIResponseHandler) Error(c *gin.Context, title string, status int, detail string) {
+// Errors responds with the errors in an envelope, or as an RFC 7807 problem if the
+// client prefers application/problem+json. Details are translated into the language
+// the client prefers.
+func (*APIResponseHandler) Errors(c *gin.Context, status int, errorObjects []*ErrorObject) {
+	requestId := NewRequestHandler().GetRequestId(c)
+	trans := translations.ForRequest(c)
+
+	for _, e := range errorObjects {
+		e.Detail = translations.Message(trans, e.Detail, e.params...)
+
+		if e.Code == "" {
+			e.Code = errorCode(e.Title)
+		}
+
+		e.Type = ErrorTypeBase + e.Code
+		e.Instance = c.Request.URL.Path
+		e.RequestId = requestId
+	}
+
+	c.Header("Vary", "Accept, Accept-Language")
+	c.Header("Content-Language", trans.Locale())
+
+	if c.NegotiateFormat(gin.MIMEJSON, MIMEProblemJSON) != MIMEProblemJSON || len(errorObjects) == 0 {
+		c.JSON(status, gin.H{
+			"errors": errorObjects,
+		})
+		return
+	}
+
+	problem := &Problem{ErrorObject: errorObjects[0]}
+	if len(errorObjects) > 1 {
+		problem.Errors = errorObjects
+	}
+
+	c.Header("Content-Type", MIMEProblemJSON)
+	c.JSON(status, problem)
+}
+
+// Error responds with a single error. {0}, {1}... in detail are replaced by params,
+// after it is translated.
+func (r *APIResponseHandler) Error(c *gin.Context, title string, status int, detail string, params ...interface{}) {
 	r.Errors(c, status, []*ErrorObject{
-		&ErrorObject{title, detail, status},
+		&ErrorObject{Title: title, Detail: detail, Status: status, params: params},
 	})
 }
 
@@ -57,18 +106,24 @@ func (r *APIResponseHandler) MalformedJSON(c *gin.Context) {
 	r.Error(c, MalformedJson, http.StatusBadRequest, "Request contains invalid JSON")
 }
 
+func (r *APIResponseHandler) MalformedRequest(c *gin.Context) {
+	r.Error(c, MalformedRequest, http.StatusBadRequest, "Request contains invalid parameters")
+}
+
 func (r *APIResponseHandler) NoRoute(c *gin.Context) {
 	r.Error(c, NotFound, http.StatusNotFound, "No route found")
 }
 
 func (r *APIResponseHandler) ValidationErrors(c *gin.Context, err error) {
 	var errors []*ErrorObject
+	trans := translations.ForRequest(c)
 
 	for _, err := range err.(validator.ValidationErrors) {
 		errors = append(errors, &ErrorObject{
-			ValidationError,
-			fmt.Sprintf(fieldErrMsg, err.Field(), err.Tag(), err.Namespace()),
-			http.StatusUnprocessableEntity,
+			Title:   ValidationError,
+			Detail:  translations.ValidationMessage(trans, err),
+			Status:  http.StatusUnprocessableEntity,
+			Pointer: fieldPointer(err.Namespace()),
 		})
 	}
 
@@ -78,3 +133,18 @@ func (r *APIResponseHandler) ValidationErrors(c *gin.Context, err error) {
 func (r *APIResponseHandler) Unauthorised(c *gin.Context) {
 	r.Error(c, Unauthorised, http.StatusUnauthorized, "You don't have permission for this resource")
 }
+
+var namespaceIndex = regexp.MustCompile(`\[([^\]]*)\]`)
+
+// fieldPointer turns the namespace of a field, e.g. Note.tags[0].name, into a JSON
+// pointer to it in the request, e.g. /tags/0/name
+func fieldPointer(namespace string) string {
+	namespace = namespaceIndex.ReplaceAllString(namespace, ".$1")
+
+	parts := strings.Split(namespace, ".")[1:]
+	for i, part := range parts {
+		parts[i] = strings.Replace(strings.Replace(part, "~", "~0", -1), "/", "~1", -1)
+	}
+
+	return "/" + strings.Join(parts, "/")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"net/http/httptest"
+)
+
+func TestResponseHandler_ValidationErrorsHaveCodesAndPointers(t *testing.T) {
+	data, _ := json.Marshal(Note{})
+	req, _ := http.NewRequest(http.MethodPost, "/v1/notes", bytes.NewBuffer(data))
+	req.Header.Set("Authorization", "Bearer access-token")
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		data := struct {
+			Errors []*ErrorObject `json:"errors"`
+		}{}
+
+		if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil || len(data.Errors) != 1 {
+			t.Errorf("Expected an errors envelope, got '%s'", w.Body.String())
+			return false
+		}
+
+		e := data.Errors[0]
+		if e.Code != "validation_failed" || e.Type != ErrorTypeBase+"validation_failed" {
+			t.Errorf("Expected code and type for validation_failed, got '%s' and '%s'", e.Code, e.Type)
+		}
+
+		if e.Pointer != "/title" || e.Instance != "/v1/notes" {
+			t.Errorf("Expected pointer '/title' and instance '/v1/notes', got '%s' and '%s'", e.Pointer, e.Instance)
+		}
+
+		return true
+	})
+}
+
+func TestResponseHandler_NegotiatesProblemJSON(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "/v1/notes/999", nil)
+	req.Header.Set("Authorization", "Bearer access-token")
+	req.Header.Set("Accept", "application/problem+json, application/json;q=0.9")
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		if contentType := w.Header().Get("Content-Type"); contentType != MIMEProblemJSON {
+			t.Errorf("Expected content type '%s', got '%s'", MIMEProblemJSON, contentType)
+			return false
+		}
+
+		problem := new(ErrorObject)
+		json.Unmarshal(w.Body.Bytes(), problem)
+
+		if problem.Code != "not_found" || problem.Status != http.StatusNotFound || problem.Instance != "/v1/notes/999" {
+			t.Errorf("Expected a not_found problem, got '%s'", w.Body.String())
+			return false
+		}
+
+		return true
+	})
+}
+
+func TestResponseHandler_ProblemListsEveryError(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request, _ = http.NewRequest(http.MethodPost, "/v1/notes", nil)
+	c.Request.Header.Set("Accept", MIMEProblemJSON)
+
+	NewResponseHandler().Errors(c, http.StatusUnprocessableEntity, []*ErrorObject{
+		{Title: ValidationError, Detail: "First", Status: http.StatusUnprocessableEntity, Pointer: "/title"},
+		{Title: ValidationError, Detail: "Second", Status: http.StatusUnprocessableEntity, Pointer: "/content"},
+	})
+
+	problem := new(Problem)
+	json.Unmarshal(w.Body.Bytes(), problem)
+
+	if problem.ErrorObject == nil || problem.Detail != "First" || len(problem.Errors) != 2 {
+		t.Errorf("Expected the first error with both listed, got '%s'", w.Body.String())
+	}
+}
+
+func TestFieldPointer(t *testing.T) {
+	for namespace, pointer := range map[string]string{
+		"Note.title":          "/title",
+		"Note.tags[1].name":   "/tags/1/name",
+		"Client.scopes[a/b]":  "/scopes/a~1b",
+		"Workspace.members~x": "/members~0x",
+	} {
+		if p := fieldPointer(namespace); p != pointer {
+			t.Errorf("Expected '%s' for '%s', got '%s'", pointer, namespace, p)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+const (
+	RoleUser     = "user"
+	RoleAdmin    = "admin"
+	RoleReadOnly = "read-only"
+)
+
+const (
+	PermissionNotesRead     = "notes:read"
+	PermissionNotesWrite    = "notes:write"
+	PermissionTagsRead      = "tags:read"
+	PermissionTagsWrite     = "tags:write"
+	PermissionClientsManage = "clients:manage"
+	PermissionUsersManage   = "users:manage"
+	PermissionStatsRead     = "stats:read"
+	PermissionAuditRead     = "audit:read"
+	// Only granted by workspace roles
+	PermissionWorkspaceManage = "workspace:manage"
+)
+
+const (
+	WorkspaceRoleOwner  = "owner"
+	WorkspaceRoleEditor = "editor"
+	WorkspaceRoleViewer = "viewer"
+)
+
+var rolePermissions = map[string][]string{
+	RoleReadOnly: {
+		PermissionNotesRead,
+		PermissionTagsRead,
+	},
+	RoleUser: {
+		PermissionNotesRead,
+		PermissionNotesWrite,
+		PermissionTagsRead,
+		PermissionTagsWrite,
+	},
+	RoleAdmin: {
+		PermissionNotesRead,
+		PermissionNotesWrite,
+		PermissionTagsRead,
+		PermissionTagsWrite,
+		PermissionClientsManage,
+		PermissionUsersManage,
+		PermissionStatsRead,
+		PermissionAuditRead,
+	},
+}
+
+var workspaceRolePermissions = map[string][]string{
+	WorkspaceRoleViewer: {
+		PermissionNotesRead,
+		PermissionTagsRead,
+	},
+	WorkspaceRoleEditor: {
+		PermissionNotesRead,
+		PermissionNotesWrite,
+		PermissionTagsRead,
+		PermissionTagsWrite,
+	},
+	WorkspaceRoleOwner: {
+		PermissionNotesRead,
+		PermissionNotesWrite,
+		PermissionTagsRead,
+		PermissionTagsWrite,
+		PermissionWorkspaceManage,
+	},
+}
+
+// Can reports whether the user's role grants permission. Users created before roles
+// existed have the user role.
+func (u *User) Can(permission string) bool {
+	role := u.Role
+	if role == "" {
+		role = RoleUser
+	}
+
+	for _, p := range rolePermissions[role] {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isPermission(permission string) bool {
+	for _, permissions := range []map[string][]string{rolePermissions, workspaceRolePermissions} {
+		for _, list := range permissions {
+			for _, p := range list {
+				if p == permission {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
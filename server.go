@@ -0,0 +1,19 @@
+package main
+
+import (
+	"net/http"
+)
+
+// NewHTTPServer returns a server for handler with the configured timeouts and header
+// size limit
+func NewHTTPServer(config ServerConfig, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              config.Addr,
+		Handler:           handler,
+		ReadTimeout:       config.ReadTimeout,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+		MaxHeaderBytes:    config.MaxHeaderBytes,
+	}
+}
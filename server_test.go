@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"bytes"
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"time"
+)
+
+func TestApp_ShutdownDrainsRequests(t *testing.T) {
+	db, err := gorm.Open("sqlite3", "./notes-server-test.db")
+	if err != nil {
+		t.Fatalf("Cannot connect to database: '%s'", err.Error())
+	}
+	defer os.Remove("./notes-server-test.db")
+
+	db.LogMode(false)
+	db.SingularTable(true)
+	createSchema(db)
+
+	a := newTestApp(db, NewOAuth2Config())
+	a.Config().Server.Addr = "127.0.0.1:0"
+
+	started := make(chan struct{})
+	a.Engine().GET("/slow", func(c *gin.Context) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		c.String(http.StatusOK, "done")
+	})
+
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Could not start server: '%s'", err.Error())
+	}
+
+	if !a.TokenJanitor().Running() {
+		t.Errorf("Expected the token janitor to be started")
+	}
+
+	url := "http://" + a.Addr()
+	status := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(url + "/slow")
+		if err != nil {
+			status <- 0
+			return
+		}
+		resp.Body.Close()
+		status <- resp.StatusCode
+	}()
+
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := a.Shutdown(ctx); err != nil {
+		t.Errorf("Expected a clean shutdown, got '%s'", err.Error())
+	}
+
+	if code := <-status; code != http.StatusOK {
+		t.Errorf("Expected the in-flight request to finish with '200', got '%d'", code)
+	}
+
+	if _, err := http.Get(url + "/healthz"); err == nil {
+		t.Errorf("Expected new requests to be refused after shutdown")
+	}
+
+	if a.TokenJanitor().Running() {
+		t.Errorf("Expected the token janitor to be stopped")
+	}
+
+	if err := a.Db().DB().Ping(); err == nil {
+		t.Errorf("Expected the database to be closed")
+	}
+}
+
+func TestNewHTTPServer_Timeouts(t *testing.T) {
+	config := NewConfig().Server
+	server := NewHTTPServer(config, nil)
+
+	if server.ReadTimeout != config.ReadTimeout || server.WriteTimeout != config.WriteTimeout || server.IdleTimeout != config.IdleTimeout || server.MaxHeaderBytes != config.MaxHeaderBytes {
+		t.Errorf("Expected the configured limits, got '%+v'", server)
+	}
+}
+
+func TestBodyLimitMiddleware_RefusesLargeBodies(t *testing.T) {
+	body := `{"title": "Large", "text": "` + strings.Repeat("a", app.Config().Server.MaxBodyBytes) + `"}`
+	req, _ := http.NewRequest(http.MethodPost, "/v1/notes", bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer access-token")
+
+	testHTTPResponse(t, app.Engine(), req, func(w *httptest.ResponseRecorder) bool {
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected status code '413', got '%d'", w.Code)
+			return false
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"sync"
+	"time"
+)
+
+// Session is a login on one device. It is backed by the current refresh token of a
+// family, so its id changes whenever the session is refreshed.
+type Session struct {
+	ID         uint       `json:"id"`
+	ClientId   uint       `json:"client_id"`
+	ClientName string     `json:"client_name"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"`
+}
+
+// NewSession describes the session of refreshToken. Current is set if accessToken
+// belongs to it.
+func NewSession(refreshToken *OAuth2RefreshToken, accessToken string) *Session {
+	session := &Session{
+		ID:        refreshToken.ID,
+		ClientId:  refreshToken.ClientId,
+		CreatedAt: refreshToken.SignedInAt,
+	}
+
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = refreshToken.CreatedAt
+	}
+
+	if refreshToken.Client != nil {
+		session.ClientName = refreshToken.Client.Name
+	}
+
+	if t := refreshToken.AccessToken; t != nil {
+		session.LastUsedAt = t.LastUsedAt
+		session.IP = t.LastUsedIP
+		session.UserAgent = t.UserAgent
+		session.Current = t.AccessToken == accessToken
+	}
+
+	return session
+}
+
+// SessionTracker records when and where access tokens are used. A token is written
+// at most once per interval, so most requests do not touch the database.
+type SessionTracker struct {
+	db       *gorm.DB
+	interval time.Duration
+	mu       sync.Mutex
+	seen     map[string]time.Time
+	swept    time.Time
+}
+
+func NewSessionTracker(db *gorm.DB, interval time.Duration) *SessionTracker {
+	return &SessionTracker{
+		db:       db,
+		interval: interval,
+		seen:     map[string]time.Time{},
+		swept:    time.Now(),
+	}
+}
+
+// Start records the client that was just issued token
+func (t *SessionTracker) Start(token, ip, userAgent string) error {
+	t.mu.Lock()
+	t.seen[hashToken(token)] = time.Now()
+	t.mu.Unlock()
+
+	return t.record(token, ip, userAgent)
+}
+
+// Touch records a use of token unless it was recorded recently
+func (t *SessionTracker) Touch(token, ip, userAgent string) error {
+	now := time.Now()
+	key := hashToken(token)
+
+	t.mu.Lock()
+	if last, ok := t.seen[key]; ok && now.Sub(last) < t.interval {
+		t.mu.Unlock()
+		return nil
+	}
+
+	// Tokens are forgotten an interval after they were last seen, so sweeping once an
+	// interval is enough to keep the map from growing
+	if now.Sub(t.swept) >= t.interval {
+		for k, last := range t.seen {
+			if now.Sub(last) >= t.interval {
+				delete(t.seen, k)
+			}
+		}
+
+		t.swept = now
+	}
+
+	t.seen[key] = now
+	t.mu.Unlock()
+
+	return t.record(token, ip, userAgent)
+}
+
+func (t *SessionTracker) record(token, ip, userAgent string) error {
+	now := time.Now()
+
+	return t.db.Model(&OAuth2AccessToken{}).
+		Where("token_hash = ?", hashToken(token)).
+		UpdateColumns(&OAuth2AccessToken{LastUsedAt: &now, LastUsedIP: ip, UserAgent: userAgent}).Error
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+type Stats struct {
+	Users          UserStats `json:"users"`
+	Notes          int       `json:"notes"`
+	Tags           int       `json:"tags"`
+	Clients        int       `json:"clients"`
+	ActiveSessions int       `json:"active_sessions"`
+	// Sessions started in the last 24 hours
+	SignIns              int `json:"sign_ins_24h"`
+	PersonalAccessTokens int `json:"personal_access_tokens"`
+}
+
+type UserStats struct {
+	Total    int            `json:"total"`
+	Disabled int            `json:"disabled"`
+	ByRole   map[string]int `json:"by_role"`
+}
+
+func CollectStats(db *gorm.DB) (*Stats, error) {
+	stats := &Stats{Users: UserStats{ByRole: map[string]int{}}}
+	now := time.Now()
+	activeSessions := db.Model(&OAuth2RefreshToken{}).Where("used_at IS NULL AND expires > ?", now)
+
+	counts := []struct {
+		query *gorm.DB
+		count *int
+	}{
+		{db.Model(&User{}), &stats.Users.Total},
+		{db.Model(&User{}).Where("disabled_at IS NOT NULL"), &stats.Users.Disabled},
+		{db.Model(&Note{}), &stats.Notes},
+		{db.Model(&Tag{}), &stats.Tags},
+		{db.Model(&OAuth2Client{}), &stats.Clients},
+		{activeSessions, &stats.ActiveSessions},
+		{activeSessions.Where("signed_in_at > ?", now.Add(-24*time.Hour)), &stats.SignIns},
+		{db.Model(&PersonalAccessToken{}), &stats.PersonalAccessTokens},
+	}
+
+	for _, c := range counts {
+		if err := c.query.Count(c.count).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	rows, err := db.Model(&User{}).Select("role, count(*)").Group("role").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var role string
+		var count int
+
+		if err := rows.Scan(&role, &count); err != nil {
+			return nil, err
+		}
+
+		stats.Users.ByRole[role] = count
+	}
+
+	return stats, rows.Err()
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// CertificateReloader serves the certificate in a pair of PEM files and reloads it
+// when either file changes or on SIGHUP. Connections already open keep the certificate
+// they were made with, and a pair that fails to load leaves the last good one in use.
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+	interval time.Duration
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func NewCertificateReloader(certFile string, keyFile string, interval time.Duration) (*CertificateReloader, error) {
+	r := &CertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		interval: interval,
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (r *CertificateReloader) Reload() error {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.cert = &cert
+	r.modTimes = modTimes
+
+	return nil
+}
+
+func (r *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Start checks the files for changes every interval, and listens for SIGHUP, until
+// Stop is called
+func (r *CertificateReloader) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.stop != nil {
+		return
+	}
+
+	r.stop = make(chan struct{})
+	r.done = make(chan struct{})
+
+	go r.run(r.stop, r.done)
+}
+
+func (r *CertificateReloader) Stop() {
+	r.mu.Lock()
+	stop, done := r.stop, r.done
+	r.stop = nil
+	r.done = nil
+	r.mu.Unlock()
+
+	if stop == nil {
+		return
+	}
+
+	close(stop)
+	<-done
+}
+
+func (r *CertificateReloader) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+			r.reloadAndLog()
+		case <-ticker.C:
+			if r.changed() {
+				r.reloadAndLog()
+			}
+		}
+	}
+}
+
+func (r *CertificateReloader) reloadAndLog() {
+	if err := r.Reload(); err != nil {
+		slog.Error("Could not reload TLS certificate", "cert_file", r.certFile, "error", err)
+		return
+	}
+
+	slog.Info("Reloaded TLS certificate", "cert_file", r.certFile)
+}
+
+func (r *CertificateReloader) changed() bool {
+	modTimes, err := r.fileModTimes()
+	if err != nil {
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return modTimes != r.modTimes
+}
+
+func (r *CertificateReloader) fileModTimes() ([2]time.Time, error) {
+	var modTimes [2]time.Time
+
+	for i, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return modTimes, err
+		}
+
+		modTimes[i] = info.ModTime()
+	}
+
+	return modTimes, nil
+}
+
+// NewTLSConfig serves the reloader's certificate and, if a client CA is configured,
+// verifies client certificates against it
+func NewTLSConfig(config TLSConfig, certificates *CertificateReloader) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: certificates.GetCertificate,
+	}
+
+	if config.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := ioutil.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig.ClientCAs = x509.NewCertPool()
+	if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+		return nil, errors.New("No certificates found in the client CA file")
+	}
+
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	if config.ClientAuth == ClientAuthRequire {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+// allowCertificateClientAuth lets a client that presented a verified certificate leave
+// out its secret, as in RFC 8705. osin only reads client_id from the form if
+// client_secret is there too, so an empty one is added, and the certificate is checked
+// in its place by OAuth2Client.Authenticate.
+func allowCertificateClientAuth(r *http.Request) {
+	if clientCertificateSubject(r.TLS) == "" {
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return
+	}
+
+	if _, ok := r.Form["client_secret"]; !ok && r.Form.Get("client_id") != "" {
+		r.Form.Set("client_secret", "")
+	}
+}
+
+// clientCertificateSubject returns the subject distinguished name of the verified
+// client certificate of a connection, or an empty string
+func clientCertificateSubject(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return state.VerifiedChains[0][0].Subject.String()
+}
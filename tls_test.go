@@ -0,0 +1,177 @@
+package main
+
+import (
+	"testing"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/jinzhu/gorm"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+type testCertificate struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCertificate issues a certificate for subject, signed by parent or, if parent
+// is nil, by itself as a CA
+func newTestCertificate(t *testing.T, subject pkix.Name, parent *testCertificate) *testCertificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key: '%s'", err.Error())
+	}
+
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      subject,
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	signer := &testCertificate{template, key}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer = parent
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, signer.cert, &key.PublicKey, signer.key)
+	if err != nil {
+		t.Fatalf("Could not create certificate: '%s'", err.Error())
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+
+	return &testCertificate{cert, key}
+}
+
+func (c *testCertificate) write(t *testing.T, certFile string, keyFile string) {
+	key, _ := x509.MarshalECPrivateKey(c.key)
+
+	ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600)
+	ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: key}), 0600)
+}
+
+func (c *testCertificate) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func TestApp_ServesTLSWithClientCertificates(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "notes-tls")
+	defer os.RemoveAll(dir)
+
+	ca := newTestCertificate(t, pkix.Name{CommonName: "Notes Test CA"}, nil)
+	ca.write(t, filepath.Join(dir, "ca.pem"), filepath.Join(dir, "ca-key.pem"))
+
+	certFile, keyFile := filepath.Join(dir, "server.pem"), filepath.Join(dir, "server-key.pem")
+	newTestCertificate(t, pkix.Name{CommonName: "first"}, ca).write(t, certFile, keyFile)
+
+	client := newTestCertificate(t, pkix.Name{CommonName: "reports", Organization: []string{"Example"}}, ca)
+
+	db, err := gorm.Open("sqlite3", "./notes-tls-test.db")
+	if err != nil {
+		t.Fatalf("Cannot connect to database: '%s'", err.Error())
+	}
+	defer os.Remove("./notes-tls-test.db")
+
+	db.LogMode(false)
+	db.SingularTable(true)
+	populateDB(db)
+	db.Model(&OAuth2Client{}).Where("id = ?", 1).UpdateColumn("tls_client_auth_subject_dn", "CN=reports,O=Example")
+
+	a := newTestApp(db, NewOAuth2Config())
+	a.Config().Server.Addr = "127.0.0.1:0"
+	a.Config().Server.TLS = TLSConfig{
+		CertFile:       certFile,
+		KeyFile:        keyFile,
+		ReloadInterval: 20 * time.Millisecond,
+		ClientCAFile:   filepath.Join(dir, "ca.pem"),
+		ClientAuth:     ClientAuthOptional,
+	}
+
+	if err := a.Start(context.Background()); err != nil {
+		t.Fatalf("Could not start server: '%s'", err.Error())
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		a.Shutdown(ctx)
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	newClient := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: roots, Certificates: certificates},
+			DisableKeepAlives: true,
+		}}
+	}
+
+	login := func(client *http.Client) int {
+		params := url.Values{}
+		params.Add("grant_type", "password")
+		params.Add("username", "test2@go-notes.com")
+		params.Add("password", "password")
+		params.Add("client_id", "1")
+
+		resp, err := client.Post("https://"+a.Addr()+"/token", "application/x-www-form-urlencoded", bytes.NewBufferString(params.Encode()))
+		if err != nil {
+			t.Fatalf("Could not request token: '%s'", err.Error())
+		}
+		resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	if code := login(newClient(client.tlsCertificate())); code != http.StatusCreated {
+		t.Errorf("Expected the client certificate to authenticate the client, got '%d'", code)
+	}
+
+	if code := login(newClient()); code == http.StatusCreated {
+		t.Errorf("Expected a client without a certificate to need its secret")
+	}
+
+	newTestCertificate(t, pkix.Name{CommonName: "second"}, ca).write(t, certFile, keyFile)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		resp, err := newClient().Get("https://" + a.Addr() + "/healthz")
+		if err == nil {
+			resp.Body.Close()
+
+			if resp.TLS.PeerCertificates[0].Subject.CommonName == "second" {
+				break
+			}
+		}
+
+		if time.Now().After(deadline) {
+			t.Errorf("Expected the new certificate to be served")
+			break
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+}
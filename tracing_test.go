@@ -0,0 +1,188 @@
+package main
+
+import (
+	"testing"
+	"bytes"
+	"context"
+	"encoding/hex"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+	coltrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+// testCollector receives spans over OTLP/HTTP like an OpenTelemetry collector
+type testCollector struct {
+	*httptest.Server
+	mu    sync.Mutex
+	spans []*tracepb.Span
+}
+
+func newTestCollector() *testCollector {
+	collector := &testCollector{}
+	collector.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+
+		req := new(coltrace.ExportTraceServiceRequest)
+		if err := proto.Unmarshal(body, req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		collector.mu.Lock()
+		for _, resourceSpans := range req.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				collector.spans = append(collector.spans, scopeSpans.Spans...)
+			}
+		}
+		collector.mu.Unlock()
+
+		resp, _ := proto.Marshal(&coltrace.ExportTraceServiceResponse{})
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.Write(resp)
+	}))
+
+	return collector
+}
+
+// span returns the first span received with the given name
+func (c *testCollector) span(name string) *tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, s := range c.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+func TestTracing_ExportsSpans(t *testing.T) {
+	collector := newTestCollector()
+	defer collector.Close()
+
+	stop, err := InitTracing(TracingConfig{Enabled: true, Endpoint: collector.URL + "/v1/traces", ServiceName: "notes-test", SampleRatio: 1})
+	if err != nil {
+		t.Fatalf("Could not start tracing: '%s'", err.Error())
+	}
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	traceId := "4bf92f3577b34da6a3ce929d0e0e4736"
+	req, _ := http.NewRequest(http.MethodGet, "/v1/notes/1", nil)
+	req.Header.Set("Authorization", "Bearer access-token")
+	req.Header.Set("traceparent", "00-"+traceId+"-00f067aa0ba902b7-01")
+	app.Engine().ServeHTTP(httptest.NewRecorder(), req)
+
+	passwordGrant("test2@go-notes.com", "password")
+
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "traced", UserId: 1})
+	req, _ = http.NewRequest(http.MethodGet, "/v1/tags", nil)
+	req.Header.Set("Authorization", "Bearer "+pat)
+	app.Engine().ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest(http.MethodGet, "/v1/me/sessions", nil)
+	req.Header.Set("Authorization", "Bearer access-token")
+	app.Engine().ServeHTTP(httptest.NewRecorder(), req)
+
+	if err := stop(context.Background()); err != nil {
+		t.Fatalf("Could not flush spans: '%s'", err.Error())
+	}
+
+	request := collector.span("GET /v1/notes/:id")
+	if request == nil {
+		t.Fatalf("Expected a span for the request")
+	}
+
+	if hex.EncodeToString(request.TraceId) != traceId {
+		t.Errorf("Expected the request to continue trace '%s', got '%x'", traceId, request.TraceId)
+	}
+
+	for _, name := range []string{"NoteRepository.FindById", "GORMStorage.LoadAccess"} {
+		span := collector.span(name)
+		if span == nil {
+			t.Errorf("Expected a span named '%s'", name)
+			continue
+		}
+
+		if !bytes.Equal(span.ParentSpanId, request.SpanId) {
+			t.Errorf("Expected '%s' to be a child of the request span", name)
+		}
+	}
+
+	for _, name := range []string{"POST /token", "GORMStorage.GetClient", "GORMStorage.SaveAccess", "bcrypt.CompareHashAndPassword"} {
+		if collector.span(name) == nil {
+			t.Errorf("Expected a span named '%s'", name)
+		}
+	}
+
+	children := map[string][]string{
+		"GET /v1/tags":        {"PersonalAccessTokenRepository.FindByToken", "PersonalAccessTokenRepository.Touch", "TagRepository.FindAll"},
+		"GET /v1/me/sessions": {"SessionRepository.FindByUserId"},
+	}
+
+	for parent, names := range children {
+		request := collector.span(parent)
+		if request == nil {
+			t.Errorf("Expected a span for '%s'", parent)
+			continue
+		}
+
+		for _, name := range names {
+			if span := collector.span(name); span == nil || !bytes.Equal(span.ParentSpanId, request.SpanId) {
+				t.Errorf("Expected a span named '%s' as a child of '%s'", name, parent)
+			}
+		}
+	}
+}
+
+func TestTracing_AuthenticatesOncePerRequest(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(noop.NewTracerProvider())
+
+	_, pat, _ := NewPersonalAccessTokenRepository(app.Db()).Create(context.Background(), &PersonalAccessToken{Name: "routes", UserId: 1})
+
+	// The last route each handler registers, which had the middleware of every route
+	// before it when the middleware was added again for each route. Routes under
+	// /v1/me only take OAuth2 tokens, which are loaded by GORMStorage.
+	routes := []struct {
+		method string
+		path   string
+		token  string
+		lookup string
+	}{
+		{http.MethodPatch, "/v1/notes/1", pat, "PersonalAccessTokenRepository.FindByToken"},
+		{http.MethodPatch, "/v1/workspaces/1/tags/1", pat, "PersonalAccessTokenRepository.FindByToken"},
+		{http.MethodDelete, "/v1/me/tokens/999", "access-token", "GORMStorage.LoadAccess"},
+		{http.MethodDelete, "/v1/me/sessions/999", "access-token", "GORMStorage.LoadAccess"},
+		{http.MethodPost, "/v1/me/2fa/confirm", "access-token", "GORMStorage.LoadAccess"},
+	}
+
+	for _, route := range routes {
+		before := len(recorder.Ended())
+
+		req, _ := http.NewRequest(route.method, route.path, nil)
+		req.Header.Set("Authorization", "Bearer "+route.token)
+		app.Engine().ServeHTTP(httptest.NewRecorder(), req)
+
+		lookups := 0
+		for _, span := range recorder.Ended()[before:] {
+			if span.Name() == route.lookup {
+				lookups++
+			}
+		}
+
+		if lookups != 1 {
+			t.Errorf("Expected %s %s to load the token once, got %d", route.method, route.path, lookups)
+		}
+	}
+}
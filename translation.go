@@ -0,0 +1,226 @@
+package main
+
+import (
+	"embed"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/fr"
+	ut "github.com/go-playground/universal-translator"
+	"gopkg.in/go-playground/validator.v9"
+	en_translations "gopkg.in/go-playground/validator.v9/translations/en"
+	fr_translations "gopkg.in/go-playground/validator.v9/translations/fr"
+	"gopkg.in/yaml.v3"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed locales/*.yml
+var catalogFiles embed.FS
+
+// catalog is the messages of a language, in locales/<locale>.yml
+type catalog struct {
+	// Error details, keyed by their English text. {0}, {1}... stand for the values
+	// given with them.
+	Errors map[string]string `yaml:"errors"`
+	// Validation messages by tag, adding to or replacing validator's own. {0} is the
+	// field and {1} the tag's parameter.
+	Validation map[string]string `yaml:"validation"`
+}
+
+// Translations translates error details into the languages with a catalog. English is
+// the default.
+type Translations struct {
+	universal   *ut.UniversalTranslator
+	translators map[string]ut.Translator
+	catalogs    map[string]*catalog
+}
+
+var defaultTranslations = map[string]func(*validator.Validate, ut.Translator) error{
+	"en": en_translations.RegisterDefaultTranslations,
+	"fr": fr_translations.RegisterDefaultTranslations,
+}
+
+var translations = newTranslations()
+
+func newTranslations() *Translations {
+	t := &Translations{
+		universal:   ut.New(en.New(), en.New(), fr.New()),
+		translators: map[string]ut.Translator{},
+		catalogs:    map[string]*catalog{},
+	}
+
+	for locale := range defaultTranslations {
+		contents, err := catalogFiles.ReadFile("locales/" + locale + ".yml")
+		if err != nil {
+			log.Fatalf("Could not read %s messages: %s", locale, err)
+		}
+
+		c := new(catalog)
+		if err := yaml.Unmarshal(contents, c); err != nil {
+			log.Fatalf("Could not parse %s messages: %s", locale, err)
+		}
+
+		trans, _ := t.universal.GetTranslator(locale)
+		trans = &sharedTranslator{trans}
+
+		for key, text := range c.Errors {
+			if err := trans.Add(key, text, true); err != nil {
+				log.Fatalf("Invalid %s message '%s': %s", locale, key, err)
+			}
+		}
+
+		t.translators[locale] = trans
+		t.catalogs[locale] = c
+	}
+
+	return t
+}
+
+// Register adds the validation messages of every language to v
+func (t *Translations) Register(v *validator.Validate) error {
+	for locale, register := range defaultTranslations {
+		trans := t.translators[locale]
+
+		if err := register(v, trans); err != nil {
+			return err
+		}
+
+		for tag, text := range t.catalogs[locale].Validation {
+			tag, text := tag, text
+			add := func(trans ut.Translator) error {
+				return trans.Add(tag, text, true)
+			}
+
+			translate := func(trans ut.Translator, fe validator.FieldError) string {
+				message, _ := trans.T(tag, fe.Field(), fe.Param())
+				return message
+			}
+
+			if err := v.RegisterTranslation(tag, trans, add, translate); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ForRequest returns the translator for the language the request prefers by its
+// Accept-Language header
+func (t *Translations) ForRequest(c *gin.Context) ut.Translator {
+	for _, locale := range acceptedLanguages(c.GetHeader("Accept-Language")) {
+		if locale == "*" {
+			break
+		}
+
+		base := strings.SplitN(strings.Replace(locale, "-", "_", -1), "_", 2)[0]
+
+		for _, l := range []string{locale, base} {
+			if trans, ok := t.universal.FindTranslator(l); ok {
+				return t.translators[trans.Locale()]
+			}
+		}
+	}
+
+	return t.translators["en"]
+}
+
+// Message translates an error detail, falling back to the English text
+func (t *Translations) Message(trans ut.Translator, message string, params ...interface{}) string {
+	values := make([]string, len(params))
+	for i, p := range params {
+		values[i] = fmt.Sprint(p)
+	}
+
+	if translated, err := trans.T(message, values...); err == nil {
+		return translated
+	}
+
+	for i, v := range values {
+		message = strings.Replace(message, "{"+strconv.Itoa(i)+"}", v, -1)
+	}
+
+	return message
+}
+
+// ValidationMessage translates the message for a failed validation. validator gives
+// its own English message for a tag without a translation, which is replaced here.
+func (t *Translations) ValidationMessage(trans ut.Translator, err validator.FieldError) string {
+	untranslated := fmt.Sprint(err)
+	if message := err.Translate(trans); message != untranslated && message != "" {
+		return message
+	}
+
+	return t.Message(trans, fieldErrMsg, err.Field(), err.Tag())
+}
+
+// acceptedLanguages lists the language ranges of an Accept-Language header, most
+// preferred first
+func acceptedLanguages(header string) []string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []language
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		l := language{strings.TrimSpace(fields[0]), 1}
+
+		for _, param := range fields[1:] {
+			if q := strings.TrimSpace(param); strings.HasPrefix(q, "q=") {
+				l.quality, _ = strconv.ParseFloat(q[2:], 64)
+			}
+		}
+
+		if l.tag != "" && l.quality > 0 {
+			languages = append(languages, l)
+		}
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+
+	return tags
+}
+
+// sharedTranslator lets the validation messages be registered for more than one
+// validator. validator adds them to the translator each time, and the translator
+// refuses to add one it already has.
+type sharedTranslator struct {
+	ut.Translator
+}
+
+func (t *sharedTranslator) Add(key interface{}, text string, override bool) error {
+	return ignoreConflict(t.Translator.Add(key, text, override))
+}
+
+func (t *sharedTranslator) AddCardinal(key interface{}, text string, rule locales.PluralRule, override bool) error {
+	return ignoreConflict(t.Translator.AddCardinal(key, text, rule, override))
+}
+
+func (t *sharedTranslator) AddOrdinal(key interface{}, text string, rule locales.PluralRule, override bool) error {
+	return ignoreConflict(t.Translator.AddOrdinal(key, text, rule, override))
+}
+
+func (t *sharedTranslator) AddRange(key interface{}, text string, rule locales.PluralRule, override bool) error {
+	return ignoreConflict(t.Translator.AddRange(key, text, rule, override))
+}
+
+func ignoreConflict(err error) error {
+	if _, ok := err.(*ut.ErrConflictingTranslation); ok {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"gopkg.in/go-playground/validator.v9"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+func TestResponseHandler_TranslatesErrors(t *testing.T) {
+	for language, expected := range map[string][]string{
+		"":                     {"en", "title is a required field", "Resource does not exist"},
+		"fr-CA, en;q=0.5":      {"fr", "title est un champ obligatoire", "La ressource n'existe pas"},
+		"de, en;q=0.8, fr;q=0": {"en", "title is a required field", "Resource does not exist"},
+	} {
+		data, _ := json.Marshal(Note{})
+		create, _ := http.NewRequest(http.MethodPost, "/v1/notes", bytes.NewBuffer(data))
+		get, _ := http.NewRequest(http.MethodGet, "/v1/notes/999", nil)
+
+		for i, req := range []*http.Request{create, get} {
+			req.Header.Set("Authorization", "Bearer access-token")
+			req.Header.Set("Accept-Language", language)
+
+			w := httptest.NewRecorder()
+			app.Engine().ServeHTTP(w, req)
+
+			body := struct {
+				Errors []*ErrorObject `json:"errors"`
+			}{}
+			json.Unmarshal(w.Body.Bytes(), &body)
+
+			if len(body.Errors) != 1 || body.Errors[0].Detail != expected[i+1] {
+				t.Errorf("Expected '%s' for '%s', got '%s'", expected[i+1], language, w.Body.String())
+			}
+
+			if contentLanguage := w.Header().Get("Content-Language"); contentLanguage != expected[0] {
+				t.Errorf("Expected content language '%s' for '%s', got '%s'", expected[0], language, contentLanguage)
+			}
+		}
+	}
+}
+
+func TestTranslations_ValidationMessages(t *testing.T) {
+	data := struct {
+		Grants   string `json:"grants" validate:"grant_list"`
+		Secret   string `json:"secret"`
+		Redirect string `form:"redirect_uri" validate:"required_with=Secret"`
+	}{Grants: "implicit", Secret: "secret"}
+
+	errs := NewValidator().Struct(data).(validator.ValidationErrors)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request, _ = http.NewRequest(http.MethodPost, "/", nil)
+	c.Request.Header.Set("Accept-Language", "fr")
+	trans := translations.ForRequest(c)
+
+	expected := []string{
+		"grants doit être une liste de types d'autorisation pris en charge séparés par des espaces",
+		"La validation du champ 'redirect_uri' a échoué sur la règle 'required_with'",
+	}
+
+	for i, err := range errs {
+		if message := translations.ValidationMessage(trans, err); message != expected[i] {
+			t.Errorf("Expected '%s', got '%s'", expected[i], message)
+		}
+	}
+}
+
+func TestTranslations_CatalogsKeepPlaceholders(t *testing.T) {
+	placeholders := regexp.MustCompile(`\{\d+\}`)
+	sorted := func(s string) []string {
+		p := placeholders.FindAllString(s, -1)
+		sort.Strings(p)
+		return p
+	}
+
+	for locale, c := range translations.catalogs {
+		for key, text := range c.Errors {
+			if !reflect.DeepEqual(sorted(key), sorted(text)) {
+				t.Errorf("Expected the %s message for '%s' to have the same placeholders, got '%s'", locale, key, text)
+			}
+		}
+	}
+}
+
+func TestAcceptedLanguages(t *testing.T) {
+	languages := acceptedLanguages("en;q=0.5, fr-CA, de;q=0, *;q=0.1, nl;q=0.8")
+	expected := []string{"fr-CA", "nl", "en", "*"}
+
+	if !reflect.DeepEqual(languages, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, languages)
+	}
+}
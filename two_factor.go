@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/pquerna/otp/totp"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer           = "Go Notes"
+	recoveryCodeCount    = 10
+	mfaChallengeLifetime = 5 * time.Minute
+	// One-time passwords that may be tried with a challenge before it is void
+	mfaChallengeMaxAttempts = 5
+	// Length of a TOTP time step in seconds
+	totpPeriod = 30
+	// Assertion type of the second step of an MFA login, sent with grant_type=assertion
+	MFAAssertionType = "urn:go-notes:params:oauth:assertion-type:mfa-token"
+)
+
+var ErrMFAChallengeInvalid = errors.New("MFA token is invalid or has expired")
+
+type TOTPEnrolment struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"otpauth_uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorService struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorService(db *gorm.DB) *TwoFactorService {
+	return &TwoFactorService{db}
+}
+
+// Enrol generates a new TOTP secret and recovery codes for user. Two-factor
+// authentication is not enforced until the secret is confirmed with a code.
+func (s *TwoFactorService) Enrol(user *User) (*TOTPEnrolment, error) {
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: totpIssuer, AccountName: user.Email})
+	if err != nil {
+		return nil, err
+	}
+
+	enrolment := &TOTPEnrolment{Secret: key.Secret(), URI: key.URL()}
+	tx := s.db.Begin()
+
+	if err := tx.Model(user).UpdateColumn("totp_secret", key.Secret()).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Where("user_id = ?", user.ID).Delete(&UserRecoveryCode{}).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := randomString(8)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		code = strings.ToLower(code)
+		if err := tx.Create(&UserRecoveryCode{UserId: user.ID, CodeHash: hashToken(code)}).Error; err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+
+		enrolment.RecoveryCodes = append(enrolment.RecoveryCodes, code)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return enrolment, nil
+}
+
+func (s *TwoFactorService) Confirm(user *User, code string) bool {
+	step, ok := totpStep(user.TOTPSecret, code, time.Now())
+	if !ok || !s.useTOTPStep(user, step) {
+		return false
+	}
+
+	return s.db.Model(user).UpdateColumn("totp_enabled", true).Error == nil
+}
+
+// Verify checks a one-time password, which is either a TOTP code that has not been
+// used before or an unused recovery code
+func (s *TwoFactorService) Verify(user *User, code string) bool {
+	if step, ok := totpStep(user.TOTPSecret, code, time.Now()); ok {
+		return s.useTOTPStep(user, step)
+	}
+
+	res := s.db.Model(&UserRecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(strings.ToLower(code))).
+		UpdateColumn("used_at", time.Now())
+
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// Challenge returns a short-lived token which completes a login once presented with a
+// valid one-time password
+func (s *TwoFactorService) Challenge(user *User, clientId string, scope string) (string, error) {
+	token, err := randomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	challenge := &MFAChallenge{
+		TokenHash: hashToken(token),
+		UserId:    user.ID,
+		ClientId:  clientId,
+		Scope:     scope,
+		Expires:   time.Now().Add(mfaChallengeLifetime),
+	}
+
+	if err := s.db.Create(challenge).Error; err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// FindChallenge returns the unexpired challenge a token was issued for to clientId, and
+// its user
+func (s *TwoFactorService) FindChallenge(token string, clientId string) (*MFAChallenge, *User, error) {
+	challenge := new(MFAChallenge)
+
+	err := s.db.Where("token_hash = ? AND client_id = ? AND expires > ?", hashToken(token), clientId, time.Now()).
+		Find(challenge).Error
+
+	if err != nil {
+		return nil, nil, ErrMFAChallengeInvalid
+	}
+
+	user := new(User)
+	if err := s.db.First(user, challenge.UserId).Error; err != nil {
+		return nil, nil, ErrMFAChallengeInvalid
+	}
+
+	return challenge, user, nil
+}
+
+// CompleteChallenge consumes a challenge if code is a valid one-time password for its
+// user. A challenge is void once mfaChallengeMaxAttempts codes have been tried.
+func (s *TwoFactorService) CompleteChallenge(challenge *MFAChallenge, user *User, code string) (bool, error) {
+	// Attempts are counted before the code is checked, so that parallel requests
+	// cannot try more codes than allowed
+	res := s.db.Model(&MFAChallenge{}).
+		Where("id = ? AND attempts < ?", challenge.ID, mfaChallengeMaxAttempts).
+		UpdateColumn("attempts", gorm.Expr("attempts + 1"))
+
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	if res.RowsAffected != 1 {
+		s.db.Delete(challenge)
+		return false, ErrMFAChallengeInvalid
+	}
+
+	if !s.Verify(user, code) {
+		return false, nil
+	}
+
+	// Another request may have completed the challenge in the meantime
+	res = s.db.Delete(challenge)
+	if res.Error != nil {
+		return false, res.Error
+	}
+
+	if res.RowsAffected != 1 {
+		return false, ErrMFAChallengeInvalid
+	}
+
+	return true, nil
+}
+
+// useTOTPStep records the time step of a TOTP code as used, and reports whether it is
+// later than the last one used, so that no code can be used twice
+func (s *TwoFactorService) useTOTPStep(user *User, step int64) bool {
+	res := s.db.Model(&User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		UpdateColumn("totp_last_step", step)
+
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// totpStep returns the time step a TOTP code is valid for, allowing for a step of
+// clock drift either way
+func totpStep(secret string, code string, now time.Time) (int64, bool) {
+	if secret == "" {
+		return 0, false
+	}
+
+	for _, drift := range []int64{-1, 0, 1} {
+		step := now.Unix()/totpPeriod + drift
+
+		expected, err := totp.GenerateCode(secret, time.Unix(step*totpPeriod, 0))
+		if err == nil && subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+
+	return 0, false
+}
@@ -1,9 +1,91 @@
 package main
 
 import (
+	"fmt"
 	"gopkg.in/go-playground/validator.v9"
+	"net/url"
+	"reflect"
+	"strings"
+	"github.com/RangelReale/osin"
 )
 
 func NewValidator() *validator.Validate {
-	return validator.New()
+	v := validator.New()
+	v.RegisterValidation("uri_list", validateURIList)
+	v.RegisterValidation("grant_list", validateGrantList)
+	v.RegisterValidation("permission_list", validatePermissionList)
+	v.RegisterValidation("required_if", validateRequiredIf)
+	v.RegisterTagNameFunc(requestFieldName)
+
+	if err := translations.Register(v); err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+// requestFieldName names a field as it appears in requests, by its json or form tag
+func requestFieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form"} {
+		if name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]; name != "" && name != "-" {
+			return name
+		}
+	}
+
+	return field.Name
+}
+
+// validateURIList checks a space separated list of absolute URIs
+func validateURIList(fl validator.FieldLevel) bool {
+	for _, s := range strings.Fields(fl.Field().String()) {
+		u, err := url.Parse(s)
+		if err != nil || !u.IsAbs() || u.Host == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateRequiredIf requires a field when every field named in the parameter has the
+// value that follows it, as in required_if=Store redis. It lets settings of features
+// that are turned off be left out.
+func validateRequiredIf(fl validator.FieldLevel) bool {
+	params := strings.Fields(fl.Param())
+	if len(params)%2 != 0 {
+		panic(fmt.Sprintf("Bad parameter '%s' for required_if", fl.Param()))
+	}
+
+	for i := 0; i < len(params); i += 2 {
+		field, _, found := fl.GetStructFieldOKAdvanced(fl.Parent(), params[i])
+		if !found || fmt.Sprint(field.Interface()) != params[i+1] {
+			return true
+		}
+	}
+
+	return !fl.Field().IsZero()
+}
+
+// validateGrantList checks a space separated list of grant types the server supports
+func validateGrantList(fl validator.FieldLevel) bool {
+	for _, s := range strings.Fields(fl.Field().String()) {
+		switch osin.AccessRequestType(s) {
+		case osin.PASSWORD, osin.REFRESH_TOKEN, osin.ASSERTION:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// validatePermissionList checks a space separated list of permissions
+func validatePermissionList(fl validator.FieldLevel) bool {
+	for _, s := range strings.Fields(fl.Field().String()) {
+		if !isPermission(s) {
+			return false
+		}
+	}
+
+	return true
 }